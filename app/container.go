@@ -1,6 +1,8 @@
 package app
 
 import (
+	"time"
+
 	"github.com/LagrangeDev/LagrangeGo/client"
 	"github.com/LagrangeDev/LagrangeGo/client/auth"
 	"llma.dev/bot"
@@ -70,7 +72,14 @@ func (c *Container) Initialize() error {
 	c.bot.GetAuthManager().LoadSig()
 
 	// 创建逻辑管理器
-	c.logicManager = logic.NewLogicManager(c.client)
+	busConfig := c.config.EventBus
+	eventBus := logic.NewEventBusWithOptions(logic.EventBusOptions{
+		Workers:     busConfig.Workers,
+		QueueSize:   busConfig.QueueSize,
+		Timeout:     time.Duration(busConfig.TimeoutSeconds) * time.Second,
+		PublishWait: time.Duration(busConfig.PublishWaitSeconds) * time.Second,
+	})
+	c.logicManager = logic.NewLogicManager(c.client, logic.WithEventBus(eventBus))
 
 	// 初始化web 不安全，默认不启用
 	// go web.Init(c.bot)
@@ -8,9 +8,23 @@ import (
 )
 
 type Config struct {
-	Bot   BotConfig   `toml:"bot"`
-	Log   LogConfig   `toml:"log"`
-	Other OtherConfig `toml:"other"`
+	Bot           BotConfig           `toml:"bot"`
+	Log           LogConfig           `toml:"log"`
+	Other         OtherConfig         `toml:"other"`
+	Archive       ArchiveConfig       `toml:"archive"`
+	Stats         StatsConfig         `toml:"stats"`
+	Moderation    ModerationConfig    `toml:"moderation"`
+	Flood         FloodConfig         `toml:"flood"`
+	Queue         QueueConfig         `toml:"queue"`
+	Role          RoleConfig          `toml:"role"`
+	Conversation  ConversationConfig  `toml:"conversation"`
+	ErrorReply    ErrorReplyConfig    `toml:"errorReply"`
+	RateLimit     RateLimitConfig     `toml:"rateLimit"`
+	EventBus      EventBusConfig      `toml:"eventBus"`
+	Commands      []CommandConfig     `toml:"command"`
+	Schedules     []ScheduleConfig    `toml:"schedule"`
+	Relays        []RelayConfig       `toml:"relay"`
+	GroupPolicies []GroupPolicyConfig `toml:"groupPolicy"`
 }
 
 // BotConfig 代表TOML文件中的bot部分
@@ -28,12 +42,166 @@ type LogConfig struct {
 	Format     string `toml:"format"`     // 输出格式: text, json
 }
 type OtherConfig struct {
-	QrCodePath    string   `toml:"qrCodePath"`
-	GinPort       uint     `toml:"ginPort"`
-	AllowedIPs    []string `toml:"allowedIPs"`
-	AllowedUIDs   []uint32 `toml:"allowedUIDs"`
-	AllowedGroups []uint32 `toml:"allowedGroups"`
-	BindGroups    []uint32 `toml:"bindGroups"`
+	QrCodePath string   `toml:"qrCodePath"`
+	GinPort    uint     `toml:"ginPort"`
+	AllowedIPs []string `toml:"allowedIPs"`
+	// mod 请求的访问令牌，配置后请求需携带 Authorization: Bearer <token> 才能执行游戏内命令与绑定验证
+	ModToken string `toml:"modToken"`
+	// 旧版管理员配置，视为 admin 角色
+	AllowedUIDs []uint32 `toml:"allowedUIDs"`
+	// 允许使用 /lua 远程控制台的QQ号，为空时禁用
+	AllowedLuaUIDs []uint32 `toml:"allowedLuaUIDs"`
+	AllowedGroups  []uint32 `toml:"allowedGroups"`
+	BindGroups     []uint32 `toml:"bindGroups"`
+	// 命令前缀，可配置多个，为空时使用 /
+	CommandPrefixes []string `toml:"commandPrefixes"`
+	// 游戏内命令前缀，为空时禁用游戏内命令
+	GameCommandPrefix string `toml:"gameCommandPrefix"`
+}
+
+// ArchiveConfig 聊天记录存档配置
+type ArchiveConfig struct {
+	Enable        bool   `toml:"enable"`        // 是否启用聊天记录存档
+	Path          string `toml:"path"`          // 数据库文件路径
+	RetentionDays int    `toml:"retentionDays"` // 保留天数，0 为永久保留
+	Token         string `toml:"token"`         // /archive/search 接口的访问令牌，未配置 allowedIPs 时必须配置
+}
+
+// StatsConfig 玩家统计配置
+type StatsConfig struct {
+	Enable        bool   `toml:"enable"`        // 是否启用玩家统计
+	WeeklySummary string `toml:"weeklySummary"` // 每周汇总发送时间的 cron 表达式，为空时不发送
+}
+
+// EventBusConfig 事件总线配置
+type EventBusConfig struct {
+	Workers            int `toml:"workers"`            // 处理事件的工作协程数
+	QueueSize          int `toml:"queueSize"`          // 每个工作协程的队列长度，队列满时发布事件会等待
+	TimeoutSeconds     int `toml:"timeoutSeconds"`     // 事件处理器的默认超时(秒)
+	PublishWaitSeconds int `toml:"publishWaitSeconds"` // 队列满时发布事件最多等待的时间(秒)，超时后丢弃事件
+}
+
+// ConversationConfig 确认操作与多步对话配置
+type ConversationConfig struct {
+	ConfirmWords   []string `toml:"confirmWords"`   // 确认关键词，不区分大小写
+	CancelWords    []string `toml:"cancelWords"`    // 取消关键词，不区分大小写
+	TimeoutSeconds int      `toml:"timeoutSeconds"` // 等待回复的默认超时(秒)
+}
+
+// ErrorReplyConfig 命令出错时的回复配置
+type ErrorReplyConfig struct {
+	QuoteInGroup    bool              `toml:"quoteInGroup"`    // 群聊中是否引用触发错误的消息
+	ThrottleSeconds int               `toml:"throttleSeconds"` // 同一用户两次错误回复的最小间隔(秒)，0为不限制
+	Templates       map[string]string `toml:"templates"`       // 按错误类型配置的回复模板，错误类型 -> 模板
+	Internal        string            `toml:"internal"`        // 内部错误的回复模板，为空时只记录日志
+}
+
+// RateLimitConfig 命令限流配置
+type RateLimitConfig struct {
+	IdleSeconds int                               `toml:"idleSeconds"` // 空闲超过该时间的限流记录会被清理(秒)
+	Commands    map[string]CommandRateLimitConfig `toml:"commands"`    // 按命令配置的冷却，子命令为 "命令 子命令"
+}
+
+// CommandRateLimitConfig 单个命令的冷却配置
+type CommandRateLimitConfig struct {
+	Scope           string `toml:"scope"`           // 限流范围 user 每个用户, group 每个群, global 所有人共用
+	Burst           int    `toml:"burst"`           // 最多连续使用次数，为0时为1
+	IntervalSeconds int    `toml:"intervalSeconds"` // 每隔多少秒恢复一次使用次数
+}
+
+// RoleConfig 角色权限配置
+type RoleConfig struct {
+	Owners         []uint32           `toml:"owners"`         // 所有者QQ号
+	GroupOwnerRole string             `toml:"groupOwnerRole"` // QQ群主自动映射的角色，为空时不映射
+	GroupAdminRole string             `toml:"groupAdminRole"` // QQ群管理员自动映射的角色，为空时不映射
+	Commands       map[string]string  `toml:"commands"`       // 覆盖命令所需的角色，命令名称 -> 角色
+	Assignments    []RoleAssignConfig `toml:"assign"`         // 角色分配
+}
+
+// RoleAssignConfig 角色分配，代表TOML文件中的[[role.assign]]部分
+type RoleAssignConfig struct {
+	QQ      uint32 `toml:"qq"`      // QQ号
+	Role    string `toml:"role"`    // 角色: member, operator, admin, owner
+	Cluster string `toml:"cluster"` // 生效的集群，为空时全局生效
+}
+
+// QueueConfig 发往mod的消息队列配置
+type QueueConfig struct {
+	MaxSize      int    `toml:"maxSize"`      // 聊天消息队列最大长度，命令不受限制
+	Overflow     string `toml:"overflow"`     // 溢出策略: drop-oldest, drop-newest, merge
+	NotifySender bool   `toml:"notifySender"` // 消息被丢弃时是否在群内通知发送者
+}
+
+// FloodConfig 游戏聊天刷屏保护配置
+type FloodConfig struct {
+	Enable        bool `toml:"enable"`        // 是否启用刷屏保护
+	Burst         int  `toml:"burst"`         // 每个时间窗口内允许转发的消息数
+	WindowSeconds int  `toml:"windowSeconds"` // 时间窗口长度(秒)
+	MuteAfter     int  `toml:"muteAfter"`     // 连续刷屏多少次后自动禁言，0 为不禁言
+	MuteSeconds   int  `toml:"muteSeconds"`   // 自动禁言时长(秒)
+}
+
+// ModerationConfig 消息审核配置
+type ModerationConfig struct {
+	Enable      bool                   `toml:"enable"`      // 是否启用消息审核
+	KickStrikes int                    `toml:"kickStrikes"` // 违规多少次自动踢出，0 为不踢出
+	BanStrikes  int                    `toml:"banStrikes"`  // 违规多少次自动封禁，0 为不封禁
+	BanDuration string                 `toml:"banDuration"` // 自动封禁时长，如 1d、12h 或 1d12h，为空时永久封禁
+	Rules       []ModerationRuleConfig `toml:"rule"`        // 审核规则
+}
+
+// ModerationRuleConfig 审核规则
+type ModerationRuleConfig struct {
+	Words     []string `toml:"words"`     // 违禁词，不区分大小写
+	Regex     []string `toml:"regex"`     // 正则表达式
+	Action    string   `toml:"action"`    // 动作: mask 替换为*, drop 丢弃, warn 丢弃并通知管理员
+	Direction string   `toml:"direction"` // 生效方向: both, to_dst, to_qq
+}
+
+// CommandConfig 自定义mod命令，代表TOML文件中的[[command]]部分
+type CommandConfig struct {
+	Name        string             `toml:"name"`        // 命令名称，不含前缀
+	Aliases     []string           `toml:"aliases"`     // 命令别名
+	Description string             `toml:"description"` // 帮助中显示的说明
+	Args        []CommandArgConfig `toml:"args"`        // 参数列表，按顺序匹配
+	Permission  string             `toml:"permission"`  // 所需角色: all, operator, admin, owner
+	Confirm     bool               `toml:"confirm"`     // 执行前是否需要确认
+	Head        string             `toml:"head"`        // 下发给mod的命令种类
+	Content     string             `toml:"content"`     // 命令正文模板，使用 {{.参数名}} 引用参数
+}
+
+// CommandArgConfig 自定义命令的参数
+type CommandArgConfig struct {
+	Name     string `toml:"name"`     // 参数名称
+	Type     string `toml:"type"`     // 参数类型: string, int, kleiid, text(剩余全部文本)
+	Required bool   `toml:"required"` // 是否必填
+}
+
+// ScheduleConfig 计划任务，代表TOML文件中的[[schedule]]部分
+type ScheduleConfig struct {
+	Name     string `toml:"name"`     // 任务名称
+	Cron     string `toml:"cron"`     // cron 表达式: 分 时 日 月 周
+	Action   string `toml:"action"`   // 动作: save, announce, restart, message
+	Content  string `toml:"content"`  // 公告或群消息内容
+	Warnings []int  `toml:"warnings"` // 执行前多少分钟提醒，群消息在绑定群聊中提醒，其余动作在游戏内提醒
+	Cluster  string `toml:"cluster"`  // 执行动作的集群，为空时为 default 集群
+}
+
+// RelayConfig 转发拓扑，代表TOML文件中的[[relay]]部分
+type RelayConfig struct {
+	From          string `toml:"from"`          // 来源端点: group:群号 或 server:集群名
+	To            string `toml:"to"`            // 目标端点: group:群号 或 server:集群名
+	Bidirectional bool   `toml:"bidirectional"` // 是否双向转发
+}
+
+// GroupPolicyConfig 群聊转发策略，代表TOML文件中的[[groupPolicy]]部分
+type GroupPolicyConfig struct {
+	Group         uint32   `toml:"group"`         // 群号
+	Direction     string   `toml:"direction"`     // 转发方向: both, to_dst, to_qq, none
+	TriggerPrefix string   `toml:"triggerPrefix"` // 只转发以此前缀开头的消息到游戏，为空时转发全部
+	MinLevel      uint32   `toml:"minLevel"`      // 转发到游戏所需的最低群等级
+	IgnoredUsers  []uint32 `toml:"ignoredUsers"`  // 不转发到游戏的QQ号
+	Events        []string `toml:"events"`        // 转发到群聊的游戏事件: join, leave, death, announce，为空时全部转发
 }
 
 // 配置文件名
@@ -101,15 +269,79 @@ func DefaultConfig() Config {
 			"192.168.1.100",
 			"10.0.0.1",
 		},
-		AllowedUIDs:   []uint32{},
-		AllowedGroups: []uint32{},
-		BindGroups:    []uint32{},
+		AllowedUIDs:       []uint32{},
+		AllowedLuaUIDs:    []uint32{},
+		AllowedGroups:     []uint32{},
+		BindGroups:        []uint32{},
+		CommandPrefixes:   []string{"/"},
+		GameCommandPrefix: "!",
+	}
+
+	archive := ArchiveConfig{
+		Enable:        true,
+		Path:          "data/archive.db",
+		RetentionDays: 30,
+	}
+
+	stats := StatsConfig{
+		Enable:        true,
+		WeeklySummary: "0 20 * * 0",
+	}
+
+	flood := FloodConfig{
+		Enable:        true,
+		Burst:         5,
+		WindowSeconds: 10,
+		MuteAfter:     0,
+		MuteSeconds:   300,
+	}
+
+	queue := QueueConfig{
+		MaxSize:  5,
+		Overflow: "drop-oldest",
+	}
+
+	role := RoleConfig{
+		Owners:         []uint32{},
+		GroupOwnerRole: "admin",
+		GroupAdminRole: "operator",
+	}
+
+	conversation := ConversationConfig{
+		ConfirmWords:   []string{"确认"},
+		CancelWords:    []string{"取消"},
+		TimeoutSeconds: 30,
+	}
+
+	errorReply := ErrorReplyConfig{
+		QuoteInGroup:    true,
+		ThrottleSeconds: 10,
+	}
+
+	rateLimit := RateLimitConfig{
+		IdleSeconds: 600,
+	}
+
+	eventBus := EventBusConfig{
+		Workers:            4,
+		QueueSize:          256,
+		TimeoutSeconds:     30,
+		PublishWaitSeconds: 1,
 	}
 
 	return Config{
-		Bot:   bot,
-		Log:   log,
-		Other: other,
+		Bot:          bot,
+		Log:          log,
+		Other:        other,
+		Archive:      archive,
+		Stats:        stats,
+		Flood:        flood,
+		Queue:        queue,
+		Role:         role,
+		Conversation: conversation,
+		ErrorReply:   errorReply,
+		RateLimit:    rateLimit,
+		EventBus:     eventBus,
 	}
 }
 
@@ -8,8 +8,10 @@ require (
 	github.com/BurntSushi/toml v1.5.0
 	github.com/LagrangeDev/LagrangeGo v0.1.4
 	github.com/mdp/qrterminal/v3 v3.2.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/sirupsen/logrus v1.9.3
 	github.com/tuotoo/qrcode v0.0.0-20220425170535-52ccc2bebf5d
+	go.etcd.io/bbolt v1.4.0
 	rsc.io/qr v0.2.0
 )
 
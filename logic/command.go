@@ -0,0 +1,617 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/utils/llog"
+)
+
+// ArgType 命令参数类型
+type ArgType string
+
+const (
+	ArgString ArgType = "string" // 单个词
+	ArgInt    ArgType = "int"    // 整数
+	ArgUin    ArgType = "uin"    // QQ号
+	ArgText   ArgType = "text"   // 剩余全部文本，只能作为最后一个参数
+)
+
+// Arg 命令参数定义
+type Arg struct {
+	// Name 参数名称，用于用法与取值
+	Name string
+	// Type 参数类型，为空时为 string
+	Type ArgType
+	// Required 是否必填，可选参数解析失败时会留给后面的参数
+	Required bool
+	// Description 参数说明
+	Description string
+	// Choices 可选值，为空时不限制
+	Choices []string
+	// Min Max 整数参数的取值范围，均为 0 时不限制
+	Min, Max int
+	// Parse 自定义解析函数，不为空时代替类型解析
+	Parse func(raw string) (any, error)
+}
+
+// parse 解析参数值
+func (a *Arg) parse(raw string) (any, error) {
+	if a.Parse != nil {
+		return a.Parse(raw)
+	}
+	if len(a.Choices) > 0 && !slices.Contains(a.Choices, raw) {
+		return nil, fmt.Errorf("可选值为 %s", strings.Join(a.Choices, "、"))
+	}
+	switch a.Type {
+	case ArgInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("必须是整数")
+		}
+		if (a.Min != 0 || a.Max != 0) && (n < a.Min || n > a.Max) {
+			return nil, fmt.Errorf("取值范围为 %d-%d", a.Min, a.Max)
+		}
+		return n, nil
+	case ArgUin:
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("必须是有效的QQ号")
+		}
+		return uint32(n), nil
+	default:
+		return raw, nil
+	}
+}
+
+// usage 参数在用法中的写法
+func (a *Arg) usage() string {
+	name := a.Name
+	if len(a.Choices) > 0 {
+		name = strings.Join(a.Choices, "|")
+	}
+	if a.Required {
+		return "<" + name + ">"
+	}
+	return "[" + name + "]"
+}
+
+// Args 解析后的命令参数
+type Args map[string]any
+
+// Has 参数是否存在
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// Get 获取参数值
+func (a Args) Get(name string) any {
+	return a[name]
+}
+
+// String 获取字符串参数，不存在时返回空字符串
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int 获取整数参数，不存在时返回 0
+func (a Args) Int(name string) int {
+	n, _ := a[name].(int)
+	return n
+}
+
+// Uin 获取QQ号参数，不存在时返回 0
+func (a Args) Uin(name string) uint32 {
+	n, _ := a[name].(uint32)
+	return n
+}
+
+// UsageError 命令用法错误，会连同命令用法回复给用户
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// NewUsageError 创建用法错误
+func NewUsageError(format string, args ...any) *UsageError {
+	return &UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// CommandHandler 命令处理器接口
+type CommandHandler interface {
+	Handle(ctx *MessageContext, args Args) error
+}
+
+// CommandHandlerFunc 命令处理器函数
+type CommandHandlerFunc func(ctx *MessageContext, args Args) error
+
+// Handle 实现CommandHandler接口
+func (f CommandHandlerFunc) Handle(ctx *MessageContext, args Args) error {
+	return f(ctx, args)
+}
+
+// Command 声明式命令
+type Command struct {
+	// Name 命令名称
+	Name string
+	// Aliases 命令别名
+	Aliases []string
+	// Prefixes 命令前缀，为空时使用管理器的默认前缀
+	Prefixes []string
+	// Sources 可使用命令的消息类型，如 private group external，为空时为私聊与群聊
+	Sources []string
+	// Description 命令说明
+	Description string
+	// Args 参数定义
+	Args []Arg
+	// Permission 所需权限，为空时所有人可用
+	Permission string
+	// Hidden 是否在帮助列表中隐藏
+	Hidden bool
+	// Middlewares 命令专属中间件
+	Middlewares []Middleware
+	// Subcommands 子命令，第一个参数匹配子命令名称时交由子命令处理
+	Subcommands []*Command
+	// Handler 命令处理器，存在子命令时可为空
+	Handler CommandHandler
+	// Cooldown 命令冷却，为空时不限制，子命令单独计算
+	Cooldown *Cooldown
+
+	parent  *Command
+	limiter *RateLimiter
+}
+
+// names 命令名称与别名
+func (c *Command) names() []string {
+	return append([]string{c.Name}, c.Aliases...)
+}
+
+// path 带父命令的完整名称
+func (c *Command) path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.path() + " " + c.Name
+}
+
+// Usage 命令用法，prefix 为展示使用的前缀
+func (c *Command) Usage(prefix string) string {
+	parts := []string{prefix + c.path()}
+	for i := range c.Args {
+		parts = append(parts, c.Args[i].usage())
+	}
+	return strings.Join(parts, " ")
+}
+
+// usages 命令及全部子命令的用法
+func (c *Command) usages(prefix string) []string {
+	var lines []string
+	if c.Handler != nil {
+		lines = append(lines, c.Usage(prefix))
+	}
+	for _, sub := range c.Subcommands {
+		lines = append(lines, sub.usages(prefix)...)
+	}
+	return lines
+}
+
+// validate 校验命令定义
+func (c *Command) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("命令名称不能为空")
+	}
+	if c.Handler == nil && len(c.Subcommands) == 0 {
+		return fmt.Errorf("命令 %s 未设置处理器", c.path())
+	}
+	for i, arg := range c.Args {
+		if arg.Name == "" {
+			return fmt.Errorf("命令 %s 的第 %d 个参数名称为空", c.path(), i+1)
+		}
+		if arg.Type == ArgText && i != len(c.Args)-1 {
+			return fmt.Errorf("命令 %s 的 text 参数 %s 只能作为最后一个参数", c.path(), arg.Name)
+		}
+	}
+	for _, sub := range c.Subcommands {
+		sub.parent = c
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve 根据参数文本找到实际执行的子命令
+func (c *Command) resolve(text string) (*Command, string) {
+	field, rest := cutField(text)
+	for _, sub := range c.Subcommands {
+		if slices.Contains(sub.names(), field) {
+			return sub.resolve(rest)
+		}
+	}
+	return c, text
+}
+
+// parseArgs 按参数定义解析参数文本
+func (c *Command) parseArgs(text string) (Args, error) {
+	args := make(Args, len(c.Args))
+	rest := strings.TrimSpace(text)
+	for i := range c.Args {
+		arg := &c.Args[i]
+		if arg.Type == ArgText {
+			if rest == "" {
+				if arg.Required {
+					return nil, NewUsageError("缺少参数 %s", arg.Name)
+				}
+				continue
+			}
+			value, err := arg.parse(rest)
+			if err != nil {
+				return nil, NewUsageError("参数 %s 无效: %s", arg.Name, err.Error())
+			}
+			args[arg.Name] = value
+			rest = ""
+			continue
+		}
+
+		field, remaining := cutField(rest)
+		if field == "" {
+			if arg.Required {
+				return nil, NewUsageError("缺少参数 %s", arg.Name)
+			}
+			continue
+		}
+		value, err := arg.parse(field)
+		if err != nil {
+			// 可选参数解析失败时留给后面的参数
+			if !arg.Required && i < len(c.Args)-1 {
+				continue
+			}
+			return nil, NewUsageError("参数 %s 无效: %s", arg.Name, err.Error())
+		}
+		args[arg.Name] = value
+		rest = remaining
+	}
+	if rest != "" {
+		return nil, NewUsageError("多余的参数 %s", rest)
+	}
+	return args, nil
+}
+
+// cutField 取出文本中的第一个词与剩余文本
+func cutField(text string) (string, string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimLeftFunc(text[i:], unicode.IsSpace)
+}
+
+// commandMatcher 命令匹配器，支持多个前缀与别名，匹配后将参数文本保存到上下文
+type commandMatcher struct {
+	command *Command
+	lm      *LogicManager
+}
+
+func (m *commandMatcher) Match(ctx *MessageContext) bool {
+	text := strings.TrimSpace(ctx.GetMessageText())
+	for _, prefix := range m.lm.prefixesOf(m.command) {
+		rest, ok := strings.CutPrefix(text, prefix)
+		if !ok {
+			continue
+		}
+		name, argsText := cutField(rest)
+		if !slices.Contains(m.command.names(), name) {
+			continue
+		}
+		ctx.Set("command", m.command.Name)
+		ctx.Set("command_prefix", prefix)
+		ctx.Set("args", strings.Fields(argsText))
+		ctx.Set("args_text", argsText)
+		return true
+	}
+	return false
+}
+
+// commandRegistry 已注册的声明式命令与权限
+type commandRegistry struct {
+	mu          sync.RWMutex
+	prefixes    []string
+	commands    []*Command
+	permissions map[string]permission
+	// rateLimitIdle 命令冷却记录的空闲清理时间
+	rateLimitIdle time.Duration
+}
+
+// permission 权限定义
+type permission struct {
+	description string
+	middleware  Middleware
+}
+
+// SetCommandPrefixes 设置命令的默认前缀，至少需要一个前缀，空字符串表示不需要前缀
+func (lm *LogicManager) SetCommandPrefixes(prefixes ...string) error {
+	if len(prefixes) == 0 {
+		return fmt.Errorf("命令前缀不能为空")
+	}
+	lm.registry.mu.Lock()
+	defer lm.registry.mu.Unlock()
+	lm.registry.prefixes = slices.Clone(prefixes)
+	return nil
+}
+
+// SetRateLimitIdle 设置命令冷却记录的空闲清理时间，只影响之后注册的命令
+func (lm *LogicManager) SetRateLimitIdle(idle time.Duration) {
+	lm.registry.mu.Lock()
+	defer lm.registry.mu.Unlock()
+	lm.registry.rateLimitIdle = idle
+}
+
+// attachLimiters 为设置了冷却的命令及子命令创建限流器
+func (lm *LogicManager) attachLimiters(c *Command) {
+	lm.registry.mu.RLock()
+	idle := lm.registry.rateLimitIdle
+	lm.registry.mu.RUnlock()
+	if c.Cooldown != nil {
+		c.limiter = NewRateLimiter(c.Cooldown.RateLimit, idle)
+	}
+	for _, sub := range c.Subcommands {
+		lm.attachLimiters(sub)
+	}
+}
+
+// RegisterPermission 注册权限，要求该权限的命令执行前会经过对应的中间件
+func (lm *LogicManager) RegisterPermission(name string, description string, middleware Middleware) {
+	lm.registry.mu.Lock()
+	defer lm.registry.mu.Unlock()
+	lm.registry.permissions[name] = permission{description: description, middleware: middleware}
+}
+
+// primaryPrefix 帮助中展示的前缀，即命令使用的第一个前缀
+func (lm *LogicManager) primaryPrefix(c *Command) string {
+	if prefixes := lm.prefixesOf(c); len(prefixes) > 0 {
+		return prefixes[0]
+	}
+	return ""
+}
+
+// prefixesOf 命令使用的前缀
+func (lm *LogicManager) prefixesOf(c *Command) []string {
+	if len(c.Prefixes) > 0 {
+		return c.Prefixes
+	}
+	lm.registry.mu.RLock()
+	defer lm.registry.mu.RUnlock()
+	return lm.registry.prefixes
+}
+
+// permissionMiddleware 执行时按权限名称查找中间件，未注册的权限拒绝所有人
+func (lm *LogicManager) permissionMiddleware(name string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *MessageContext) error {
+			lm.registry.mu.RLock()
+			p, ok := lm.registry.permissions[name]
+			lm.registry.mu.RUnlock()
+			if !ok {
+				llog.Errorf("[lagrange.命令] 权限 %s 未注册", name)
+				return NewUserError(ErrorKindPermission, "无权限访问")
+			}
+			return p.middleware(next)(ctx)
+		}
+	}
+}
+
+// RegisterCommand 注册声明式命令
+func (lm *LogicManager) RegisterCommand(c *Command) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	lm.attachLimiters(c)
+
+	route := NewRoute("command_"+c.Name, NewHandlerAdapter(func(ctx *MessageContext) error {
+		return lm.executeCommand(ctx, c)
+	}))
+	route.SetPriority(PriorityCommand).SetTerminal(true)
+
+	sources := c.Sources
+	if len(sources) == 0 {
+		sources = []string{"private", "group"}
+	}
+	sourceMatchers := make([]Matcher, 0, len(sources))
+	for _, source := range sources {
+		sourceMatchers = append(sourceMatchers, NewMessageTypeMatcher(source))
+	}
+	route.Match(NewOrMatcher(sourceMatchers...))
+	route.Match(&commandMatcher{command: c, lm: lm})
+
+	if c.Permission != "" {
+		route.Use(lm.permissionMiddleware(c.Permission))
+	}
+	for _, middleware := range c.Middlewares {
+		route.Use(middleware)
+	}
+	lm.AddRoute(route)
+
+	lm.registry.mu.Lock()
+	lm.registry.commands = append(lm.registry.commands, c)
+	lm.registry.mu.Unlock()
+	return nil
+}
+
+// executeCommand 解析参数并执行命令，用法错误时回复用法
+func (lm *LogicManager) executeCommand(ctx *MessageContext, c *Command) error {
+	prefix := ctx.GetString("command_prefix")
+	target, text := c.resolve(ctx.GetString("args_text"))
+
+	// 子命令可以要求比父命令更高的权限
+	if target != c && target.Permission != "" && target.Permission != c.Permission {
+		return lm.permissionMiddleware(target.Permission)(func(ctx *MessageContext) error {
+			return lm.runCommand(ctx, target, prefix, text)
+		})(ctx)
+	}
+	return lm.runCommand(ctx, target, prefix, text)
+}
+
+// runCommand 执行已确定的命令
+func (lm *LogicManager) runCommand(ctx *MessageContext, c *Command, prefix string, text string) error {
+	if c.Handler == nil {
+		ctx.Reply(textElements(fmt.Sprintf("用法:\n%s", strings.Join(c.usages(prefix), "\n"))))
+		return nil
+	}
+	args, err := c.parseArgs(text)
+	if err == nil {
+		err = c.checkCooldown(ctx)
+	}
+	if err == nil {
+		err = c.Handler.Handle(ctx, args)
+		if err == nil {
+			publishCommandExecuted(ctx, c.path(), args)
+		}
+	}
+	if usageErr, ok := err.(*UsageError); ok {
+		ctx.Reply(textElements(fmt.Sprintf("%s\n用法: %s", usageErr.Message, c.Usage(prefix))))
+		return nil
+	}
+	return err
+}
+
+// checkCooldown 检查命令冷却，冷却中时返回剩余时间提示
+func (c *Command) checkCooldown(ctx *MessageContext) error {
+	if c.limiter == nil {
+		return nil
+	}
+	key, ok := RateLimitKey(ctx, c.Cooldown.Scope)
+	if !ok {
+		return nil
+	}
+	if allowed, wait := c.limiter.Allow(key); !allowed {
+		llog.Debugf("[lagrange.命令] %s 的命令 %s 冷却中", key, c.path())
+		return cooldownError(wait)
+	}
+	return nil
+}
+
+// MatchesCommand 消息是否匹配该消息类型下可用的声明式命令，不执行命令
+func (lm *LogicManager) MatchesCommand(msg any) bool {
+	ctx := NewMessageContext(lm.client, msg)
+	for _, c := range lm.visibleCommands(ctx) {
+		matcher := &commandMatcher{command: c, lm: lm}
+		if matcher.Match(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleCommands 在该消息类型下可用的命令
+func (lm *LogicManager) visibleCommands(ctx *MessageContext) []*Command {
+	msgType := getMessageType(ctx.Message)
+	lm.registry.mu.RLock()
+	defer lm.registry.mu.RUnlock()
+	var commands []*Command
+	for _, c := range lm.registry.commands {
+		sources := c.Sources
+		if len(sources) == 0 {
+			sources = []string{"private", "group"}
+		}
+		if slices.Contains(sources, msgType) {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+// Help 生成帮助文本，name 为空时列出全部命令，否则显示该命令的详细用法
+func (lm *LogicManager) Help(ctx *MessageContext, name string) (string, bool) {
+	commands := lm.visibleCommands(ctx)
+	if name == "" {
+		var sb strings.Builder
+		sb.WriteString("可用命令:")
+		for _, c := range commands {
+			if c.Hidden {
+				continue
+			}
+			prefix := lm.primaryPrefix(c)
+			if len(c.Subcommands) == 0 {
+				sb.WriteString("\n" + c.Usage(prefix))
+			} else {
+				names := make([]string, 0, len(c.Subcommands))
+				for _, sub := range c.Subcommands {
+					names = append(names, sub.Name)
+				}
+				sb.WriteString(fmt.Sprintf("\n%s%s [%s]", prefix, c.Name, strings.Join(names, "|")))
+			}
+			if c.Description != "" {
+				sb.WriteString(" - " + c.Description)
+			}
+		}
+		return sb.String(), true
+	}
+
+	for _, c := range commands {
+		for _, prefix := range append([]string{""}, lm.prefixesOf(c)...) {
+			if trimmed, ok := strings.CutPrefix(name, prefix); ok && slices.Contains(c.names(), trimmed) {
+				return lm.commandHelp(c), true
+			}
+		}
+	}
+	return "", false
+}
+
+// commandHelp 单个命令的详细帮助
+func (lm *LogicManager) commandHelp(c *Command) string {
+	prefix := lm.primaryPrefix(c)
+	lines := []string{strings.Join(c.usages(prefix), "\n")}
+	if c.Description != "" {
+		lines = append(lines, c.Description)
+	}
+	if len(c.Aliases) > 0 {
+		lines = append(lines, "别名: "+strings.Join(c.Aliases, "、"))
+	}
+	if c.Permission != "" {
+		lm.registry.mu.RLock()
+		p, ok := lm.registry.permissions[c.Permission]
+		lm.registry.mu.RUnlock()
+		description := c.Permission
+		if ok && p.description != "" {
+			description = p.description
+		}
+		lines = append(lines, "权限: "+description)
+	}
+	var argLines []string
+	var collect func(cmd *Command)
+	collect = func(cmd *Command) {
+		for _, arg := range cmd.Args {
+			if arg.Description != "" {
+				argLines = append(argLines, fmt.Sprintf("  %s: %s", arg.Name, arg.Description))
+			}
+		}
+		for _, sub := range cmd.Subcommands {
+			if sub.Description != "" {
+				argLines = append(argLines, fmt.Sprintf("  %s: %s", sub.Name, sub.Description))
+			}
+			collect(sub)
+		}
+	}
+	collect(c)
+	if len(argLines) > 0 {
+		lines = append(lines, "说明:")
+		lines = append(lines, argLines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func textElements(text string) []message.IMessageElement {
+	return []message.IMessageElement{message.NewText(text)}
+}
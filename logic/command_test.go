@@ -0,0 +1,194 @@
+package logic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+)
+
+func TestCutField(t *testing.T) {
+	tests := []struct {
+		in, field, rest string
+	}{
+		{"", "", ""},
+		{"ban", "ban", ""},
+		{"ban 123 10m", "ban", "123 10m"},
+		{"  ban\t 123  ", "ban", "123  "},
+		{"添加 定时存档\n*/30 * * * * save", "添加", "定时存档\n*/30 * * * * save"},
+	}
+	for _, tt := range tests {
+		field, rest := cutField(tt.in)
+		if field != tt.field || rest != tt.rest {
+			t.Errorf("cutField(%q) = (%q, %q), want (%q, %q)", tt.in, field, rest, tt.field, tt.rest)
+		}
+	}
+}
+
+func TestArgParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     Arg
+		raw     string
+		want    any
+		wantErr bool
+	}{
+		{"字符串", Arg{Name: "a"}, "abc", "abc", false},
+		{"整数", Arg{Name: "a", Type: ArgInt}, "42", 42, false},
+		{"非整数", Arg{Name: "a", Type: ArgInt}, "4x", nil, true},
+		{"整数范围内", Arg{Name: "a", Type: ArgInt, Min: 1, Max: 10}, "10", 10, false},
+		{"整数超出范围", Arg{Name: "a", Type: ArgInt, Min: 1, Max: 10}, "11", nil, true},
+		{"QQ号", Arg{Name: "a", Type: ArgUin}, "10001", uint32(10001), false},
+		{"QQ号溢出", Arg{Name: "a", Type: ArgUin}, "4294967296", nil, true},
+		{"可选值", Arg{Name: "a", Choices: []string{"on", "off"}}, "on", "on", false},
+		{"不在可选值中", Arg{Name: "a", Choices: []string{"on", "off"}}, "maybe", nil, true},
+		{"自定义解析", Arg{Name: "a", Parse: func(raw string) (any, error) { return len(raw), nil }}, "abc", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.arg.parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse(%q) err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("parse(%q) = %#v, want %#v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	ban := &Command{Name: "ban", Args: []Arg{
+		{Name: "qq", Type: ArgUin, Required: true},
+		{Name: "分钟", Type: ArgInt},
+		{Name: "原因", Type: ArgText},
+	}}
+	say := &Command{Name: "say", Args: []Arg{
+		{Name: "内容", Type: ArgText, Required: true},
+	}}
+	list := &Command{Name: "list", Args: []Arg{
+		{Name: "页码", Type: ArgInt},
+	}}
+
+	tests := []struct {
+		name    string
+		command *Command
+		text    string
+		want    Args
+		wantErr string
+	}{
+		{"全部参数", ban, "123 10 刷屏 广告", Args{"qq": uint32(123), "分钟": 10, "原因": "刷屏 广告"}, ""},
+		{"可选参数解析失败时留给后面的参数", ban, "123 刷屏", Args{"qq": uint32(123), "原因": "刷屏"}, ""},
+		{"省略可选参数", ban, "123", Args{"qq": uint32(123)}, ""},
+		{"缺少必填参数", ban, "", nil, "缺少参数 qq"},
+		{"必填参数无效", ban, "abc", nil, "参数 qq 无效: 必须是有效的QQ号"},
+		{"文本参数保留空白", say, "  hello   world ", Args{"内容": "hello   world"}, ""},
+		{"缺少文本参数", say, "   ", nil, "缺少参数 内容"},
+		{"最后一个可选参数无效", list, "abc", nil, "参数 页码 无效: 必须是整数"},
+		{"多余的参数", list, "1 2", nil, "多余的参数 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.command.parseArgs(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseArgs(%q) err = %v, want %q", tt.text, err, tt.wantErr)
+				}
+				if _, ok := err.(*UsageError); !ok {
+					t.Fatalf("parseArgs(%q) err 类型为 %T, want *UsageError", tt.text, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArgs(%q) err = %v", tt.text, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseArgs(%q) = %#v, want %#v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandResolve(t *testing.T) {
+	noop := CommandHandlerFunc(func(*MessageContext, Args) error { return nil })
+	remove := &Command{Name: "删除", Aliases: []string{"rm"}, Handler: noop}
+	schedule := &Command{
+		Name:    "计划",
+		Handler: noop,
+		Subcommands: []*Command{
+			{Name: "列表", Handler: noop},
+			remove,
+		},
+	}
+	if err := schedule.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text     string
+		want     *Command
+		wantRest string
+	}{
+		{"", schedule, ""},
+		{"删除 定时存档", remove, "定时存档"},
+		{"rm 定时存档", remove, "定时存档"},
+		{"列表", schedule.Subcommands[0], ""},
+		{"定时存档", schedule, "定时存档"},
+	}
+	for _, tt := range tests {
+		got, rest := schedule.resolve(tt.text)
+		if got != tt.want || rest != tt.wantRest {
+			t.Errorf("resolve(%q) = (%s, %q), want (%s, %q)", tt.text, got.path(), rest, tt.want.path(), tt.wantRest)
+		}
+	}
+	if got := remove.Usage("/"); got != "/计划 删除" {
+		t.Errorf("Usage = %q, want %q", got, "/计划 删除")
+	}
+}
+
+func TestCommandValidate(t *testing.T) {
+	noop := CommandHandlerFunc(func(*MessageContext, Args) error { return nil })
+	tests := []struct {
+		name    string
+		command *Command
+		wantErr bool
+	}{
+		{"有效", &Command{Name: "a", Handler: noop, Args: []Arg{{Name: "x"}, {Name: "y", Type: ArgText}}}, false},
+		{"名称为空", &Command{Handler: noop}, true},
+		{"没有处理器", &Command{Name: "a"}, true},
+		{"参数名称为空", &Command{Name: "a", Handler: noop, Args: []Arg{{}}}, true},
+		{"文本参数不在最后", &Command{Name: "a", Handler: noop, Args: []Arg{{Name: "x", Type: ArgText}, {Name: "y"}}}, true},
+		{"子命令无效", &Command{Name: "a", Subcommands: []*Command{{Name: "b"}}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.command.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHelpKeepsDefaultPrefix(t *testing.T) {
+	lm := NewLogicManager(nil)
+	noop := CommandHandlerFunc(func(*MessageContext, Args) error { return nil })
+	if err := lm.RegisterCommand(&Command{Name: "状态", Description: "查看状态", Handler: noop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lm.SetCommandPrefixes(); err == nil {
+		t.Error("SetCommandPrefixes() 没有前缀时应返回错误")
+	}
+
+	ctx := NewMessageContext(nil, &message.PrivateMessage{})
+	help, ok := lm.Help(ctx, "")
+	if !ok || !strings.Contains(help, "/状态 - 查看状态") {
+		t.Errorf("Help() = %q, 应使用原有的默认前缀", help)
+	}
+
+	if err := lm.SetCommandPrefixes("#", "/"); err != nil {
+		t.Fatal(err)
+	}
+	help, ok = lm.Help(ctx, "/状态")
+	if !ok || !strings.HasPrefix(help, "#状态") {
+		t.Errorf("Help(/状态) = %q, 应以第一个前缀展示用法", help)
+	}
+}
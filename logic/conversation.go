@@ -0,0 +1,343 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/utils/llog"
+)
+
+// ErrPromptPending 会话中已有等待回复的问题
+var ErrPromptPending = errors.New("当前会话已有等待回复的问题")
+
+// ErrNoSession 消息不属于可以等待回复的会话
+var ErrNoSession = errors.New("当前会话不支持等待回复")
+
+// SessionKey 会话标识，同一会话中同一发送者的消息视为对问题的回复
+type SessionKey struct {
+	Type   string // private, group, external:平台
+	ID     string // 私聊为QQ号，群聊为群号，外部来源为发送者标识
+	Sender string // 发送者标识
+}
+
+// SessionKeyOf 获取消息所属的会话
+func SessionKeyOf(ctx *MessageContext) (SessionKey, bool) {
+	if pm, ok := ctx.GetPrivateMessage(); ok {
+		uin := fmt.Sprint(pm.Sender.Uin)
+		return SessionKey{Type: string(PrivateMsg), ID: uin, Sender: uin}, true
+	}
+	if gm, ok := ctx.GetGroupMessage(); ok {
+		return SessionKey{Type: string(GroupMsg), ID: fmt.Sprint(gm.GroupUin), Sender: fmt.Sprint(gm.Sender.Uin)}, true
+	}
+	if ext, ok := ctx.GetExternalMessage(); ok {
+		return SessionKey{Type: "external:" + ext.Platform(), ID: ext.SenderID(), Sender: ext.SenderID()}, true
+	}
+	return SessionKey{}, false
+}
+
+// ReplyHandler 处理问题的回复，返回 false 表示该消息不是回复，消息继续交给路由处理且问题保持等待
+type ReplyHandler func(reply *MessageContext) bool
+
+// pendingPrompt 等待回复的问题
+type pendingPrompt struct {
+	question  string
+	deadline  time.Time
+	timer     *time.Timer
+	onReply   ReplyHandler
+	onTimeout func()
+}
+
+// Conversations 会话管理器，每个会话同时只能有一个等待回复的问题
+// 回复在路由之前被截获，不会再触发命令或转发
+type Conversations struct {
+	mu             sync.Mutex
+	pending        map[SessionKey]*pendingPrompt
+	confirmWords   []string
+	cancelWords    []string
+	defaultTimeout time.Duration
+}
+
+// NewConversations 创建会话管理器
+func NewConversations() *Conversations {
+	return &Conversations{
+		pending:        make(map[SessionKey]*pendingPrompt),
+		confirmWords:   []string{"确认"},
+		cancelWords:    []string{"取消"},
+		defaultTimeout: 30 * time.Second,
+	}
+}
+
+// SetKeywords 设置确认与取消关键词，为空时保持不变
+func (c *Conversations) SetKeywords(confirm []string, cancel []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(confirm) > 0 {
+		c.confirmWords = confirm
+	}
+	if len(cancel) > 0 {
+		c.cancelWords = cancel
+	}
+}
+
+// SetDefaultTimeout 设置未指定超时时间时使用的默认超时
+func (c *Conversations) SetDefaultTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultTimeout = timeout
+}
+
+// timeoutOr timeout 为0时返回默认超时
+func (c *Conversations) timeoutOr(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.defaultTimeout
+}
+
+// IsConfirm 文本是否为确认关键词
+func (c *Conversations) IsConfirm(text string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return containsWord(c.confirmWords, text)
+}
+
+// IsCancel 文本是否为取消关键词
+func (c *Conversations) IsCancel(text string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return containsWord(c.cancelWords, text)
+}
+
+// keywords 第一个确认与取消关键词，用于提示
+func (c *Conversations) keywords() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.confirmWords[0], c.cancelWords[0]
+}
+
+func containsWord(words []string, text string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	return slices.ContainsFunc(words, func(w string) bool {
+		return strings.ToLower(w) == text
+	})
+}
+
+// Pending 会话中等待回复的问题
+func (c *Conversations) Pending(key SessionKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[key]
+	if !ok {
+		return "", false
+	}
+	return p.question, true
+}
+
+// Await 在会话中等待回复，不阻塞调用者；收到回复或超时后调用对应回调
+// timeout 为0时使用默认超时，会话中已有等待的问题时返回 ErrPromptPending
+func (c *Conversations) Await(key SessionKey, question string, timeout time.Duration, onReply ReplyHandler, onTimeout func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[key]; ok {
+		return ErrPromptPending
+	}
+	if timeout <= 0 {
+		timeout = c.defaultTimeout
+	}
+	p := &pendingPrompt{
+		question:  question,
+		deadline:  time.Now().Add(timeout),
+		onReply:   onReply,
+		onTimeout: onTimeout,
+	}
+	c.startTimerLocked(key, p, timeout)
+	c.pending[key] = p
+	return nil
+}
+
+// startTimerLocked 启动超时计时器
+func (c *Conversations) startTimerLocked(key SessionKey, p *pendingPrompt, timeout time.Duration) {
+	p.timer = time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		if c.pending[key] != p {
+			c.mu.Unlock()
+			return
+		}
+		delete(c.pending, key)
+		c.mu.Unlock()
+		llog.Debugf("[lagrange.会话] %v 的问题 %s 等待超时", key, p.question)
+		if p.onTimeout != nil {
+			p.onTimeout()
+		}
+	})
+}
+
+// Cancel 取消会话中等待的问题，不会调用任何回调
+func (c *Conversations) Cancel(key SessionKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[key]
+	if !ok {
+		return false
+	}
+	p.timer.Stop()
+	delete(c.pending, key)
+	return true
+}
+
+// deliver 将消息交给会话中等待的问题，返回消息是否被作为回复处理
+func (c *Conversations) deliver(ctx *MessageContext) bool {
+	key, ok := SessionKeyOf(ctx)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	p, ok := c.pending[key]
+	if !ok || !p.timer.Stop() {
+		// 计时器已触发时由超时回调负责清理
+		c.mu.Unlock()
+		return false
+	}
+	delete(c.pending, key)
+	c.mu.Unlock()
+
+	// 回调中可以继续提问，实现多步对话
+	if p.onReply(ctx) {
+		return true
+	}
+
+	// 不是回复，问题继续等待剩余时间
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.pending[key]; !exists {
+		c.startTimerLocked(key, p, time.Until(p.deadline))
+		c.pending[key] = p
+	}
+	return false
+}
+
+// conversations 获取消息所属管理器的会话管理器
+func (mc *MessageContext) conversations() (*Conversations, error) {
+	if mc.manager == nil {
+		return nil, ErrNoSession
+	}
+	return mc.manager.conversations, nil
+}
+
+// Ask 发送问题并异步等待同一会话中同一发送者的回复，timeout 为0时使用默认超时
+// 回调返回 false 时该消息不视为回复，继续交给路由处理
+func (mc *MessageContext) Ask(question string, timeout time.Duration, onReply ReplyHandler, onTimeout func()) error {
+	conversations, err := mc.conversations()
+	if err != nil {
+		return err
+	}
+	key, ok := SessionKeyOf(mc)
+	if !ok {
+		return ErrNoSession
+	}
+	if err := conversations.Await(key, question, timeout, onReply, onTimeout); err != nil {
+		return err
+	}
+	mc.Reply([]message.IMessageElement{message.NewText(question)})
+	return nil
+}
+
+// Confirm 请求用户确认操作，不阻塞调用者
+// 收到确认关键词时执行 confirmFunc，收到取消关键词时执行 cancelFunc，其它消息照常处理
+func (mc *MessageContext) Confirm(actionName string, timeout time.Duration, confirmFunc func(), cancelFunc func()) {
+	if actionName == "" {
+		actionName = "未知操作"
+	}
+	conversations, err := mc.conversations()
+	if err != nil {
+		mc.Reply([]message.IMessageElement{message.NewText(fmt.Sprintf("当前会话不支持确认操作，已取消 %s 操作", actionName))})
+		return
+	}
+	timeout = conversations.timeoutOr(timeout)
+	confirmWord, cancelWord := conversations.keywords()
+	question := fmt.Sprintf("你正在执行 %s 请在 %s 内发送“%s”以执行操作，发送“%s”放弃", actionName, timeout, confirmWord, cancelWord)
+
+	err = mc.Ask(question, timeout, func(reply *MessageContext) bool {
+		text := reply.GetMessageText()
+		switch {
+		case conversations.IsConfirm(text):
+			confirmFunc()
+		case conversations.IsCancel(text):
+			cancelFunc()
+		default:
+			return false
+		}
+		return true
+	}, func() {
+		mc.Reply([]message.IMessageElement{message.NewText(fmt.Sprintf("等待超时，已取消 %s 操作", actionName))})
+	})
+	if errors.Is(err, ErrPromptPending) {
+		key, _ := SessionKeyOf(mc)
+		pending, _ := conversations.Pending(key)
+		mc.Reply([]message.IMessageElement{message.NewText(fmt.Sprintf("你还有未完成的操作，请先回复: %s", pending))})
+	} else if err != nil {
+		mc.Reply([]message.IMessageElement{message.NewText(fmt.Sprintf("当前会话不支持确认操作，已取消 %s 操作", actionName))})
+	}
+}
+
+// WizardStep 多步对话中的一步
+type WizardStep struct {
+	Key      string // 回答保存的名称
+	Question string // 提问内容
+	// Parse 解析并校验回答，返回错误时提示错误并重新提问，为空时保存原始文本
+	Parse func(text string) (any, error)
+}
+
+// Wizard 依次提问并收集回答，全部回答后调用 onDone
+// 任意一步收到取消关键词或等待超时时调用 onCancel
+func (mc *MessageContext) Wizard(steps []WizardStep, timeout time.Duration, onDone func(answers map[string]any), onCancel func()) error {
+	conversations, err := mc.conversations()
+	if err != nil {
+		return err
+	}
+	answers := make(map[string]any, len(steps))
+
+	var ask func(ctx *MessageContext, i int) error
+	ask = func(ctx *MessageContext, i int) error {
+		if i == len(steps) {
+			onDone(answers)
+			return nil
+		}
+		step := steps[i]
+		return ctx.Ask(step.Question, timeout, func(reply *MessageContext) bool {
+			text := strings.TrimSpace(reply.GetMessageText())
+			if conversations.IsCancel(text) {
+				onCancel()
+				return true
+			}
+			var value any = text
+			if step.Parse != nil {
+				v, err := step.Parse(text)
+				if err != nil {
+					reply.Reply([]message.IMessageElement{message.NewText(err.Error())})
+					if err := ask(reply, i); err != nil {
+						llog.Errorf("[lagrange.会话] 重新提问失败: %v", err)
+					}
+					return true
+				}
+				value = v
+			}
+			answers[step.Key] = value
+			if err := ask(reply, i+1); err != nil {
+				llog.Errorf("[lagrange.会话] 继续提问失败: %v", err)
+			}
+			return true
+		}, onCancel)
+	}
+	return ask(mc, 0)
+}
@@ -0,0 +1,151 @@
+package logic
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+)
+
+// testChat 模拟外部平台上的一个用户，记录发给该用户的回复
+type testChat struct {
+	lm     *LogicManager
+	sender string
+
+	mu      sync.Mutex
+	replies []string
+}
+
+type testChatMessage struct {
+	chat *testChat
+	text string
+}
+
+func (m testChatMessage) Platform() string   { return "test" }
+func (m testChatMessage) Text() string       { return m.text }
+func (m testChatMessage) SenderID() string   { return m.chat.sender }
+func (m testChatMessage) SenderName() string { return m.chat.sender }
+func (m testChatMessage) Reply(elements []message.IMessageElement) {
+	m.chat.mu.Lock()
+	defer m.chat.mu.Unlock()
+	m.chat.replies = append(m.chat.replies, message.ToReadableString(elements))
+}
+
+// say 发送消息并返回这条消息收到的回复
+func (c *testChat) say(text string) []string {
+	c.mu.Lock()
+	n := len(c.replies)
+	c.mu.Unlock()
+	c.lm.Dispatch(testChatMessage{chat: c, text: text})
+	return c.since(n)
+}
+
+func (c *testChat) since(n int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.replies[n:]...)
+}
+
+// newConfirmManager 注册 /kick 确认命令与兜底路由，返回执行与兜底的记录
+func newConfirmManager(timeout time.Duration) (*LogicManager, *[]string) {
+	lm := NewLogicManager(nil)
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	lm.AddRoute(NewRoute("kick", NewHandlerAdapter(func(ctx *MessageContext) error {
+		ctx.Confirm("踢出 KU_1", timeout, func() { record("confirmed") }, func() { record("cancelled") })
+		return nil
+	})).Match(NewTextMatcher("/kick", true)).SetTerminal(true))
+	lm.AddRoute(NewRoute("forward", NewHandlerAdapter(func(ctx *MessageContext) error {
+		record("forward:" + ctx.GetMessageText())
+		return nil
+	})).SetPriority(PriorityLow))
+	return lm, &events
+}
+
+func TestConfirmConversation(t *testing.T) {
+	lm, events := newConfirmManager(time.Minute)
+	alice := &testChat{lm: lm, sender: "alice"}
+	bob := &testChat{lm: lm, sender: "bob"}
+
+	if replies := alice.say("/kick"); len(replies) != 1 || !strings.Contains(replies[0], "踢出 KU_1") {
+		t.Fatalf("提问 = %q", replies)
+	}
+	if replies := alice.say("/kick"); len(replies) != 1 || !strings.HasPrefix(replies[0], "你还有未完成的操作") {
+		t.Errorf("重复提问 = %q", replies)
+	}
+
+	// 其他人的确认与不是回复的消息照常交给路由
+	bob.say("确认")
+	alice.say("在吗")
+	alice.say(" 确认 ")
+	alice.say("确认")
+
+	want := []string{"forward:确认", "forward:在吗", "confirmed", "forward:确认"}
+	if strings.Join(*events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", *events, want)
+	}
+	if _, pending := lm.Conversations().Pending(SessionKey{Type: "external:test", ID: "alice", Sender: "alice"}); pending {
+		t.Error("确认后不应再有等待的问题")
+	}
+}
+
+func TestConfirmConversationTimeout(t *testing.T) {
+	lm, events := newConfirmManager(20 * time.Millisecond)
+	alice := &testChat{lm: lm, sender: "alice"}
+	alice.say("/kick")
+
+	deadline := time.Now().Add(time.Second)
+	for len(alice.since(0)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if replies := alice.since(0); len(replies) != 2 || replies[1] != "等待超时，已取消 踢出 KU_1 操作" {
+		t.Fatalf("replies = %q", replies)
+	}
+	alice.say("确认")
+	if got := *events; len(got) != 1 || got[0] != "forward:确认" {
+		t.Errorf("超时后的确认应按普通消息处理, events = %v", got)
+	}
+}
+
+func TestWizardConversation(t *testing.T) {
+	lm := NewLogicManager(nil)
+	var answers map[string]any
+	cancelled := false
+	lm.AddRoute(NewRoute("schedule", NewHandlerAdapter(func(ctx *MessageContext) error {
+		return ctx.Wizard([]WizardStep{
+			{Key: "name", Question: "任务名称?"},
+			{Key: "minutes", Question: "提前几分钟提醒?", Parse: func(text string) (any, error) { return strconv.Atoi(text) }},
+		}, time.Minute, func(a map[string]any) { answers = a }, func() { cancelled = true })
+	})).Match(NewTextMatcher("/计划", true)))
+
+	alice := &testChat{lm: lm, sender: "alice"}
+	steps := []struct{ say, reply string }{
+		{"/计划", "任务名称?"},
+		{"每日存档", "提前几分钟提醒?"},
+		{"五", `strconv.Atoi: parsing "五": invalid syntax`},
+		{"5", ""},
+	}
+	for _, step := range steps {
+		replies := alice.say(step.say)
+		if step.reply != "" && (len(replies) == 0 || replies[0] != step.reply) {
+			t.Errorf("发送 %q 后收到 %q, want %q", step.say, replies, step.reply)
+		}
+	}
+	if cancelled || answers["name"] != "每日存档" || answers["minutes"] != 5 {
+		t.Errorf("answers = %v, cancelled = %v", answers, cancelled)
+	}
+
+	alice.say("/计划")
+	alice.say("取消")
+	if !cancelled {
+		t.Error("发送取消关键词应结束对话")
+	}
+}
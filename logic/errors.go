@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/utils/llog"
+)
+
+// 用户错误类型，用于选择回复模板
+const (
+	ErrorKindPermission = "permission" // 无权限
+	ErrorKindRateLimit  = "rate_limit" // 请求过于频繁
+	ErrorKindScope      = "scope"      // 命令不能在当前会话使用
+	ErrorKindInvalid    = "invalid"    // 输入无效
+	ErrorKindInternal   = "internal"   // 内部错误，只用于模板
+)
+
+// UserError 应当告知用户的错误，如无权限、请求过于频繁
+// 其它错误视为内部错误，只记录日志
+type UserError struct {
+	Kind    string
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return e.Message
+}
+
+// NewUserError 创建用户错误
+func NewUserError(kind string, format string, args ...any) *UserError {
+	return &UserError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// AsUserError 判断错误链中是否包含用户错误
+func AsUserError(err error) (*UserError, bool) {
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		return userErr, true
+	}
+	return nil, false
+}
+
+// ErrorTemplateData 错误回复模板可以使用的字段
+type ErrorTemplateData struct {
+	Kind    string
+	Message string
+}
+
+// ErrorPolicyOptions 错误处理策略选项
+type ErrorPolicyOptions struct {
+	// Templates 按错误类型配置的回复模板，使用 {{.Message}} 引用错误信息
+	// 未配置的用户错误类型直接回复错误信息
+	Templates map[string]string
+	// Internal 内部错误的回复模板，为空时不回复
+	Internal string
+	// QuoteInGroup 群聊中是否引用触发错误的消息
+	QuoteInGroup bool
+	// Throttle 同一用户两次错误回复的最小间隔，期间的错误只记录日志
+	Throttle time.Duration
+}
+
+// DefaultErrorPolicyOptions 默认错误处理策略选项
+func DefaultErrorPolicyOptions() ErrorPolicyOptions {
+	return ErrorPolicyOptions{
+		QuoteInGroup: true,
+		Throttle:     10 * time.Second,
+	}
+}
+
+// ErrorPolicy 路由错误处理策略，用户错误回复给用户，内部错误记录日志
+type ErrorPolicy struct {
+	templates    map[string]*template.Template
+	internal     *template.Template
+	quoteInGroup bool
+	throttle     time.Duration
+
+	mu        sync.Mutex
+	lastReply map[string]time.Time
+}
+
+// NewErrorPolicy 校验模板并创建错误处理策略
+func NewErrorPolicy(opts ErrorPolicyOptions) (*ErrorPolicy, error) {
+	p := &ErrorPolicy{
+		templates:    make(map[string]*template.Template, len(opts.Templates)),
+		quoteInGroup: opts.QuoteInGroup,
+		throttle:     opts.Throttle,
+		lastReply:    make(map[string]time.Time),
+	}
+	for kind, text := range opts.Templates {
+		tmpl, err := parseErrorTemplate(kind, text)
+		if err != nil {
+			return nil, err
+		}
+		p.templates[kind] = tmpl
+	}
+	if opts.Internal != "" {
+		tmpl, err := parseErrorTemplate(ErrorKindInternal, opts.Internal)
+		if err != nil {
+			return nil, err
+		}
+		p.internal = tmpl
+	}
+	return p, nil
+}
+
+func parseErrorTemplate(kind string, text string) (*template.Template, error) {
+	tmpl, err := template.New(kind).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("错误类型 %s 的回复模板无效: %w", kind, err)
+	}
+	return tmpl, nil
+}
+
+// Handle 处理路由返回的错误，可作为 Router.SetErrorHandler 的参数
+func (p *ErrorPolicy) Handle(err error, ctx *MessageContext) {
+	data := ErrorTemplateData{Kind: ErrorKindInternal, Message: err.Error()}
+	tmpl := p.internal
+	if userErr, ok := AsUserError(err); ok {
+		llog.Debugf("[lagrange.路由] 用户错误(%s): %v", userErr.Kind, err)
+		data = ErrorTemplateData{Kind: userErr.Kind, Message: userErr.Message}
+		tmpl = p.templates[userErr.Kind]
+	} else {
+		llog.Errorf("[lagrange.路由] 处理消息时发生错误: %v", err)
+		if tmpl == nil {
+			return
+		}
+	}
+
+	text := data.Message
+	if tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			llog.Errorf("[lagrange.路由] 渲染错误回复模板 %s 失败: %v", data.Kind, err)
+			return
+		}
+		text = buf.String()
+	}
+	if text == "" || !p.allow(ctx) {
+		return
+	}
+
+	elements := []message.IMessageElement{message.NewText(text)}
+	if p.quoteInGroup {
+		ctx.QuoteReply(elements)
+	} else {
+		ctx.Reply(elements)
+	}
+}
+
+// allow 同一用户在间隔内只回复一次错误，避免机器人被用来刷屏
+func (p *ErrorPolicy) allow(ctx *MessageContext) bool {
+	key, ok := SessionKeyOf(ctx)
+	if !ok {
+		// 通知事件等没有发送者的消息不回复错误
+		return false
+	}
+	if p.throttle <= 0 {
+		return true
+	}
+	user := key.Sender
+	if ext, ok := ctx.GetExternalMessage(); ok {
+		user = ext.Platform() + ":" + user
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, ok := p.lastReply[user]; ok && now.Sub(last) < p.throttle {
+		llog.Debugf("[lagrange.路由] 用户 %s 的错误回复过于频繁，已忽略", user)
+		return false
+	}
+	// 清理过期记录
+	for u, last := range p.lastReply {
+		if now.Sub(last) >= p.throttle {
+			delete(p.lastReply, u)
+		}
+	}
+	p.lastReply[user] = now
+	return true
+}
@@ -0,0 +1,73 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorPolicyReplies(t *testing.T) {
+	policy, err := NewErrorPolicy(ErrorPolicyOptions{
+		Templates: map[string]string{ErrorKindPermission: "⛔ {{.Message}}"},
+		Internal:  "出错了，请联系管理员",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noInternal, _ := NewErrorPolicy(ErrorPolicyOptions{})
+
+	tests := []struct {
+		name   string
+		policy *ErrorPolicy
+		err    error
+		want   string
+	}{
+		{"使用模板", policy, NewUserError(ErrorKindPermission, "无权限访问"), "⛔ 无权限访问"},
+		{"未配置模板直接回复", policy, NewUserError(ErrorKindRateLimit, "请 %d 秒后再试", 3), "请 3 秒后再试"},
+		{"包装的用户错误", policy, fmt.Errorf("执行命令: %w", NewUserError(ErrorKindInvalid, "参数无效")), "参数无效"},
+		{"内部错误使用模板", policy, errors.New("database is locked"), "出错了，请联系管理员"},
+		{"内部错误默认不回复", noInternal, errors.New("database is locked"), ""},
+	}
+	for _, tt := range tests {
+		chat := &testChat{sender: tt.name}
+		tt.policy.Handle(tt.err, NewMessageContext(nil, testChatMessage{chat: chat}))
+		if got := strings.Join(chat.since(0), "\n"); got != tt.want {
+			t.Errorf("%s: 回复 %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorPolicyThrottle(t *testing.T) {
+	policy, _ := NewErrorPolicy(ErrorPolicyOptions{Throttle: 50 * time.Millisecond})
+	alice, bob := &testChat{sender: "alice"}, &testChat{sender: "bob"}
+	fail := func(chat *testChat) {
+		policy.Handle(NewUserError(ErrorKindRateLimit, "太快了"), NewMessageContext(nil, testChatMessage{chat: chat}))
+	}
+
+	fail(alice)
+	fail(alice)
+	fail(bob)
+	if n := len(alice.since(0)); n != 1 {
+		t.Errorf("间隔内同一用户收到 %d 条错误回复, want 1", n)
+	}
+	if n := len(bob.since(0)); n != 1 {
+		t.Errorf("其他用户不受影响, 收到 %d 条, want 1", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	fail(alice)
+	if n := len(alice.since(0)); n != 2 {
+		t.Errorf("间隔过后应再次回复, 共收到 %d 条, want 2", n)
+	}
+}
+
+func TestNewErrorPolicyRejectsInvalidTemplate(t *testing.T) {
+	if _, err := NewErrorPolicy(ErrorPolicyOptions{Templates: map[string]string{ErrorKindScope: "{{.Message"}}); err == nil {
+		t.Error("无效的模板应返回错误")
+	}
+	if _, err := NewErrorPolicy(ErrorPolicyOptions{Internal: "{{end}}"}); err == nil {
+		t.Error("无效的内部错误模板应返回错误")
+	}
+}
@@ -2,7 +2,12 @@ package logic
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"llma.dev/utils/llog"
@@ -46,111 +51,420 @@ func NewEvent(eventType string, data any) *BaseEvent {
 // EventHandler 事件处理器
 type EventHandler func(ctx context.Context, event Event) error
 
-// EventBus 事件总线
+// EventFilter 事件过滤器，返回 false 时不调用处理器
+type EventFilter func(event Event) bool
+
+// Subscription 事件订阅，通过 Cancel 取消
+type Subscription struct {
+	id        uint64
+	pattern   string
+	handler   EventHandler
+	filters   []EventFilter
+	once      bool
+	createdAt time.Time
+	bus       *EventBus
+	// timeout 处理超时，为0时使用事件总线的默认超时
+	timeout time.Duration
+	// fired 一次性订阅是否已触发
+	fired atomic.Bool
+	// 统计
+	calls      atomic.Int64
+	completed  atomic.Int64
+	errors     atomic.Int64
+	latency    atomic.Int64 // 处理耗时总和(纳秒)
+	maxLatency atomic.Int64
+}
+
+// SubscribeOption 订阅选项
+type SubscribeOption func(*Subscription)
+
+// WithFilter 只处理满足过滤器的事件，可指定多个，需全部满足
+func WithFilter(filter EventFilter) SubscribeOption {
+	return func(s *Subscription) {
+		s.filters = append(s.filters, filter)
+	}
+}
+
+// WithTimeout 设置该订阅的处理超时，超时后不再等待处理器，继续处理下一个事件
+func WithTimeout(timeout time.Duration) SubscribeOption {
+	return func(s *Subscription) {
+		s.timeout = timeout
+	}
+}
+
+// ID 订阅id
+func (s *Subscription) ID() uint64 {
+	return s.id
+}
+
+// Pattern 订阅的事件类型或通配符
+func (s *Subscription) Pattern() string {
+	return s.pattern
+}
+
+// Cancel 取消订阅，可重复调用
+func (s *Subscription) Cancel() {
+	s.bus.Unsubscribe(s)
+}
+
+// matches 事件是否应交给该订阅处理
+func (s *Subscription) matches(event Event) bool {
+	if !matchEventType(s.pattern, event.GetType()) {
+		return false
+	}
+	for _, filter := range s.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchEventType 匹配事件类型，* 匹配任意字符，如 message.* 匹配 message.received
+func matchEventType(pattern string, eventType string) bool {
+	if pattern == eventType {
+		return true
+	}
+	ok, err := path.Match(pattern, eventType)
+	return ok && err == nil
+}
+
+// record 记录一次处理的耗时与结果
+func (s *Subscription) record(elapsed time.Duration, err error) {
+	s.completed.Add(1)
+	s.latency.Add(int64(elapsed))
+	for {
+		current := s.maxLatency.Load()
+		if int64(elapsed) <= current || s.maxLatency.CompareAndSwap(current, int64(elapsed)) {
+			break
+		}
+	}
+	if err != nil {
+		s.errors.Add(1)
+	}
+}
+
+// SubscriptionInfo 订阅信息，用于调试
+type SubscriptionInfo struct {
+	ID           uint64    `json:"id"`
+	Pattern      string    `json:"pattern"`
+	Once         bool      `json:"once"`
+	Filters      int       `json:"filters"`
+	Timeout      string    `json:"timeout"`
+	Calls        int64     `json:"calls"`
+	Errors       int64     `json:"errors"`
+	AvgLatencyMs float64   `json:"avgLatencyMs"`
+	MaxLatencyMs float64   `json:"maxLatencyMs"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// KeyedEvent 带有顺序键的事件，相同键的事件按发布顺序依次处理
+// 处理器超时后总线不再等待它，相同键的下一个事件会与仍在执行的处理器并发，此时不保证顺序
+type KeyedEvent interface {
+	Event
+	// OrderKey 顺序键，如群号或QQ号，为空时不保证顺序
+	OrderKey() string
+}
+
+// EventBusOptions 事件总线选项
+type EventBusOptions struct {
+	Workers     int           // 工作协程数
+	QueueSize   int           // 每个工作协程的队列长度
+	Timeout     time.Duration // 处理器默认超时，超时后取消处理器的 context
+	PublishWait time.Duration // 队列满时 Publish 最多等待的时间，超时后丢弃事件
+}
+
+// DefaultEventBusOptions 默认事件总线选项
+func DefaultEventBusOptions() EventBusOptions {
+	return EventBusOptions{
+		Workers:     4,
+		QueueSize:   256,
+		Timeout:     30 * time.Second,
+		PublishWait: time.Second,
+	}
+}
+
+// eventTask 等待工作协程处理的事件
+type eventTask struct {
+	event Event
+	subs  []*Subscription
+}
+
+// EventBusStats 事件总线统计
+type EventBusStats struct {
+	Workers     int   `json:"workers"`
+	QueueSize   int   `json:"queueSize"`
+	QueueDepths []int `json:"queueDepths"` // 每个工作协程当前排队的事件数
+	Published   int64 `json:"published"`   // 已发布的异步事件数
+	Processed   int64 `json:"processed"`   // 已处理完成的异步事件数
+	Blocked     int64 `json:"blocked"`     // 因队列已满而等待的发布次数
+	Dropped     int64 `json:"dropped"`     // 等待超时后丢弃的事件数
+	Failed      int64 `json:"failed"`      // 处理器返回错误的次数
+	TimedOut    int64 `json:"timedOut"`    // 处理器超时的次数
+	Panicked    int64 `json:"panicked"`    // 处理器panic的次数
+
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
+}
+
+// EventBus 事件总线，异步事件由固定数量的工作协程处理
+// 相同顺序键的事件总是交给同一个工作协程，保证按发布顺序处理
 type EventBus struct {
-	handlers map[string][]EventHandler
-	mu       sync.RWMutex
-	ctx      context.Context
-	cancel   context.CancelFunc
-	wg       sync.WaitGroup
+	subscriptions []*Subscription
+	nextID        uint64
+	mu            sync.RWMutex
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+
+	options   EventBusOptions
+	queues    []chan eventTask
+	startOnce sync.Once
+	next      atomic.Uint64 // 无顺序键事件的轮询位置
+
+	published atomic.Int64
+	processed atomic.Int64
+	blocked   atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+	timedOut  atomic.Int64
+	panicked  atomic.Int64
 }
 
-// NewEventBus 创建新的事件总线
+// NewEventBus 使用默认选项创建新的事件总线
 func NewEventBus() *EventBus {
+	return NewEventBusWithOptions(DefaultEventBusOptions())
+}
+
+// NewEventBusWithOptions 创建新的事件总线，未设置的选项使用默认值
+func NewEventBusWithOptions(options EventBusOptions) *EventBus {
+	defaults := DefaultEventBusOptions()
+	if options.Workers <= 0 {
+		options.Workers = defaults.Workers
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaults.QueueSize
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = defaults.Timeout
+	}
+	if options.PublishWait <= 0 {
+		options.PublishWait = defaults.PublishWait
+	}
 	ctx, cancel := context.WithCancel(context.Background())
-	return &EventBus{
-		handlers: make(map[string][]EventHandler),
-		ctx:      ctx,
-		cancel:   cancel,
+	bus := &EventBus{
+		ctx:     ctx,
+		cancel:  cancel,
+		options: options,
+		queues:  make([]chan eventTask, options.Workers),
 	}
+	for i := range bus.queues {
+		bus.queues[i] = make(chan eventTask, options.QueueSize)
+	}
+	return bus
 }
 
-// Subscribe 订阅事件
-func (bus *EventBus) Subscribe(eventType string, handler EventHandler) {
-	bus.mu.Lock()
-	defer bus.mu.Unlock()
+// start 首次发布事件时启动工作协程
+func (bus *EventBus) start() {
+	bus.startOnce.Do(func() {
+		for _, queue := range bus.queues {
+			bus.wg.Add(1)
+			go bus.work(queue)
+		}
+	})
+}
 
-	if bus.handlers[eventType] == nil {
-		bus.handlers[eventType] = make([]EventHandler, 0)
+// work 工作协程，依次处理队列中的事件
+func (bus *EventBus) work(queue chan eventTask) {
+	defer bus.wg.Done()
+	for {
+		select {
+		case task := <-queue:
+			for _, sub := range task.subs {
+				bus.invoke(sub, task.event)
+			}
+			bus.processed.Add(1)
+		case <-bus.ctx.Done():
+			return
+		}
 	}
+}
 
-	bus.handlers[eventType] = append(bus.handlers[eventType], handler)
-	llog.Debugf("[lagrange.事件] 订阅事件类型: %s", eventType)
+// invoke 调用处理器并等待完成或超时
+// 超时后取消处理器的 context 并不再等待，未响应取消的处理器在后台继续执行，
+// 工作协程随即处理下一个事件，因此超时的事件与之后相同顺序键的事件不再保证顺序
+func (bus *EventBus) invoke(sub *Subscription, event Event) {
+	timeout := sub.timeout
+	if timeout <= 0 {
+		timeout = bus.options.Timeout
+	}
+	ctx, cancel := context.WithTimeout(bus.ctx, timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				bus.panicked.Add(1)
+				sub.record(time.Since(start), fmt.Errorf("panic: %v", r))
+				llog.Errorf("[lagrange.事件] 事件处理器发生panic: %v", r)
+			}
+		}()
+		err := sub.handler(ctx, event)
+		sub.record(time.Since(start), err)
+		if err != nil {
+			bus.failed.Add(1)
+			llog.Errorf("[lagrange.事件] 处理事件 %s 时发生错误: %v", event.GetType(), err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if bus.ctx.Err() == nil {
+			bus.timedOut.Add(1)
+			llog.Warningf("[lagrange.事件] 订阅 %d 处理事件 %s 超过 %s，不再等待", sub.id, event.GetType(), timeout)
+		}
+	}
+}
+
+// queueFor 选择处理该事件的队列
+func (bus *EventBus) queueFor(event Event) chan eventTask {
+	if keyed, ok := event.(KeyedEvent); ok {
+		if key := keyed.OrderKey(); key != "" {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			return bus.queues[h.Sum32()%uint32(len(bus.queues))]
+		}
+	}
+	return bus.queues[bus.next.Add(1)%uint64(len(bus.queues))]
+}
+
+// Subscribe 订阅事件，pattern 可以是事件类型或通配符，如 message.*
+func (bus *EventBus) Subscribe(pattern string, handler EventHandler, opts ...SubscribeOption) *Subscription {
+	return bus.subscribe(pattern, handler, false, opts)
+}
+
+// SubscribeOnce 订阅事件，处理第一个匹配的事件后自动取消
+func (bus *EventBus) SubscribeOnce(pattern string, handler EventHandler, opts ...SubscribeOption) *Subscription {
+	return bus.subscribe(pattern, handler, true, opts)
+}
+
+func (bus *EventBus) subscribe(pattern string, handler EventHandler, once bool, opts []SubscribeOption) *Subscription {
+	sub := &Subscription{
+		pattern:   pattern,
+		handler:   handler,
+		once:      once,
+		createdAt: time.Now(),
+		bus:       bus,
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.nextID++
+	sub.id = bus.nextID
+	bus.subscriptions = append(bus.subscriptions, sub)
+	llog.Debugf("[lagrange.事件] 订阅事件类型: %s (id: %d)", pattern, sub.id)
+	return sub
 }
 
-// Unsubscribe 取消订阅事件
-func (bus *EventBus) Unsubscribe(eventType string, handler EventHandler) {
+// Unsubscribe 取消订阅
+func (bus *EventBus) Unsubscribe(sub *Subscription) {
 	bus.mu.Lock()
 	defer bus.mu.Unlock()
 
-	handlers := bus.handlers[eventType]
-	if handlers == nil {
+	i := slices.Index(bus.subscriptions, sub)
+	if i < 0 {
 		return
 	}
+	bus.subscriptions = slices.Delete(bus.subscriptions, i, i+1)
+	llog.Debugf("[lagrange.事件] 取消订阅事件类型: %s (id: %d)", sub.pattern, sub.id)
+}
 
-	// 移除指定的处理器
-	for i, h := range handlers {
-		if &h == &handler {
-			bus.handlers[eventType] = append(handlers[:i], handlers[i+1:]...)
-			break
+// match 获取应处理该事件的订阅，一次性订阅在此处被取走
+func (bus *EventBus) match(event Event) []*Subscription {
+	bus.mu.RLock()
+	matched := slices.Clone(bus.subscriptions)
+	bus.mu.RUnlock()
+
+	// 过滤器在锁外执行，过滤器中可以安全地订阅或取消订阅
+	// 一次性订阅只交给第一个取到它的事件
+	matched = slices.DeleteFunc(matched, func(sub *Subscription) bool {
+		if !sub.matches(event) {
+			return true
+		}
+		if !sub.once {
+			return false
 		}
+		if !sub.fired.CompareAndSwap(false, true) {
+			return true
+		}
+		sub.Cancel()
+		return false
+	})
+	for _, sub := range matched {
+		sub.calls.Add(1)
 	}
-
-	llog.Debugf("[lagrange.事件] 取消订阅事件类型: %s", eventType)
+	return matched
 }
 
 // Publish 发布事件
 func (bus *EventBus) Publish(event Event) {
-	bus.mu.RLock()
-	handlers := make([]EventHandler, len(bus.handlers[event.GetType()]))
-	copy(handlers, bus.handlers[event.GetType()])
-	bus.mu.RUnlock()
-
-	if len(handlers) == 0 {
+	subs := bus.match(event)
+	if len(subs) == 0 {
 		return
 	}
 
 	llog.Debugf("[lagrange.事件] 发布事件: %s", event.GetType())
 
-	// 异步处理事件
-	for _, handler := range handlers {
-		bus.wg.Add(1)
-		go func(h EventHandler) {
-			defer bus.wg.Done()
-			defer func() {
-				if r := recover(); r != nil {
-					llog.Errorf("[lagrange.事件] 事件处理器发生panic: %v", r)
-				}
-			}()
-
-			ctx, cancel := context.WithTimeout(bus.ctx, 30*time.Second)
-			defer cancel()
-
-			if err := h(ctx, event); err != nil {
-				llog.Errorf("[lagrange.事件] 处理事件 %s 时发生错误: %v", event.GetType(), err)
-			}
-		}(handler)
+	// 交给工作协程异步处理，队列已满时最多等待 PublishWait，避免阻塞调用方（如消息接收协程）
+	bus.start()
+	queue := bus.queueFor(event)
+	task := eventTask{event: event, subs: subs}
+	select {
+	case queue <- task:
+	default:
+		bus.blocked.Add(1)
+		timer := time.NewTimer(bus.options.PublishWait)
+		defer timer.Stop()
+		select {
+		case queue <- task:
+		case <-timer.C:
+			bus.dropped.Add(1)
+			llog.Warningf("[lagrange.事件] 事件队列已满，等待 %s 后丢弃事件 %s", bus.options.PublishWait, event.GetType())
+			return
+		case <-bus.ctx.Done():
+			return
+		}
 	}
+	bus.published.Add(1)
 }
 
 // PublishSync 同步发布事件
 func (bus *EventBus) PublishSync(event Event) error {
-	bus.mu.RLock()
-	handlers := make([]EventHandler, len(bus.handlers[event.GetType()]))
-	copy(handlers, bus.handlers[event.GetType()])
-	bus.mu.RUnlock()
-
-	if len(handlers) == 0 {
+	subs := bus.match(event)
+	if len(subs) == 0 {
 		return nil
 	}
 
 	llog.Debugf("[lagrange.事件] 同步发布事件: %s", event.GetType())
 
-	ctx, cancel := context.WithTimeout(bus.ctx, 30*time.Second)
-	defer cancel()
-
-	for _, handler := range handlers {
-		if err := handler(ctx, event); err != nil {
+	for _, sub := range subs {
+		timeout := sub.timeout
+		if timeout <= 0 {
+			timeout = bus.options.Timeout
+		}
+		ctx, cancel := context.WithTimeout(bus.ctx, timeout)
+		start := time.Now()
+		err := sub.handler(ctx, event)
+		cancel()
+		sub.record(time.Since(start), err)
+		if err != nil {
+			bus.failed.Add(1)
 			llog.Errorf("[lagrange.事件] 处理事件 %s 时发生错误: %v", event.GetType(), err)
 			return err
 		}
@@ -166,31 +480,107 @@ func (bus *EventBus) Close() {
 	llog.Infof("[lagrange.事件] 事件总线已关闭")
 }
 
-// GetSubscriberCount 获取订阅者数量
+// GetSubscriberCount 获取会处理该事件类型的订阅数量，包括通配符订阅
 func (bus *EventBus) GetSubscriberCount(eventType string) int {
 	bus.mu.RLock()
 	defer bus.mu.RUnlock()
-	return len(bus.handlers[eventType])
+	count := 0
+	for _, sub := range bus.subscriptions {
+		if matchEventType(sub.pattern, eventType) {
+			count++
+		}
+	}
+	return count
 }
 
-// GetAllEventTypes 获取所有事件类型
+// GetAllEventTypes 获取所有已订阅的事件类型与通配符
 func (bus *EventBus) GetAllEventTypes() []string {
 	bus.mu.RLock()
 	defer bus.mu.RUnlock()
 
-	types := make([]string, 0, len(bus.handlers))
-	for eventType := range bus.handlers {
-		types = append(types, eventType)
+	types := make([]string, 0, len(bus.subscriptions))
+	for _, sub := range bus.subscriptions {
+		if !slices.Contains(types, sub.pattern) {
+			types = append(types, sub.pattern)
+		}
 	}
 	return types
 }
 
+// Subscriptions 获取当前有效的订阅，用于调试
+func (bus *EventBus) Subscriptions() []SubscriptionInfo {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+
+	infos := make([]SubscriptionInfo, 0, len(bus.subscriptions))
+	for _, sub := range bus.subscriptions {
+		timeout := sub.timeout
+		if timeout <= 0 {
+			timeout = bus.options.Timeout
+		}
+		info := SubscriptionInfo{
+			ID:           sub.id,
+			Pattern:      sub.pattern,
+			Once:         sub.once,
+			Filters:      len(sub.filters),
+			Timeout:      timeout.String(),
+			Calls:        sub.calls.Load(),
+			Errors:       sub.errors.Load(),
+			MaxLatencyMs: float64(sub.maxLatency.Load()) / float64(time.Millisecond),
+			CreatedAt:    sub.createdAt,
+		}
+		if completed := sub.completed.Load(); completed > 0 {
+			info.AvgLatencyMs = float64(sub.latency.Load()) / float64(completed) / float64(time.Millisecond)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Stats 获取事件总线统计
+func (bus *EventBus) Stats() EventBusStats {
+	depths := make([]int, len(bus.queues))
+	for i, queue := range bus.queues {
+		depths[i] = len(queue)
+	}
+	return EventBusStats{
+		Workers:       bus.options.Workers,
+		QueueSize:     bus.options.QueueSize,
+		QueueDepths:   depths,
+		Published:     bus.published.Load(),
+		Processed:     bus.processed.Load(),
+		Blocked:       bus.blocked.Load(),
+		Dropped:       bus.dropped.Load(),
+		Failed:        bus.failed.Load(),
+		TimedOut:      bus.timedOut.Load(),
+		Panicked:      bus.panicked.Load(),
+		Subscriptions: bus.Subscriptions(),
+	}
+}
+
 // MessageEvent 消息事件
 type MessageEvent struct {
 	*BaseEvent
 	MessageContext *MessageContext
 }
 
+// OrderKey 同一会话的消息事件按顺序处理
+func (e *MessageEvent) OrderKey() string {
+	return sessionOrderKey(e.MessageContext)
+}
+
+// sessionOrderKey 消息所属会话的顺序键
+func sessionOrderKey(ctx *MessageContext) string {
+	if ctx == nil {
+		return ""
+	}
+	key, ok := SessionKeyOf(ctx)
+	if !ok {
+		return ""
+	}
+	return key.Type + ":" + key.ID
+}
+
 // NewMessageEvent 创建消息事件
 func NewMessageEvent(eventType string, ctx *MessageContext) *MessageEvent {
 	return &MessageEvent{
@@ -207,6 +597,11 @@ const (
 	EventTypeUserJoined       = "user.joined"
 	EventTypeUserLeft         = "user.left"
 	EventTypeError            = "error.occurred"
+
+	EventTypeBotConnected       = "connection.connected"
+	EventTypeBotDisconnected    = "connection.disconnected"
+	EventTypeBotReconnecting    = "connection.reconnecting"
+	EventTypeBotReconnectFailed = "connection.reconnect_failed"
 )
 
 // 全局事件总线实例
@@ -224,11 +619,19 @@ func PublishMessageProcessed(ctx *MessageContext) {
 	GlobalEventBus.Publish(event)
 }
 
-// PublishCommandExecuted 发布命令执行事件
+// PublishCommandExecuted 发布命令执行事件，消息所属管理器的事件总线优先
 func PublishCommandExecuted(ctx *MessageContext, command string) {
+	publishCommandExecuted(ctx, command, nil)
+}
+
+// publishCommandExecuted 命令处理成功后发布 CommandExecuted 事件
+func publishCommandExecuted(ctx *MessageContext, command string, args Args) {
 	ctx.Set("executed_command", command)
-	event := NewMessageEvent(EventTypeCommandExecuted, ctx)
-	GlobalEventBus.Publish(event)
+	bus := GlobalEventBus
+	if ctx.manager != nil {
+		bus = ctx.manager.eventBus
+	}
+	Publish(bus, CommandExecuted{Context: ctx, Command: command, Args: args})
 }
 
 // PublishError 发布错误事件
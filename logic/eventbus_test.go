@@ -0,0 +1,239 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyedEvent 测试用的带顺序键事件
+type keyedEvent struct {
+	*BaseEvent
+	key string
+}
+
+func (e *keyedEvent) OrderKey() string {
+	return e.key
+}
+
+func TestMatchEventType(t *testing.T) {
+	tests := []struct {
+		pattern, eventType string
+		want               bool
+	}{
+		{"message.received", "message.received", true},
+		{"message.received", "message.processed", false},
+		{"message.*", "message.received", true},
+		{"message.*", "command.executed", false},
+		{"*", "command.executed", true},
+	}
+	for _, tt := range tests {
+		if got := matchEventType(tt.pattern, tt.eventType); got != tt.want {
+			t.Errorf("matchEventType(%q, %q) = %v, want %v", tt.pattern, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestEventBusOrderKey(t *testing.T) {
+	bus := NewEventBusWithOptions(EventBusOptions{Workers: 4})
+	defer bus.Close()
+
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	var wg sync.WaitGroup
+	bus.Subscribe("test", func(ctx context.Context, event Event) error {
+		defer wg.Done()
+		e := event.(*keyedEvent)
+		mu.Lock()
+		got[e.key] = append(got[e.key], e.GetData().(int))
+		mu.Unlock()
+		return nil
+	})
+
+	keys := []string{"group:1", "group:2", "private:3"}
+	const n = 50
+	wg.Add(n * len(keys))
+	for i := 0; i < n; i++ {
+		for _, key := range keys {
+			bus.Publish(&keyedEvent{BaseEvent: NewEvent("test", i), key: key})
+		}
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if len(got[key]) != n {
+			t.Fatalf("%s 处理了 %d 个事件, want %d", key, len(got[key]), n)
+		}
+		for i, v := range got[key] {
+			if v != i {
+				t.Fatalf("%s 第 %d 个事件为 %d，顺序错误", key, i, v)
+			}
+		}
+	}
+}
+
+func TestEventBusTimeoutCancelsHandler(t *testing.T) {
+	bus := NewEventBusWithOptions(EventBusOptions{Workers: 1})
+	defer bus.Close()
+
+	cancelled := make(chan struct{})
+	next := make(chan struct{})
+	bus.Subscribe("slow", func(ctx context.Context, event Event) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}, WithTimeout(20*time.Millisecond))
+	bus.Subscribe("fast", func(ctx context.Context, event Event) error {
+		close(next)
+		return nil
+	})
+
+	bus.Publish(NewEvent("slow", nil))
+	bus.Publish(NewEvent("fast", nil))
+
+	for _, ch := range []chan struct{}{cancelled, next} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("超时的处理器应被取消，后续事件应继续处理")
+		}
+	}
+	if stats := bus.Stats(); stats.TimedOut != 1 {
+		t.Fatalf("TimedOut = %d, want 1", stats.TimedOut)
+	}
+}
+
+func TestEventBusPublishDropsWhenFull(t *testing.T) {
+	bus := NewEventBusWithOptions(EventBusOptions{Workers: 1, QueueSize: 1, PublishWait: 10 * time.Millisecond})
+	release := make(chan struct{})
+	bus.Subscribe("test", func(ctx context.Context, event Event) error {
+		<-release
+		return nil
+	})
+	defer func() {
+		close(release)
+		bus.Close()
+	}()
+
+	// 第一个事件被工作协程取走并阻塞，第二个占满队列，之后的事件等待超时后丢弃
+	bus.Publish(NewEvent("test", 0))
+	deadline := time.Now().Add(time.Second)
+	for len(bus.queues[0]) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		bus.Publish(NewEvent("test", i))
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("队列满时 Publish 阻塞了 %v", elapsed)
+	}
+
+	stats := bus.Stats()
+	if stats.Published != 2 || stats.Dropped != 2 || stats.Blocked != 2 {
+		t.Fatalf("published = %d, dropped = %d, blocked = %d, want 2, 2, 2",
+			stats.Published, stats.Dropped, stats.Blocked)
+	}
+}
+
+func TestEventBusSubscribeOnceAndFilter(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var once, filtered int
+	bus.SubscribeOnce("test", func(ctx context.Context, event Event) error {
+		once++
+		return nil
+	})
+	bus.Subscribe("test", func(ctx context.Context, event Event) error {
+		filtered++
+		return nil
+	}, WithFilter(func(event Event) bool { return event.GetData() == "keep" }))
+
+	for _, data := range []string{"keep", "skip", "keep"} {
+		if err := bus.PublishSync(NewEvent("test", data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if once != 1 || filtered != 2 {
+		t.Fatalf("once = %d, filtered = %d, want 1, 2", once, filtered)
+	}
+	if count := bus.GetSubscriberCount("test"); count != 1 {
+		t.Fatalf("GetSubscriberCount = %d, want 1", count)
+	}
+}
+
+func TestSubscriptionCancel(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var got []string
+	record := func(name string) EventHandler {
+		return func(ctx context.Context, event Event) error {
+			got = append(got, name+":"+event.GetType())
+			return nil
+		}
+	}
+	exact := bus.Subscribe("message.received", record("exact"))
+	wildcard := bus.Subscribe("message.*", record("wildcard"))
+	bus.Subscribe("command.*", record("command"))
+
+	bus.PublishSync(NewEvent("message.received", nil))
+	exact.Cancel()
+	exact.Cancel()
+	bus.PublishSync(NewEvent("message.received", nil))
+	bus.PublishSync(NewEvent("message.processed", nil))
+	wildcard.Cancel()
+	bus.PublishSync(NewEvent("message.processed", nil))
+
+	want := []string{
+		"exact:message.received", "wildcard:message.received",
+		"wildcard:message.received",
+		"wildcard:message.processed",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if types := bus.GetAllEventTypes(); fmt.Sprint(types) != "[command.*]" {
+		t.Errorf("GetAllEventTypes() = %v, want [command.*]", types)
+	}
+}
+
+func TestSubscribeOnceConcurrentPublish(t *testing.T) {
+	bus := NewEventBusWithOptions(EventBusOptions{Workers: 8})
+	defer bus.Close()
+
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	sub := bus.SubscribeOnce("game.*", func(ctx context.Context, event Event) error {
+		calls.Add(1)
+		return nil
+	})
+	if info := bus.Stats().Subscriptions; len(info) != 1 || !info[0].Once || info[0].ID != sub.ID() {
+		t.Fatalf("订阅信息 = %+v", info)
+	}
+
+	// 并发发布时一次性订阅只会被一个事件取走
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bus.Publish(&keyedEvent{BaseEvent: NewEvent("game.join", i), key: fmt.Sprint(i)})
+		}()
+	}
+	wg.Wait()
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("一次性订阅处理了 %d 个事件, want 1", n)
+	}
+	if count := bus.GetSubscriberCount("game.join"); count != 0 {
+		t.Errorf("触发后应自动取消订阅, GetSubscriberCount = %d", count)
+	}
+}
@@ -12,15 +12,40 @@ type LogicManager struct {
 	client   *client.QQClient
 	router   *Router
 	eventBus *EventBus
+	registry *commandRegistry
+	// conversations 等待回复的会话
+	conversations *Conversations
+}
+
+// ManagerOption 逻辑管理器选项
+type ManagerOption func(*LogicManager)
+
+// WithEventBus 使用指定的事件总线
+func WithEventBus(bus *EventBus) ManagerOption {
+	return func(lm *LogicManager) {
+		lm.eventBus = bus
+	}
 }
 
 // NewLogicManager 创建新的逻辑管理器
-func NewLogicManager(client *client.QQClient) *LogicManager {
-	return &LogicManager{
+func NewLogicManager(client *client.QQClient, opts ...ManagerOption) *LogicManager {
+	lm := &LogicManager{
 		client:   client,
 		router:   NewRouter(),
 		eventBus: NewEventBus(),
+		registry: &commandRegistry{
+			prefixes:    []string{"/"},
+			permissions: make(map[string]permission),
+		},
+		conversations: NewConversations(),
+	}
+	// 默认错误策略，用户错误回复给用户
+	policy, _ := NewErrorPolicy(DefaultErrorPolicyOptions())
+	lm.router.SetErrorHandler(policy.Handle)
+	for _, opt := range opts {
+		opt(lm)
 	}
+	return lm
 }
 
 // GetRouter 获取路由器
@@ -33,6 +58,16 @@ func (lm *LogicManager) GetEventBus() *EventBus {
 	return lm.eventBus
 }
 
+// Conversations 获取会话管理器
+func (lm *LogicManager) Conversations() *Conversations {
+	return lm.conversations
+}
+
+// SetErrorPolicy 设置路由错误处理策略
+func (lm *LogicManager) SetErrorPolicy(policy *ErrorPolicy) {
+	lm.router.SetErrorHandler(policy.Handle)
+}
+
 // UseMiddleware 使用全局中间件
 func (lm *LogicManager) UseMiddleware(middleware Middleware) {
 	lm.router.Use(middleware)
@@ -55,7 +90,13 @@ func (lm *LogicManager) HandlePrivateMessage(handler HandlerFunc, matchers ...Ma
 
 // HandleGroupMessage 处理群消息的便捷方法
 func (lm *LogicManager) HandleGroupMessage(handler HandlerFunc, matchers ...Matcher) {
+	lm.HandleGroupMessageWithPriority(PriorityDefault, handler, matchers...)
+}
+
+// HandleGroupMessageWithPriority 以指定优先级处理群消息，已被更高优先级路由处理的消息不会到达
+func (lm *LogicManager) HandleGroupMessageWithPriority(priority int, handler HandlerFunc, matchers ...Matcher) {
 	route := NewRoute("group_message", NewHandlerAdapter(handler))
+	route.SetPriority(priority)
 	route.Match(NewMessageTypeMatcher("group"))
 	for _, matcher := range matchers {
 		route.Match(matcher)
@@ -75,7 +116,14 @@ func (lm *LogicManager) HandleFriendRequest(handler HandlerFunc, matchers ...Mat
 
 // HandleCommand 处理命令的便捷方法
 func (lm *LogicManager) HandleCommand(prefix string, command string, handler HandlerFunc, middlewares ...Middleware) {
-	route := NewRoute("command_"+command, NewHandlerAdapter(handler))
+	route := NewRoute("command_"+command, NewHandlerAdapter(func(ctx *MessageContext) error {
+		if err := handler(ctx); err != nil {
+			return err
+		}
+		publishCommandExecuted(ctx, command, nil)
+		return nil
+	}))
+	route.SetPriority(PriorityCommand).SetTerminal(true)
 	route.Match(NewCommandMatcher(prefix, command))
 	for _, middleware := range middlewares {
 		route.Use(middleware)
@@ -83,6 +131,12 @@ func (lm *LogicManager) HandleCommand(prefix string, command string, handler Han
 	lm.AddRoute(route)
 }
 
+// Dispatch 处理外部来源的消息，如游戏内聊天
+func (lm *LogicManager) Dispatch(msg ExternalMessage) {
+	ctx := NewMessageContext(lm.client, msg)
+	lm.processMessage(ctx)
+}
+
 // SetupEventListeners 设置事件监听器
 func (lm *LogicManager) SetupEventListeners() {
 	// 私聊消息事件
@@ -102,18 +156,28 @@ func (lm *LogicManager) SetupEventListeners() {
 		ctx := NewMessageContext(client, event)
 		lm.processMessage(ctx)
 	})
+
+	// 群通知与好友通知事件
+	lm.setupNoticeListeners()
 }
 
 // processMessage 处理消息
 func (lm *LogicManager) processMessage(ctx *MessageContext) {
-	// 发布消息接收事件
-	PublishMessageReceived(ctx)
+	ctx.manager = lm
 
-	// 通过路由器处理消息
-	lm.router.Handle(ctx)
+	// 发布消息接收事件
+	Publish(lm.eventBus, MessageReceived{Context: ctx})
+
+	// 等待中的问题优先处理回复，回复不再交给路由
+	if lm.conversations.deliver(ctx) {
+		ctx.Consume()
+	} else {
+		// 通过路由器处理消息
+		lm.router.Handle(ctx)
+	}
 
 	// 发布消息处理完成事件
-	PublishMessageProcessed(ctx)
+	Publish(lm.eventBus, MessageProcessed{Context: ctx})
 }
 
 // Close 关闭逻辑管理器
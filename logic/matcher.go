@@ -28,8 +28,12 @@ func (m *MessageTypeMatcher) Match(ctx *MessageContext) bool {
 	case "friend_request":
 		_, ok := ctx.GetFriendRequest()
 		return ok
+	case "external":
+		_, ok := ctx.GetExternalMessage()
+		return ok
 	default:
-		return false
+		// 通知事件按消息类型名称匹配
+		return getMessageType(ctx.Message) == m.MessageType
 	}
 }
 
@@ -1,7 +1,6 @@
 package logic
 
 import (
-	"fmt"
 	"slices"
 	"time"
 
@@ -24,7 +23,9 @@ func LoggingMiddleware() Middleware {
 
 			// 记录请求结束
 			duration := time.Since(start)
-			if err != nil {
+			if _, ok := AsUserError(err); ok {
+				llog.Debugf("[lagrange.中间件] 处理 %s 消息被拒绝 (耗时: %v): %v", msgType, duration, err)
+			} else if err != nil {
 				llog.Errorf("[lagrange.中间件] 处理 %s 消息失败 (耗时: %v): %v", msgType, duration, err)
 			} else {
 				llog.Debugf("[lagrange.中间件] 处理 %s 消息成功 (耗时: %v)", msgType, duration)
@@ -49,44 +50,22 @@ func RecoveryMiddleware() Middleware {
 	}
 }
 
-// RateLimitMiddleware 限流中间件
+// RateLimitMiddleware 限流中间件，每个用户在 window 内最多 maxRequests 次请求，令牌匀速恢复
 func RateLimitMiddleware(maxRequests int, window time.Duration) Middleware {
-	requests := make(map[string][]time.Time)
-
+	if maxRequests <= 0 {
+		maxRequests = 1
+	}
+	limiter := NewRateLimiter(RateLimit{Burst: maxRequests, Interval: window / time.Duration(maxRequests)}, 0)
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx *MessageContext) error {
-			var userID string
-
-			// 获取用户ID
-			if privateMsg, ok := ctx.GetPrivateMessage(); ok {
-				userID = fmt.Sprintf("private_%d", privateMsg.Sender.Uin)
-			} else if groupMsg, ok := ctx.GetGroupMessage(); ok {
-				userID = fmt.Sprintf("group_%d_%d", groupMsg.GroupUin, groupMsg.Sender.Uin)
-			} else {
+			userID, ok := RateLimitKey(ctx, RateLimitUser)
+			if !ok {
 				return next(ctx)
 			}
-
-			now := time.Now()
-
-			// 清理过期请求
-			userRequests := requests[userID]
-			validRequests := make([]time.Time, 0)
-			for _, reqTime := range userRequests {
-				if now.Sub(reqTime) < window {
-					validRequests = append(validRequests, reqTime)
-				}
-			}
-
-			// 检查限流
-			if len(validRequests) >= maxRequests {
+			if allowed, _ := limiter.Allow(userID); !allowed {
 				llog.Warningf("[lagrange.中间件] 用户 %s 触发限流", userID)
-				return fmt.Errorf("请求过于频繁，请稍后再试")
+				return NewUserError(ErrorKindRateLimit, "请求过于频繁，请稍后再试")
 			}
-
-			// 记录请求
-			validRequests = append(validRequests, now)
-			requests[userID] = validRequests
-
 			return next(ctx)
 		}
 	}
@@ -112,6 +91,9 @@ func AuthMiddleware(allowedUsers []uint32) Middleware {
 				userID = privateMsg.Sender.Uin
 			} else if groupMsg, ok := ctx.GetGroupMessage(); ok {
 				userID = groupMsg.Sender.Uin
+			} else if _, ok := ctx.GetExternalMessage(); ok {
+				// 外部来源的消息没有QQ号，无法认证
+				return NewUserError(ErrorKindPermission, "无权限访问")
 			} else {
 				return next(ctx)
 			}
@@ -119,7 +101,34 @@ func AuthMiddleware(allowedUsers []uint32) Middleware {
 			// 检查权限
 			if !userSet[userID] {
 				llog.Warningf("[lagrange.中间件] 未授权用户 %d 尝试访问", userID)
-				return fmt.Errorf("无权限访问")
+				return NewUserError(ErrorKindPermission, "无权限访问")
+			}
+
+			ctx.Set("user_id", userID)
+			ctx.Set("authorized", true)
+
+			return next(ctx)
+		}
+	}
+}
+
+// StrictAuthMiddleware 严格认证中间件，与 AuthMiddleware 不同，用户列表为空时拒绝所有人
+func StrictAuthMiddleware(allowedUsers []uint32) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *MessageContext) error {
+			var userID uint32
+
+			if privateMsg, ok := ctx.GetPrivateMessage(); ok {
+				userID = privateMsg.Sender.Uin
+			} else if groupMsg, ok := ctx.GetGroupMessage(); ok {
+				userID = groupMsg.Sender.Uin
+			} else {
+				return NewUserError(ErrorKindPermission, "无权限访问")
+			}
+
+			if !slices.Contains(allowedUsers, userID) {
+				llog.Warningf("[lagrange.中间件] 未授权用户 %d 尝试访问受限命令", userID)
+				return NewUserError(ErrorKindPermission, "无权限访问")
 			}
 
 			ctx.Set("user_id", userID)
@@ -135,7 +144,7 @@ func GroupOnlyMiddleware() Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx *MessageContext) error {
 			if _, ok := ctx.GetGroupMessage(); !ok {
-				return fmt.Errorf("此命令仅在群聊中可用")
+				return NewUserError(ErrorKindScope, "此命令仅在群聊中可用")
 			}
 			return next(ctx)
 		}
@@ -146,13 +155,16 @@ func GroupOnlyMiddleware() Middleware {
 func AllowedGroupMiddleware(allowedGroups []uint32) Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx *MessageContext) error {
-			groupMsg, ok := ctx.GetGroupMessage()
+			groupUin, ok := ctx.NoticeGroupUin()
+			if groupMsg, isGroup := ctx.GetGroupMessage(); isGroup {
+				groupUin, ok = groupMsg.GroupUin, true
+			}
 			// 非群聊会话直接放行
 			if !ok {
 				return next(ctx)
 			}
 
-			if slices.Contains(allowedGroups, groupMsg.GroupUin) {
+			if slices.Contains(allowedGroups, groupUin) {
 				return next(ctx)
 			}
 			llog.Debugf("不允许的群聊，已拦截")
@@ -166,7 +178,7 @@ func PrivateOnlyMiddleware() Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx *MessageContext) error {
 			if _, ok := ctx.GetPrivateMessage(); !ok {
-				return fmt.Errorf("此命令仅在私聊中可用")
+				return NewUserError(ErrorKindScope, "此命令仅在私聊中可用")
 			}
 			return next(ctx)
 		}
@@ -204,6 +216,26 @@ func getMessageType(msg any) string {
 		return "group"
 	case *event.NewFriendRequest:
 		return "friend_request"
+	case ExternalMessage:
+		return "external"
+	case *event.GroupMemberIncrease:
+		return NoticeMemberJoin
+	case *event.GroupMemberDecrease:
+		return NoticeMemberLeave
+	case *GroupLeft:
+		return NoticeBotLeave
+	case *event.GroupRecall:
+		return NoticeGroupRecall
+	case *event.FriendRecall:
+		return NoticeFriendRecall
+	case *event.GroupMute:
+		return NoticeGroupMute
+	case *event.GroupPokeEvent:
+		return NoticeGroupPoke
+	case *event.FriendPokeEvent:
+		return NoticeFriendPoke
+	case *event.GroupInvite:
+		return NoticeGroupInvite
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,304 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/LagrangeDev/LagrangeGo/client"
+	"github.com/LagrangeDev/LagrangeGo/client/event"
+)
+
+// 通知事件的消息类型，用于 MessageTypeMatcher 与 HandleNotice
+const (
+	NoticeMemberJoin   = "member_join"
+	NoticeMemberLeave  = "member_leave"
+	NoticeGroupRecall  = "group_recall"
+	NoticeFriendRecall = "friend_recall"
+	NoticeGroupMute    = "group_mute"
+	NoticeGroupPoke    = "group_poke"
+	NoticeFriendPoke   = "friend_poke"
+	NoticeGroupInvite  = "group_invite"
+	NoticeBotLeave     = "bot_leave"
+)
+
+// 通知事件类型
+const (
+	EventTypeMessageRecalled = "message.recalled"
+	EventTypeUserMuted       = "user.muted"
+	EventTypeUserPoked       = "user.poked"
+	EventTypeGroupInvited    = "group.invited"
+	EventTypeBotLeftGroup    = "group.bot_left"
+)
+
+// GroupLeft 机器人退出或被移出群聊，与成员退群区分
+type GroupLeft struct {
+	*event.GroupMemberDecrease
+}
+
+// setupNoticeListeners 订阅群通知与好友通知事件，交给路由与事件总线处理
+func (lm *LogicManager) setupNoticeListeners() {
+	lm.client.GroupMemberJoinEvent.Subscribe(func(client *client.QQClient, ev *event.GroupMemberIncrease) {
+		ctx := NewMessageContext(client, ev)
+		lm.processNotice(ctx, MemberJoined{Context: ctx, Event: ev})
+	})
+
+	lm.client.GroupMemberLeaveEvent.Subscribe(func(client *client.QQClient, ev *event.GroupMemberDecrease) {
+		ctx := NewMessageContext(client, ev)
+		lm.processNotice(ctx, MemberLeft{Context: ctx, Event: ev})
+	})
+
+	lm.client.GroupLeaveEvent.Subscribe(func(client *client.QQClient, ev *event.GroupMemberDecrease) {
+		ctx := NewMessageContext(client, &GroupLeft{GroupMemberDecrease: ev})
+		lm.processNotice(ctx, BotLeftGroup{Context: ctx, Event: ev})
+	})
+
+	lm.client.GroupRecallEvent.Subscribe(func(client *client.QQClient, ev *event.GroupRecall) {
+		ctx := NewMessageContext(client, ev)
+		lm.processNotice(ctx, MessageRecalled{
+			Context:     ctx,
+			GroupUin:    ev.GroupUin,
+			SenderUin:   ev.UserUin,
+			OperatorUin: ev.OperatorUin,
+			Sequence:    ev.Sequence,
+		})
+	})
+
+	lm.client.FriendRecallEvent.Subscribe(func(client *client.QQClient, ev *event.FriendRecall) {
+		ctx := NewMessageContext(client, ev)
+		lm.processNotice(ctx, MessageRecalled{
+			Context:     ctx,
+			SenderUin:   ev.FromUin,
+			OperatorUin: ev.FromUin,
+			Sequence:    ev.Sequence,
+		})
+	})
+
+	lm.client.GroupMuteEvent.Subscribe(func(client *client.QQClient, ev *event.GroupMute) {
+		ctx := NewMessageContext(client, ev)
+		lm.processNotice(ctx, MemberMuted{Context: ctx, Event: ev})
+	})
+
+	// 通知事件中只处理戳一戳，其它通知暂不转发
+	lm.client.GroupNotifyEvent.Subscribe(func(client *client.QQClient, ev event.INotifyEvent) {
+		poke, ok := ev.(*event.GroupPokeEvent)
+		if !ok {
+			return
+		}
+		ctx := NewMessageContext(client, poke)
+		lm.processNotice(ctx, Poked{
+			Context:  ctx,
+			GroupUin: poke.GroupUin,
+			Sender:   poke.UserUin,
+			Receiver: poke.Receiver,
+			Action:   poke.Action,
+			Suffix:   poke.Suffix,
+		})
+	})
+
+	lm.client.FriendNotifyEvent.Subscribe(func(client *client.QQClient, ev event.INotifyEvent) {
+		poke, ok := ev.(*event.FriendPokeEvent)
+		if !ok {
+			return
+		}
+		ctx := NewMessageContext(client, poke)
+		lm.processNotice(ctx, Poked{
+			Context:  ctx,
+			Sender:   poke.Sender,
+			Receiver: poke.Receiver,
+			Action:   poke.Action,
+			Suffix:   poke.Suffix,
+		})
+	})
+
+	lm.client.GroupInvitedEvent.Subscribe(func(client *client.QQClient, ev *event.GroupInvite) {
+		ctx := NewMessageContext(client, ev)
+		lm.processNotice(ctx, GroupInvited{Context: ctx, Event: ev})
+	})
+}
+
+// processNotice 发布强类型通知事件后交给路由处理
+// 通知不是消息，不发布消息接收与处理完成事件，也不作为等待中问题的回复
+func (lm *LogicManager) processNotice(ctx *MessageContext, payload Payload) {
+	ctx.manager = lm
+	Publish(lm.eventBus, payload)
+	lm.router.Handle(ctx)
+}
+
+// HandleNotice 处理通知事件的便捷方法，noticeType 为 Notice 开头的常量
+func (lm *LogicManager) HandleNotice(noticeType string, handler HandlerFunc, matchers ...Matcher) {
+	route := NewRoute(noticeType, NewHandlerAdapter(handler))
+	route.Match(NewMessageTypeMatcher(noticeType))
+	for _, matcher := range matchers {
+		route.Match(matcher)
+	}
+	lm.AddRoute(route)
+}
+
+// GetMemberJoin 获取成员入群事件
+func (mc *MessageContext) GetMemberJoin() (*event.GroupMemberIncrease, bool) {
+	ev, ok := mc.Message.(*event.GroupMemberIncrease)
+	return ev, ok
+}
+
+// GetMemberLeave 获取成员退群事件，不包含机器人自身退群
+func (mc *MessageContext) GetMemberLeave() (*event.GroupMemberDecrease, bool) {
+	ev, ok := mc.Message.(*event.GroupMemberDecrease)
+	return ev, ok
+}
+
+// GetGroupLeft 获取机器人退出或被移出群聊事件
+func (mc *MessageContext) GetGroupLeft() (*GroupLeft, bool) {
+	ev, ok := mc.Message.(*GroupLeft)
+	return ev, ok
+}
+
+// GetGroupRecall 获取群消息撤回事件
+func (mc *MessageContext) GetGroupRecall() (*event.GroupRecall, bool) {
+	ev, ok := mc.Message.(*event.GroupRecall)
+	return ev, ok
+}
+
+// GetFriendRecall 获取好友消息撤回事件
+func (mc *MessageContext) GetFriendRecall() (*event.FriendRecall, bool) {
+	ev, ok := mc.Message.(*event.FriendRecall)
+	return ev, ok
+}
+
+// GetGroupMute 获取群禁言事件
+func (mc *MessageContext) GetGroupMute() (*event.GroupMute, bool) {
+	ev, ok := mc.Message.(*event.GroupMute)
+	return ev, ok
+}
+
+// GetGroupPoke 获取群戳一戳事件
+func (mc *MessageContext) GetGroupPoke() (*event.GroupPokeEvent, bool) {
+	ev, ok := mc.Message.(*event.GroupPokeEvent)
+	return ev, ok
+}
+
+// GetFriendPoke 获取好友戳一戳事件
+func (mc *MessageContext) GetFriendPoke() (*event.FriendPokeEvent, bool) {
+	ev, ok := mc.Message.(*event.FriendPokeEvent)
+	return ev, ok
+}
+
+// GetGroupInvite 获取入群邀请事件
+func (mc *MessageContext) GetGroupInvite() (*event.GroupInvite, bool) {
+	ev, ok := mc.Message.(*event.GroupInvite)
+	return ev, ok
+}
+
+// NoticeGroupUin 群通知事件所在的群，机器人退群与入群邀请不属于已加入的群，返回 false
+func (mc *MessageContext) NoticeGroupUin() (uint32, bool) {
+	switch ev := mc.Message.(type) {
+	case *event.GroupMemberIncrease:
+		return ev.GroupUin, true
+	case *event.GroupMemberDecrease:
+		return ev.GroupUin, true
+	case *event.GroupRecall:
+		return ev.GroupUin, true
+	case *event.GroupMute:
+		return ev.GroupUin, true
+	case *event.GroupPokeEvent:
+		return ev.GroupUin, true
+	}
+	return 0, false
+}
+
+// noticeFriendUin 好友通知事件的好友QQ号
+func (mc *MessageContext) noticeFriendUin() (uint32, bool) {
+	switch ev := mc.Message.(type) {
+	case *event.FriendRecall:
+		return ev.FromUin, true
+	case *event.FriendPokeEvent:
+		return ev.Sender, true
+	}
+	return 0, false
+}
+
+// noticeOrderKey 通知事件的顺序键，与所在会话的消息保持顺序
+func noticeOrderKey(ctx *MessageContext) string {
+	if ctx == nil {
+		return ""
+	}
+	if groupUin, ok := ctx.NoticeGroupUin(); ok {
+		return fmt.Sprintf("%s:%d", GroupMsg, groupUin)
+	}
+	if uin, ok := ctx.noticeFriendUin(); ok {
+		return fmt.Sprintf("%s:%d", PrivateMsg, uin)
+	}
+	return ""
+}
+
+// MemberJoined 群成员入群
+type MemberJoined struct {
+	Context *MessageContext
+	Event   *event.GroupMemberIncrease
+}
+
+func (MemberJoined) EventType() string  { return EventTypeUserJoined }
+func (e MemberJoined) OrderKey() string { return noticeOrderKey(e.Context) }
+
+// MemberLeft 群成员退群或被移出群聊
+type MemberLeft struct {
+	Context *MessageContext
+	Event   *event.GroupMemberDecrease
+}
+
+func (MemberLeft) EventType() string  { return EventTypeUserLeft }
+func (e MemberLeft) OrderKey() string { return noticeOrderKey(e.Context) }
+
+// Kicked 是否被移出群聊
+func (e MemberLeft) Kicked() bool { return e.Event.IsKicked() }
+
+// BotLeftGroup 机器人退出或被移出群聊
+type BotLeftGroup struct {
+	Context *MessageContext
+	Event   *event.GroupMemberDecrease
+}
+
+func (BotLeftGroup) EventType() string { return EventTypeBotLeftGroup }
+
+// Kicked 是否被移出群聊
+func (e BotLeftGroup) Kicked() bool { return e.Event.IsKicked() }
+
+// MessageRecalled 消息被撤回，GroupUin 为0时为好友消息
+type MessageRecalled struct {
+	Context     *MessageContext
+	GroupUin    uint32
+	SenderUin   uint32
+	OperatorUin uint32
+	Sequence    uint64
+}
+
+func (MessageRecalled) EventType() string  { return EventTypeMessageRecalled }
+func (e MessageRecalled) OrderKey() string { return noticeOrderKey(e.Context) }
+
+// MemberMuted 群成员被禁言或解除禁言，全员禁言时 Event.MuteAll 为 true
+type MemberMuted struct {
+	Context *MessageContext
+	Event   *event.GroupMute
+}
+
+func (MemberMuted) EventType() string  { return EventTypeUserMuted }
+func (e MemberMuted) OrderKey() string { return noticeOrderKey(e.Context) }
+
+// Poked 戳一戳，GroupUin 为0时为好友戳一戳
+type Poked struct {
+	Context  *MessageContext
+	GroupUin uint32
+	Sender   uint32
+	Receiver uint32
+	Action   string
+	Suffix   string
+}
+
+func (Poked) EventType() string  { return EventTypeUserPoked }
+func (e Poked) OrderKey() string { return noticeOrderKey(e.Context) }
+
+// GroupInvited 机器人被邀请入群
+type GroupInvited struct {
+	Context *MessageContext
+	Event   *event.GroupInvite
+}
+
+func (GroupInvited) EventType() string { return EventTypeGroupInvited }
@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LagrangeDev/LagrangeGo/client/event"
+)
+
+func TestProcessNoticeSkipsMessageEvents(t *testing.T) {
+	// 单个工作协程按发布顺序处理事件，收到哨兵事件时之前的事件都已处理
+	bus := NewEventBusWithOptions(EventBusOptions{Workers: 1})
+	defer bus.Close()
+	lm := NewLogicManager(nil, WithEventBus(bus))
+
+	routed := 0
+	lm.HandleNotice(NoticeGroupPoke, func(ctx *MessageContext) error {
+		routed++
+		return nil
+	})
+
+	var got []string
+	done := make(chan struct{})
+	bus.Subscribe("*", func(ctx context.Context, ev Event) error {
+		if ev.GetType() == "test.sentinel" {
+			close(done)
+			return nil
+		}
+		got = append(got, ev.GetType())
+		return nil
+	})
+
+	poke := &event.GroupPokeEvent{GroupEvent: event.GroupEvent{GroupUin: 1, UserUin: 2}, Receiver: 3, Action: "戳了戳"}
+	ctx := NewMessageContext(nil, poke)
+	lm.processNotice(ctx, Poked{Context: ctx, GroupUin: poke.GroupUin, Sender: poke.UserUin, Receiver: poke.Receiver})
+	bus.Publish(NewEvent("test.sentinel", nil))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("等待事件超时")
+	}
+	if routed != 1 {
+		t.Errorf("通知路由执行了 %d 次, want 1", routed)
+	}
+	if len(got) != 1 || got[0] != EventTypeUserPoked {
+		t.Errorf("发布的事件 = %v, want [%s]", got, EventTypeUserPoked)
+	}
+}
@@ -0,0 +1,177 @@
+package logic
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitIdle 限流记录的默认空闲清理时间
+const DefaultRateLimitIdle = 10 * time.Minute
+
+// RateLimit 令牌桶限流规则，每 Interval 恢复一个令牌，最多积累 Burst 个
+// Burst 为1时即为冷却时间为 Interval 的冷却
+type RateLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// fullAfter 令牌从空恢复到满所需的时间
+func (l RateLimit) fullAfter() time.Duration {
+	return time.Duration(l.Burst) * l.Interval
+}
+
+// tokenBucket 单个限流键的令牌桶
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter 并发安全的令牌桶限流器，长时间未使用的限流键会被清理
+type RateLimiter struct {
+	limit RateLimit
+	idle  time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter 创建限流器，idle 为0时使用 DefaultRateLimitIdle
+func NewRateLimiter(limit RateLimit, idle time.Duration) *RateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	if idle <= 0 {
+		idle = DefaultRateLimitIdle
+	}
+	return &RateLimiter{
+		limit:     limit,
+		idle:      idle,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Limit 限流规则
+func (l *RateLimiter) Limit() RateLimit {
+	return l.limit
+}
+
+// Allow 消耗一个令牌，令牌不足时返回 false 与恢复一个令牌还需等待的时间
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.limit.Interval <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.updated)
+		b.tokens = math.Min(float64(l.limit.Burst), b.tokens+float64(elapsed)/float64(l.limit.Interval))
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) * float64(l.limit.Interval))
+	return false, wait
+}
+
+// Len 当前记录的限流键数量
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweepLocked 每隔 idle 清理一次空闲的限流键
+// 空闲时间超过令牌恢复满所需时间的键与新键等价，可以直接删除
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idle {
+		return
+	}
+	l.lastSweep = now
+	expire := max(l.idle, l.limit.fullAfter())
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= expire {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitScope 限流范围
+type RateLimitScope string
+
+const (
+	RateLimitUser   RateLimitScope = "user"   // 每个用户单独限流
+	RateLimitGroup  RateLimitScope = "group"  // 每个群单独限流，私聊按用户限流
+	RateLimitGlobal RateLimitScope = "global" // 所有人共用
+)
+
+// ParseRateLimitScope 解析限流范围，为空时为 user
+func ParseRateLimitScope(s string) (RateLimitScope, error) {
+	switch scope := RateLimitScope(s); scope {
+	case "":
+		return RateLimitUser, nil
+	case RateLimitUser, RateLimitGroup, RateLimitGlobal:
+		return scope, nil
+	}
+	return "", fmt.Errorf("未知的限流范围 %s，可选: user, group, global", s)
+}
+
+// RateLimitKey 消息在限流范围内的键，没有发送者的消息不限流
+func RateLimitKey(ctx *MessageContext, scope RateLimitScope) (string, bool) {
+	key, ok := SessionKeyOf(ctx)
+	if !ok {
+		return "", false
+	}
+	platform := "qq"
+	if ext, ok := ctx.GetExternalMessage(); ok {
+		platform = ext.Platform()
+	}
+	switch scope {
+	case RateLimitGlobal:
+		return "global", true
+	case RateLimitGroup:
+		return key.Type + ":" + key.ID, true
+	default:
+		return platform + ":" + key.Sender, true
+	}
+}
+
+// RateLimitWith 使用指定限流器的中间件，超出限制时返回 reject 生成的错误
+func RateLimitWith(limiter *RateLimiter, scope RateLimitScope, reject func(wait time.Duration) error) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *MessageContext) error {
+			key, ok := RateLimitKey(ctx, scope)
+			if !ok {
+				return next(ctx)
+			}
+			if allowed, wait := limiter.Allow(key); !allowed {
+				return reject(wait)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// Cooldown 命令冷却规则
+type Cooldown struct {
+	Scope RateLimitScope
+	RateLimit
+}
+
+// cooldownError 冷却中的提示，剩余时间向上取整到秒
+func cooldownError(wait time.Duration) error {
+	return NewUserError(ErrorKindRateLimit, "冷却中，还剩 %d 秒", int(math.Ceil(wait.Seconds())))
+}
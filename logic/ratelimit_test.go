@@ -0,0 +1,143 @@
+package logic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit RateLimit
+		calls int
+		want  []bool
+	}{
+		{"冷却", RateLimit{Burst: 1, Interval: time.Hour}, 3, []bool{true, false, false}},
+		{"突发", RateLimit{Burst: 3, Interval: time.Hour}, 4, []bool{true, true, true, false}},
+		{"Burst为0按1处理", RateLimit{Burst: 0, Interval: time.Hour}, 2, []bool{true, false}},
+		{"间隔为0不限制", RateLimit{Burst: 1, Interval: 0}, 3, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.limit, 0)
+			for i := 0; i < tt.calls; i++ {
+				allowed, wait := limiter.Allow("user")
+				if allowed != tt.want[i] {
+					t.Fatalf("第 %d 次 Allow = %v, want %v", i, allowed, tt.want[i])
+				}
+				if allowed && wait != 0 {
+					t.Fatalf("第 %d 次允许时 wait = %v, want 0", i, wait)
+				}
+				if !allowed && (wait <= 0 || wait > tt.limit.Interval) {
+					t.Fatalf("第 %d 次拒绝时 wait = %v, 应在 (0, %v] 内", i, wait, tt.limit.Interval)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterKeysAreIndependent(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Burst: 1, Interval: time.Hour}, 0)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatal("a 第一次应允许")
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Fatal("b 不应受 a 影响")
+	}
+	if ok, _ := limiter.Allow("a"); ok {
+		t.Fatal("a 第二次应拒绝")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Burst: 2, Interval: time.Minute}, 0)
+	limiter.Allow("user")
+	limiter.Allow("user")
+	if ok, _ := limiter.Allow("user"); ok {
+		t.Fatal("令牌耗尽后应拒绝")
+	}
+
+	// 模拟经过一个间隔，恢复一个令牌
+	limiter.buckets["user"].updated = time.Now().Add(-time.Minute)
+	if ok, _ := limiter.Allow("user"); !ok {
+		t.Fatal("恢复一个令牌后应允许")
+	}
+	if ok, _ := limiter.Allow("user"); ok {
+		t.Fatal("只恢复了一个令牌")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Burst: 1, Interval: time.Second}, time.Minute)
+	limiter.Allow("idle")
+	limiter.Allow("active")
+
+	now := time.Now()
+	limiter.lastSweep = now.Add(-time.Minute)
+	limiter.buckets["idle"].updated = now.Add(-2 * time.Minute)
+	limiter.Allow("active")
+
+	if limiter.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", limiter.Len())
+	}
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Fatal("空闲的限流键应被清理")
+	}
+}
+
+func TestRateLimiterSweepKeepsUnrecoveredKeys(t *testing.T) {
+	// 令牌恢复满需要 1 小时，空闲 2 分钟的键不能删除，否则会绕过限流
+	limiter := NewRateLimiter(RateLimit{Burst: 1, Interval: time.Hour}, time.Minute)
+	limiter.Allow("user")
+
+	now := time.Now()
+	limiter.lastSweep = now.Add(-time.Minute)
+	limiter.buckets["user"].updated = now.Add(-2 * time.Minute)
+	if ok, _ := limiter.Allow("user"); ok {
+		t.Fatal("冷却未结束时应拒绝")
+	}
+}
+
+func TestParseRateLimitScope(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RateLimitScope
+		wantErr bool
+	}{
+		{"", RateLimitUser, false},
+		{"user", RateLimitUser, false},
+		{"group", RateLimitGroup, false},
+		{"global", RateLimitGlobal, false},
+		{"channel", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRateLimitScope(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRateLimitScope(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRateLimitScope(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCooldownError(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{1500 * time.Millisecond, "冷却中，还剩 2 秒"},
+		{time.Second, "冷却中，还剩 1 秒"},
+		{10 * time.Millisecond, "冷却中，还剩 1 秒"},
+	}
+	for _, tt := range tests {
+		err := cooldownError(tt.wait)
+		if err.Error() != tt.want {
+			t.Errorf("cooldownError(%v) = %q, want %q", tt.wait, err.Error(), tt.want)
+		}
+		if ue, ok := AsUserError(err); !ok || ue.Kind != ErrorKindRateLimit {
+			t.Errorf("cooldownError(%v) 应为限流类型的用户错误", tt.wait)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+
+	"llma.dev/utils/llog"
+)
+
+// Role 用户角色，数值越大权限越高，高级角色拥有低级角色的全部权限
+type Role int
+
+const (
+	RoleMember   Role = iota // 普通成员
+	RoleOperator             // 操作员
+	RoleAdmin                // 管理员
+	RoleOwner                // 所有者
+)
+
+// roleNames 角色的配置名称与显示名称
+var roleNames = []struct {
+	name    string
+	display string
+}{
+	RoleMember:   {"member", "成员"},
+	RoleOperator: {"operator", "操作员"},
+	RoleAdmin:    {"admin", "管理员"},
+	RoleOwner:    {"owner", "所有者"},
+}
+
+// String 角色的配置名称，如 admin
+func (r Role) String() string {
+	if r < RoleMember || r > RoleOwner {
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+	return roleNames[r].name
+}
+
+// DisplayName 角色的显示名称，如 管理员
+func (r Role) DisplayName() string {
+	if r < RoleMember || r > RoleOwner {
+		return r.String()
+	}
+	return roleNames[r].display
+}
+
+// Roles 全部角色，按权限从低到高排列
+func Roles() []Role {
+	return []Role{RoleMember, RoleOperator, RoleAdmin, RoleOwner}
+}
+
+// ParseRole 解析角色名称，支持配置名称与显示名称
+func ParseRole(s string) (Role, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, r := range Roles() {
+		if s == roleNames[r].name || s == roleNames[r].display {
+			return r, nil
+		}
+	}
+	return RoleMember, fmt.Errorf("未知角色 %s，可选: member, operator, admin, owner", s)
+}
+
+// RoleResolver 获取消息发送者的角色
+type RoleResolver func(ctx *MessageContext) Role
+
+// RoleMiddleware 角色中间件，发送者角色低于 required 时拒绝执行
+func RoleMiddleware(required Role, resolve RoleResolver) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *MessageContext) error {
+			role := resolve(ctx)
+			if role < required {
+				llog.Warningf("[lagrange.中间件] 角色为 %s 的用户尝试执行需要 %s 的命令", role, required)
+				return NewUserError(ErrorKindPermission, "无权限访问，需要%s及以上角色", required.DisplayName())
+			}
+			ctx.Set("role", role)
+			ctx.Set("authorized", true)
+			return next(ctx)
+		}
+	}
+}
@@ -2,10 +2,9 @@ package logic
 
 import (
 	"context"
-	"fmt"
+	"slices"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/LagrangeDev/LagrangeGo/client"
 	"github.com/LagrangeDev/LagrangeGo/client/event"
@@ -19,6 +18,9 @@ type MessageContext struct {
 	Message  any
 	Metadata map[string]any
 	ctx      context.Context
+	consumed bool
+	// manager 处理该消息的逻辑管理器
+	manager *LogicManager
 }
 
 // NewMessageContext 创建新的消息上下文
@@ -42,6 +44,16 @@ func (mc *MessageContext) WithContext(ctx context.Context) *MessageContext {
 	return mc
 }
 
+// Consume 标记消息已被处理，优先级更低的路由将不再执行
+func (mc *MessageContext) Consume() {
+	mc.consumed = true
+}
+
+// IsConsumed 消息是否已被处理
+func (mc *MessageContext) IsConsumed() bool {
+	return mc.consumed
+}
+
 // Set 设置元数据
 func (mc *MessageContext) Set(key string, value any) {
 	mc.Metadata[key] = value
@@ -87,6 +99,28 @@ func (mc *MessageContext) GetFriendRequest() (*event.NewFriendRequest, bool) {
 	return nil, false
 }
 
+// ExternalMessage QQ以外的消息来源，如游戏内聊天
+type ExternalMessage interface {
+	// Platform 来源平台，如 dst
+	Platform() string
+	// Text 消息文本
+	Text() string
+	// SenderID 发送者在来源平台的标识
+	SenderID() string
+	// SenderName 发送者名称
+	SenderName() string
+	// Reply 回复消息
+	Reply(elements []message.IMessageElement)
+}
+
+// GetExternalMessage 获取外部来源消息
+func (mc *MessageContext) GetExternalMessage() (ExternalMessage, bool) {
+	if msg, ok := mc.Message.(ExternalMessage); ok {
+		return msg, true
+	}
+	return nil, false
+}
+
 // GetMessageText 获取消息文本内容
 func (mc *MessageContext) GetMessageText() string {
 	if privateMsg, ok := mc.GetPrivateMessage(); ok {
@@ -95,6 +129,9 @@ func (mc *MessageContext) GetMessageText() string {
 	if groupMsg, ok := mc.GetGroupMessage(); ok {
 		return extractTextFromElements(groupMsg.Elements)
 	}
+	if externalMsg, ok := mc.GetExternalMessage(); ok {
+		return externalMsg.Text()
+	}
 	return ""
 }
 
@@ -106,6 +143,26 @@ func (mc *MessageContext) Reply(elements []message.IMessageElement) {
 	if groupMsg, ok := mc.GetGroupMessage(); ok {
 		mc.Client.SendGroupMessage(groupMsg.GroupUin, elements)
 	}
+	if externalMsg, ok := mc.GetExternalMessage(); ok {
+		externalMsg.Reply(elements)
+	}
+	// 通知事件回复到所在群或好友
+	if groupUin, ok := mc.NoticeGroupUin(); ok {
+		mc.Client.SendGroupMessage(groupUin, elements)
+	}
+	if uin, ok := mc.noticeFriendUin(); ok {
+		mc.Client.SendPrivateMessage(uin, elements)
+	}
+}
+
+// QuoteReply 回复消息，群聊中引用原消息，其它会话与 Reply 相同
+func (mc *MessageContext) QuoteReply(elements []message.IMessageElement) {
+	if groupMsg, ok := mc.GetGroupMessage(); ok {
+		quoted := append([]message.IMessageElement{message.NewGroupReply(groupMsg)}, elements...)
+		mc.Client.SendGroupMessage(groupMsg.GroupUin, quoted)
+		return
+	}
+	mc.Reply(elements)
 }
 
 // extractTextFromElements 从消息元素中提取文本
@@ -119,73 +176,6 @@ func extractTextFromElements(elements []message.IMessageElement) string {
 	return strings.Join(textParts, "")
 }
 
-// 等待用户确认
-func (ctx *MessageContext) Prompt(actionName string, timeout time.Duration, confirmFunc func(), cancelFunc func()) {
-	if actionName == "" {
-		actionName = "未知操作"
-	}
-	ctx.Reply([]message.IMessageElement{message.NewText(fmt.Sprintf("你正在执行 %s 请在 %s 内发送“确认”以执行操作", actionName, timeout.String()))})
-
-	// 计算期望的会话标识
-	var sm *SessionMatcher
-
-	if pm, ok := ctx.GetPrivateMessage(); ok {
-		sm = NewSessionMatcher(PrivateMsg, pm.Sender.Uin, pm.Sender.Uin)
-	}
-	if gm, ok := ctx.GetGroupMessage(); ok {
-		sm = NewSessionMatcher(GroupMsg, gm.GroupUin, gm.Sender.Uin)
-	}
-
-	decisionChan := make(chan string, 1)
-	// 事件处理器：仅同会话消息，且文本匹配确认/取消时生效
-	handler := func(_ context.Context, event Event) error {
-		msgEvent, ok := event.(*MessageEvent)
-		if !ok {
-			llog.Errorf("[router.prompt] Event解析错误")
-			return nil
-		}
-		mc := msgEvent.MessageContext
-		if !sm.Match(mc) {
-			return nil
-		}
-
-		text := strings.TrimSpace(strings.ToLower(mc.GetMessageText()))
-		switch text {
-		case "确认":
-			select {
-			case decisionChan <- "confirm":
-			default:
-			}
-		default:
-			select {
-			case decisionChan <- "cancel":
-			default:
-			}
-		}
-		return nil
-	}
-
-	GlobalEventBus.Subscribe(EventTypeMessageReceived, handler)
-
-	var decision string
-	select {
-	case decision = <-decisionChan:
-	case <-time.After(timeout):
-		decision = "timeout"
-	}
-
-	GlobalEventBus.Unsubscribe(EventTypeMessageReceived, handler)
-
-	switch decision {
-	case "confirm":
-		confirmFunc()
-	case "cancel":
-		cancelFunc()
-	case "timeout":
-		ctx.Reply([]message.IMessageElement{message.NewText(fmt.Sprintf("等待超时，已取消 %s 操作", actionName))})
-	}
-}
-
 // HandlerFunc 处理器函数类型
 type HandlerFunc func(ctx *MessageContext) error
 
@@ -212,6 +202,13 @@ func (ha *HandlerAdapter) Handle(ctx *MessageContext) error {
 	return ha.handler(ctx)
 }
 
+// 路由优先级，数值越大越先执行
+const (
+	PriorityLow     = -100 // 兜底路由，如转发全部消息
+	PriorityDefault = 0    // 默认优先级
+	PriorityCommand = 100  // 命令路由
+)
+
 // Route 路由结构
 type Route struct {
 	Name        string
@@ -219,6 +216,10 @@ type Route struct {
 	Handler     Handler
 	Middlewares []Middleware
 	Matchers    []Matcher
+	// Priority 优先级，数值越大越先执行，相同优先级按注册顺序执行
+	Priority int
+	// Terminal 为 true 时路由匹配后即标记消息已处理，无论处理器是否执行成功
+	Terminal bool
 }
 
 // NewRoute 创建新路由
@@ -243,6 +244,18 @@ func (r *Route) Match(matcher Matcher) *Route {
 	return r
 }
 
+// SetPriority 设置优先级
+func (r *Route) SetPriority(priority int) *Route {
+	r.Priority = priority
+	return r
+}
+
+// SetTerminal 设置路由匹配后是否阻止后续路由执行
+func (r *Route) SetTerminal(terminal bool) *Route {
+	r.Terminal = terminal
+	return r
+}
+
 // SetPattern 设置模式
 func (r *Route) SetPattern(pattern string) *Route {
 	r.Pattern = pattern
@@ -299,6 +312,10 @@ func (router *Router) AddRoute(route *Route) *Router {
 	router.mu.Lock()
 	defer router.mu.Unlock()
 	router.routes = append(router.routes, route)
+	// 稳定排序，相同优先级保持注册顺序
+	slices.SortStableFunc(router.routes, func(a, b *Route) int {
+		return b.Priority - a.Priority
+	})
 	return router
 }
 
@@ -311,8 +328,12 @@ func (router *Router) Handle(ctx *MessageContext) {
 	copy(middlewares, router.middlewares)
 	router.mu.RUnlock()
 
-	// 为每个路由执行处理
+	// 按优先级为每个路由执行处理，消息被标记为已处理后停止
 	for _, route := range routes {
+		if ctx.IsConsumed() {
+			break
+		}
+
 		// 创建完整的中间件链（全局中间件 + 路由中间件）
 		handler := route.Handler.Handle
 
@@ -336,6 +357,9 @@ func (router *Router) Handle(ctx *MessageContext) {
 		}
 
 		if matched {
+			if route.Terminal {
+				ctx.Consume()
+			}
 			if err := handler(ctx); err != nil {
 				router.errorHandler(err, ctx)
 			}
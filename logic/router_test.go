@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+)
+
+// recordRoute 执行时记录路由名称的路由
+func recordRoute(name string, trace *[]string, fn func(ctx *MessageContext) error) *Route {
+	return NewRoute(name, NewHandlerAdapter(func(ctx *MessageContext) error {
+		*trace = append(*trace, name)
+		if fn != nil {
+			return fn(ctx)
+		}
+		return nil
+	}))
+}
+
+func TestRouterPriorityOrder(t *testing.T) {
+	router := NewRouter()
+	var trace []string
+	router.AddRoute(recordRoute("low", &trace, nil).SetPriority(PriorityLow))
+	router.AddRoute(recordRoute("default-1", &trace, nil))
+	router.AddRoute(recordRoute("command", &trace, nil).SetPriority(PriorityCommand))
+	router.AddRoute(recordRoute("default-2", &trace, nil))
+	router.AddRoute(recordRoute("unmatched", &trace, nil).SetPriority(PriorityCommand).
+		Match(NewCustomMatcher(func(*MessageContext) bool { return false })))
+
+	router.Handle(NewMessageContext(nil, &message.PrivateMessage{}))
+	// 优先级高的先执行，相同优先级按注册顺序
+	want := []string{"command", "default-1", "default-2", "low"}
+	if !slices.Equal(trace, want) {
+		t.Errorf("执行顺序 = %v, want %v", trace, want)
+	}
+}
+
+func TestRouterConsume(t *testing.T) {
+	var handled []error
+	newRouter := func(trace *[]string) *Router {
+		router := NewRouter()
+		router.SetErrorHandler(func(err error, ctx *MessageContext) { handled = append(handled, err) })
+		router.AddRoute(recordRoute("forward", trace, nil).SetPriority(PriorityLow))
+		return router
+	}
+	errFailed := errors.New("命令执行失败")
+
+	t.Run("处理器标记已处理", func(t *testing.T) {
+		var trace []string
+		router := newRouter(&trace)
+		router.AddRoute(recordRoute("keyword", &trace, func(ctx *MessageContext) error {
+			ctx.Consume()
+			return nil
+		}))
+		ctx := NewMessageContext(nil, &message.PrivateMessage{})
+		router.Handle(ctx)
+		if !slices.Equal(trace, []string{"keyword"}) || !ctx.IsConsumed() {
+			t.Errorf("trace = %v, consumed = %v", trace, ctx.IsConsumed())
+		}
+	})
+
+	t.Run("终止路由出错也不再转发", func(t *testing.T) {
+		var trace []string
+		handled = nil
+		router := newRouter(&trace)
+		router.AddRoute(recordRoute("command", &trace, func(*MessageContext) error { return errFailed }).
+			SetPriority(PriorityCommand).SetTerminal(true))
+		router.Handle(NewMessageContext(nil, &message.PrivateMessage{}))
+		if !slices.Equal(trace, []string{"command"}) {
+			t.Errorf("trace = %v, want [command]", trace)
+		}
+		if len(handled) != 1 || !errors.Is(handled[0], errFailed) {
+			t.Errorf("错误处理器收到 %v", handled)
+		}
+	})
+
+	t.Run("未匹配的终止路由不阻止转发", func(t *testing.T) {
+		var trace []string
+		router := newRouter(&trace)
+		router.AddRoute(recordRoute("command", &trace, nil).SetPriority(PriorityCommand).SetTerminal(true).
+			Match(NewMessageTypeMatcher("group")))
+		router.Handle(NewMessageContext(nil, &message.PrivateMessage{}))
+		if !slices.Equal(trace, []string{"forward"}) {
+			t.Errorf("trace = %v, want [forward]", trace)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package logic
+
+import (
+	"context"
+
+	"github.com/LagrangeDev/LagrangeGo/client"
+)
+
+// Payload 强类型事件的载荷，EventType 返回事件类型，应为值类型以便零值也能返回事件类型
+// 载荷实现 OrderKey() string 时，相同键的事件按发布顺序处理
+type Payload interface {
+	EventType() string
+}
+
+// TypedEvent 携带强类型载荷的事件，GetData 返回载荷，字符串订阅同样可以收到
+type TypedEvent[T Payload] struct {
+	*BaseEvent
+	Payload T
+}
+
+// OrderKey 使用载荷的顺序键
+func (e *TypedEvent[T]) OrderKey() string {
+	if keyed, ok := any(e.Payload).(interface{ OrderKey() string }); ok {
+		return keyed.OrderKey()
+	}
+	return ""
+}
+
+// NewTypedEvent 创建强类型事件
+func NewTypedEvent[T Payload](payload T) *TypedEvent[T] {
+	return &TypedEvent[T]{
+		BaseEvent: NewEvent(payload.EventType(), payload),
+		Payload:   payload,
+	}
+}
+
+// PayloadOf 获取事件的强类型载荷
+func PayloadOf[T Payload](event Event) (T, bool) {
+	payload, ok := event.GetData().(T)
+	return payload, ok
+}
+
+// Publish 异步发布强类型事件
+func Publish[T Payload](bus *EventBus, payload T) {
+	bus.Publish(NewTypedEvent(payload))
+}
+
+// PublishSync 同步发布强类型事件
+func PublishSync[T Payload](bus *EventBus, payload T) error {
+	return bus.PublishSync(NewTypedEvent(payload))
+}
+
+// Subscribe 订阅强类型事件，如 Subscribe(bus, func(ctx context.Context, e CommandExecuted) error {...})
+// 同类型但载荷不是 T 的事件会被忽略
+func Subscribe[T Payload](bus *EventBus, handler func(ctx context.Context, payload T) error, opts ...SubscribeOption) *Subscription {
+	pattern, wrapped, opts := typedSubscription(handler, opts)
+	return bus.Subscribe(pattern, wrapped, opts...)
+}
+
+// SubscribeOnce 订阅强类型事件，处理第一个事件后自动取消
+func SubscribeOnce[T Payload](bus *EventBus, handler func(ctx context.Context, payload T) error, opts ...SubscribeOption) *Subscription {
+	pattern, wrapped, opts := typedSubscription(handler, opts)
+	return bus.SubscribeOnce(pattern, wrapped, opts...)
+}
+
+// typedSubscription 将强类型处理器转换为字符串订阅
+func typedSubscription[T Payload](handler func(ctx context.Context, payload T) error, opts []SubscribeOption) (string, EventHandler, []SubscribeOption) {
+	var zero T
+	opts = append([]SubscribeOption{WithFilter(func(event Event) bool {
+		_, ok := PayloadOf[T](event)
+		return ok
+	})}, opts...)
+	return zero.EventType(), func(ctx context.Context, event Event) error {
+		payload, _ := PayloadOf[T](event)
+		return handler(ctx, payload)
+	}, opts
+}
+
+// MessageReceived 收到消息，在路由处理之前发布
+type MessageReceived struct {
+	Context *MessageContext
+}
+
+func (MessageReceived) EventType() string  { return EventTypeMessageReceived }
+func (e MessageReceived) OrderKey() string { return sessionOrderKey(e.Context) }
+
+// MessageProcessed 消息处理完成
+type MessageProcessed struct {
+	Context *MessageContext
+}
+
+func (MessageProcessed) EventType() string  { return EventTypeMessageProcessed }
+func (e MessageProcessed) OrderKey() string { return sessionOrderKey(e.Context) }
+
+// CommandExecuted 命令执行成功
+type CommandExecuted struct {
+	Context *MessageContext
+	// Command 命令完整名称，子命令为 "命令 子命令"
+	Command string
+	Args    Args
+}
+
+func (CommandExecuted) EventType() string  { return EventTypeCommandExecuted }
+func (e CommandExecuted) OrderKey() string { return sessionOrderKey(e.Context) }
+
+// BotConnected QQ连接已建立
+type BotConnected struct{}
+
+func (BotConnected) EventType() string { return EventTypeBotConnected }
+
+// BotDisconnected QQ连接已断开
+type BotDisconnected struct {
+	Reason string
+}
+
+func (BotDisconnected) EventType() string { return EventTypeBotDisconnected }
+
+// BotReconnecting 正在重连
+type BotReconnecting struct {
+	Attempt int
+}
+
+func (BotReconnecting) EventType() string { return EventTypeBotReconnecting }
+
+// BotReconnectFailed 重连失败
+type BotReconnectFailed struct {
+	MaxAttempts int
+}
+
+func (BotReconnectFailed) EventType() string { return EventTypeBotReconnectFailed }
+
+// ConnectionEventPublisher 将连接状态变化发布到事件总线，实现 bot.ConnectionEventHandler
+type ConnectionEventPublisher struct {
+	bus *EventBus
+}
+
+// NewConnectionEventPublisher 创建连接事件发布器
+func NewConnectionEventPublisher(bus *EventBus) *ConnectionEventPublisher {
+	return &ConnectionEventPublisher{bus: bus}
+}
+
+func (p *ConnectionEventPublisher) OnConnected(_ *client.QQClient) {
+	Publish(p.bus, BotConnected{})
+}
+
+func (p *ConnectionEventPublisher) OnDisconnected(_ *client.QQClient, reason string) {
+	Publish(p.bus, BotDisconnected{Reason: reason})
+}
+
+func (p *ConnectionEventPublisher) OnReconnecting(_ *client.QQClient, attempt int) {
+	Publish(p.bus, BotReconnecting{Attempt: attempt})
+}
+
+func (p *ConnectionEventPublisher) OnReconnectFailed(_ *client.QQClient, maxAttempts int) {
+	Publish(p.bus, BotReconnectFailed{MaxAttempts: maxAttempts})
+}
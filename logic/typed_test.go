@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// playerJoined 与 playerLeft 测试用载荷，共用同一个事件类型
+type playerJoined struct{ Name string }
+
+func (playerJoined) EventType() string  { return "game.player" }
+func (e playerJoined) OrderKey() string { return "player:" + e.Name }
+
+type playerLeft struct{ Name string }
+
+func (playerLeft) EventType() string { return "game.player" }
+
+func TestTypedSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	var joined []string
+	Subscribe(bus, func(ctx context.Context, e playerJoined) error {
+		joined = append(joined, e.Name)
+		return nil
+	})
+	var untyped []any
+	bus.Subscribe("game.*", func(ctx context.Context, event Event) error {
+		untyped = append(untyped, event.GetData())
+		return nil
+	})
+
+	PublishSync(bus, playerJoined{Name: "wilson"})
+	PublishSync(bus, playerLeft{Name: "willow"})
+
+	// 强类型订阅只收到自己的载荷类型，字符串订阅收到同类型的全部事件
+	if len(joined) != 1 || joined[0] != "wilson" {
+		t.Errorf("joined = %v, want [wilson]", joined)
+	}
+	if len(untyped) != 2 {
+		t.Fatalf("untyped = %v, want 2 个事件", untyped)
+	}
+	if left, ok := PayloadOf[playerLeft](NewEvent("game.player", untyped[1])); !ok || left.Name != "willow" {
+		t.Errorf("PayloadOf[playerLeft] = %+v, %v", left, ok)
+	}
+	if _, ok := PayloadOf[playerJoined](NewEvent("game.player", untyped[1])); ok {
+		t.Error("载荷类型不同时 PayloadOf 应返回 false")
+	}
+}
+
+func TestTypedEventOrderKeyAndErrors(t *testing.T) {
+	if key := NewTypedEvent(playerJoined{Name: "wilson"}).OrderKey(); key != "player:wilson" {
+		t.Errorf("OrderKey = %q, want player:wilson", key)
+	}
+	if key := NewTypedEvent(playerLeft{Name: "wilson"}).OrderKey(); key != "" {
+		t.Errorf("没有顺序键的载荷 OrderKey = %q, want 空", key)
+	}
+
+	bus := NewEventBus()
+	defer bus.Close()
+	errRejected := errors.New("拒绝")
+	SubscribeOnce(bus, func(ctx context.Context, e playerLeft) error { return errRejected })
+	if err := PublishSync(bus, playerLeft{Name: "wilson"}); !errors.Is(err, errRejected) {
+		t.Errorf("PublishSync err = %v, want %v", err, errRejected)
+	}
+	if err := PublishSync(bus, playerLeft{Name: "wilson"}); err != nil {
+		t.Errorf("一次性订阅已取消, PublishSync err = %v", err)
+	}
+}
+
+func TestConnectionEventPublisher(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	got := make(chan BotDisconnected, 1)
+	Subscribe(bus, func(ctx context.Context, e BotDisconnected) error {
+		got <- e
+		return nil
+	})
+	NewConnectionEventPublisher(bus).OnDisconnected(nil, "网络错误")
+
+	select {
+	case e := <-got:
+		if e.Reason != "网络错误" {
+			t.Errorf("Reason = %q", e.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("没有收到断开连接事件")
+	}
+}
@@ -22,6 +22,9 @@ func main() {
 	bot := container.GetBot()
 	logicManager := container.GetLogicManager()
 
+	// 连接状态变化发布到事件总线
+	bot.GetConnectionManager().RegisterEventHandler(logic.NewConnectionEventPublisher(logicManager.GetEventBus()))
+
 	// 登录
 	err = bot.Login()
 	if err != nil {
@@ -0,0 +1,325 @@
+package dstforward
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"llma.dev/utils/llog"
+)
+
+// 聊天记录方向
+const (
+	DirectionToDst = "qq2dst" // QQ -> 饥荒
+	DirectionToQQ  = "dst2qq" // 饥荒 -> QQ
+	DirectionEvent = "event"  // 游戏事件
+)
+
+var (
+	recordBucket = []byte("records")
+	indexBucket  = []byte("index")
+)
+
+// 过期记录清理间隔
+const archivePurgeInterval = time.Hour
+
+// ArchiveRecord 聊天记录
+type ArchiveRecord struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	// GroupID QQ群号，来自游戏的记录为0
+	GroupID uint32 `json:"groupId,omitempty"`
+	// Cluster 来自游戏的记录所在的集群，QQ群消息为空
+	Cluster string `json:"cluster,omitempty"`
+	// SenderID QQ号或科雷id
+	SenderID string `json:"senderId"`
+	// SenderName QQ名称或玩家名称
+	SenderName string `json:"senderName"`
+	Content    string `json:"content"`
+}
+
+// searchText 参与检索的文本
+func (r *ArchiveRecord) searchText() string {
+	return strings.ToLower(r.SenderName + "\n" + r.SenderID + "\n" + r.Content)
+}
+
+// Archive 基于 bbolt 的聊天记录存储，使用单字与双字索引支持中文全文检索
+type Archive struct {
+	db        *bolt.DB
+	retention time.Duration
+}
+
+// OpenArchive 打开聊天记录数据库
+func OpenArchive(path string, retention time.Duration) (*Archive, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(recordBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(indexBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Archive{db: db, retention: retention}, nil
+}
+
+// Add 写入一条记录
+func (a *Archive) Add(record ArchiveRecord) {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordBucket)
+		id, err := records.NextSequence()
+		if err != nil {
+			return err
+		}
+		record.ID = id
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		key := idKey(id)
+		if err := records.Put(key, value); err != nil {
+			return err
+		}
+		index := tx.Bucket(indexBucket)
+		for _, term := range terms(record.searchText()) {
+			if err := index.Put(indexKey(term, key), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		llog.Errorf("[dst forward记录] 写入聊天记录失败: %v", err)
+	}
+}
+
+// maxSearchPostings 检索时每个词项最多扫描的索引条数，只检索最近的记录
+const maxSearchPostings = 20000
+
+// 检索返回的记录条数
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 200
+)
+
+// Search 检索包含关键词的记录，按时间倒序返回最多 limit 条
+// limit 不大于0时使用默认条数，超过上限时按上限返回
+func (a *Archive) Search(query string, limit int) ([]ArchiveRecord, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+	queryTerms := queryTerms(query)
+
+	var result []ArchiveRecord
+	err := a.db.View(func(tx *bolt.Tx) error {
+		// 取各词项倒排列表的交集，每个词项只扫描最近的 maxSearchPostings 条索引
+		var ids map[string]bool
+		index := tx.Bucket(indexBucket).Cursor()
+		for _, term := range queryTerms {
+			found := make(map[string]bool)
+			prefix := indexKey(term, nil)
+			scanned := 0
+			for k := seekLast(index, prefix); k != nil && bytes.HasPrefix(k, prefix) && scanned < maxSearchPostings; k, _ = index.Prev() {
+				scanned++
+				id := string(k[len(prefix):])
+				if ids == nil || ids[id] {
+					found[id] = true
+				}
+			}
+			ids = found
+			if len(ids) == 0 {
+				return nil
+			}
+		}
+
+		keys := make([]string, 0, len(ids))
+		for id := range ids {
+			keys = append(keys, id)
+		}
+		// 大端序编码的id按字节序即时间序
+		slices.Sort(keys)
+		slices.Reverse(keys)
+
+		records := tx.Bucket(recordBucket)
+		for _, key := range keys {
+			var record ArchiveRecord
+			if err := json.Unmarshal(records.Get([]byte(key)), &record); err != nil {
+				continue
+			}
+			// 索引只保证包含全部词项，这里确认每个关键词连续出现
+			text := record.searchText()
+			if !allContained(text, strings.Fields(query)) {
+				continue
+			}
+			result = append(result, record)
+			if len(result) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Purge 删除超过保留时间的记录
+func (a *Archive) Purge() {
+	if a.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-a.retention)
+	removed := 0
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordBucket)
+		index := tx.Bucket(indexBucket)
+		c := records.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			var record ArchiveRecord
+			if err := json.Unmarshal(v, &record); err == nil {
+				if record.Time.After(cutoff) {
+					break
+				}
+				for _, term := range terms(record.searchText()) {
+					if err := index.Delete(indexKey(term, k)); err != nil {
+						return err
+					}
+				}
+			}
+			if err := records.Delete(k); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		llog.Errorf("[dst forward记录] 清理过期聊天记录失败: %v", err)
+		return
+	}
+	if removed > 0 {
+		llog.Infof("[dst forward记录] 已清理 %d 条过期聊天记录", removed)
+	}
+}
+
+// watchPurge 定时清理过期记录
+func (a *Archive) watchPurge() {
+	a.Purge()
+	ticker := time.NewTicker(archivePurgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.Purge()
+	}
+}
+
+// Close 关闭数据库
+func (a *Archive) Close() error {
+	return a.db.Close()
+}
+
+// terms 文本的全部索引词项: 单字与相邻双字
+func terms(text string) []string {
+	runes := []rune(text)
+	set := make(map[string]bool, len(runes)*2)
+	for i, r := range runes {
+		if isSeparator(r) {
+			continue
+		}
+		set[string(r)] = true
+		if i+1 < len(runes) && !isSeparator(runes[i+1]) {
+			set[string(runes[i:i+2])] = true
+		}
+	}
+	result := make([]string, 0, len(set))
+	for term := range set {
+		result = append(result, term)
+	}
+	return result
+}
+
+// queryTerms 关键词的检索词项，单字关键词使用单字索引，否则使用双字索引
+func queryTerms(query string) []string {
+	var result []string
+	for _, field := range strings.Fields(query) {
+		runes := []rune(field)
+		if len(runes) == 1 {
+			result = append(result, field)
+			continue
+		}
+		for i := 0; i+1 < len(runes); i++ {
+			result = append(result, string(runes[i:i+2]))
+		}
+	}
+	return result
+}
+
+func allContained(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if !strings.Contains(text, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSeparator(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t'
+}
+
+func idKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// indexKey 倒排索引键: 词项 + 0x00 + 记录id
+// seekLast 定位到以 prefix 开头的最后一个键，prefix 以分隔符0结尾
+func seekLast(c *bolt.Cursor, prefix []byte) []byte {
+	end := slices.Clone(prefix)
+	end[len(end)-1]++
+	k, _ := c.Seek(end)
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	return k
+}
+
+func indexKey(term string, id []byte) []byte {
+	key := make([]byte, 0, len(term)+1+len(id))
+	key = append(key, term...)
+	key = append(key, 0)
+	return append(key, id...)
+}
+
+// archive 写入聊天记录，未启用时忽略
+func archive(record ArchiveRecord) {
+	if GlobalArchive != nil {
+		GlobalArchive.Add(record)
+	}
+}
+
+var GlobalArchive *Archive
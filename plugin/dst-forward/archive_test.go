@@ -0,0 +1,102 @@
+package dstforward
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestArchive(t *testing.T) *Archive {
+	t.Helper()
+	a, err := OpenArchive(filepath.Join(t.TempDir(), "archive.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func TestArchiveSearch(t *testing.T) {
+	a := openTestArchive(t)
+	a.Add(ArchiveRecord{Direction: DirectionToQQ, Cluster: "cave", SenderID: "KU_1", SenderName: "威尔逊", Content: "洞穴里有蜘蛛"})
+	a.Add(ArchiveRecord{Direction: DirectionToDst, GroupID: 100, SenderID: "10001", SenderName: "小明", Content: "今晚一起打蜘蛛女王"})
+	a.Add(ArchiveRecord{Direction: DirectionToQQ, Cluster: defaultCluster, SenderID: "KU_2", SenderName: "薇洛", Content: "基地着火了"})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"蜘蛛", []string{"今晚一起打蜘蛛女王", "洞穴里有蜘蛛"}},
+		{"蜘蛛 女王", []string{"今晚一起打蜘蛛女王"}},
+		{"蛛女", []string{"今晚一起打蜘蛛女王"}},
+		// 多个关键词需要出现在同一条记录中
+		{"洞穴 女王", nil},
+		{"薇洛", []string{"基地着火了"}},
+		{"ku_1", []string{"洞穴里有蜘蛛"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		records, err := a.Search(tt.query, 10)
+		if err != nil {
+			t.Fatalf("Search(%q) err = %v", tt.query, err)
+		}
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Content)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	records, _ := a.Search("洞穴", 10)
+	if len(records) != 1 || records[0].Cluster != "cave" || records[0].Time.IsZero() {
+		t.Errorf("Search(洞穴) = %+v, 应保留集群与时间", records)
+	}
+}
+
+func TestArchiveSearchLimit(t *testing.T) {
+	a := openTestArchive(t)
+	for i := range maxSearchLimit + 10 {
+		a.Add(ArchiveRecord{Direction: DirectionToQQ, SenderID: "KU_1", SenderName: "威尔逊", Content: fmt.Sprintf("第%d条消息", i)})
+	}
+
+	tests := []struct {
+		limit, want int
+	}{
+		{3, 3},
+		{0, defaultSearchLimit},
+		{-1, defaultSearchLimit},
+		{maxSearchLimit + 5, maxSearchLimit},
+	}
+	for _, tt := range tests {
+		records, err := a.Search("消息", tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != tt.want {
+			t.Errorf("Search(limit=%d) 返回 %d 条, want %d", tt.limit, len(records), tt.want)
+		}
+	}
+	records, _ := a.Search("消息", 1)
+	if want := fmt.Sprintf("第%d条消息", maxSearchLimit+9); len(records) != 1 || records[0].Content != want {
+		t.Errorf("Search(limit=1) = %+v, want 最新的记录 %s", records, want)
+	}
+}
+
+func TestArchivePurge(t *testing.T) {
+	a := openTestArchive(t)
+	a.retention = time.Hour
+	a.Add(ArchiveRecord{Time: time.Now().Add(-2 * time.Hour), SenderName: "威尔逊", Content: "过期的消息"})
+	a.Add(ArchiveRecord{SenderName: "威尔逊", Content: "新的消息"})
+	a.Purge()
+
+	records, _ := a.Search("消息", 10)
+	if len(records) != 1 || records[0].Content != "新的消息" {
+		t.Errorf("清理后 Search(消息) = %+v, want 只剩新的消息", records)
+	}
+	if records, _ := a.Search("过期", 10); len(records) != 0 {
+		t.Errorf("过期记录的索引应一并删除, got %+v", records)
+	}
+}
@@ -0,0 +1,228 @@
+package dstforward
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"llma.dev/utils/llog"
+)
+
+// 封禁数据文件名
+const banFileName = "bans.json"
+
+// 到期检查间隔
+const banCheckInterval = time.Minute
+
+// Ban 封禁记录
+type Ban struct {
+	// KleiID 被封禁的科雷id
+	KleiID string `json:"kleiId"`
+	// Reason 封禁原因
+	Reason string `json:"reason"`
+	// Operator 操作者QQ号
+	Operator uint32 `json:"operator"`
+	// OperatorName 操作者名称
+	OperatorName string `json:"operatorName"`
+	// CreatedAt 封禁时间
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpireAt 解封时间，为零值时永久封禁
+	ExpireAt time.Time `json:"expireAt,omitzero"`
+	// Clusters 下发封禁的集群，到期时向这些集群下发解封，为空时为 default 集群
+	Clusters []string `json:"clusters,omitempty"`
+}
+
+// clusters 下发封禁与解封的集群
+func (b Ban) clusters() []string {
+	if len(b.Clusters) == 0 {
+		return []string{defaultCluster}
+	}
+	return b.Clusters
+}
+
+// Permanent 是否永久封禁
+func (b Ban) Permanent() bool {
+	return b.ExpireAt.IsZero()
+}
+
+// String 封禁记录的展示文本
+func (b Ban) String() string {
+	expire := "永久"
+	if !b.Permanent() {
+		expire = b.ExpireAt.Format("2006-01-02 15:04")
+	}
+	reason := b.Reason
+	if reason == "" {
+		reason = "无"
+	}
+	return fmt.Sprintf("%s 原因: %s 操作者: %s(%d) 封禁于: %s 解封: %s 集群: %s",
+		b.KleiID, reason, b.OperatorName, b.Operator,
+		b.CreatedAt.Format("2006-01-02 15:04"), expire, strings.Join(b.clusters(), "、"))
+}
+
+// BanStore 封禁记录存储
+type BanStore struct {
+	mu   sync.RWMutex
+	bans map[string]*Ban
+}
+
+// NewBanStore 创建封禁存储并读取持久化数据
+func NewBanStore() *BanStore {
+	s := &BanStore{bans: make(map[string]*Ban)}
+	var list []*Ban
+	if err := loadJSON(banFileName, &list); err != nil {
+		llog.Errorf("[dst forward封禁] 读取封禁数据失败: %v", err)
+	}
+	for _, b := range list {
+		s.bans[b.KleiID] = b
+	}
+	return s
+}
+
+// Add 添加封禁记录，已存在时覆盖，并保留原记录下发过封禁的集群
+func (s *BanStore) Add(ban Ban) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.bans[ban.KleiID]; ok {
+		for _, cluster := range old.clusters() {
+			if !slices.Contains(ban.clusters(), cluster) {
+				ban.Clusters = append(ban.clusters(), cluster)
+			}
+		}
+	}
+	s.bans[ban.KleiID] = &ban
+	s.saveLocked()
+}
+
+// Remove 移除封禁记录
+func (s *BanStore) Remove(kleiID string) (Ban, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bans[kleiID]
+	if !ok {
+		return Ban{}, false
+	}
+	delete(s.bans, kleiID)
+	s.saveLocked()
+	return *b, true
+}
+
+// List 按封禁时间排序的全部记录
+func (s *BanStore) List() []Ban {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Ban, 0, len(s.bans))
+	for _, b := range s.bans {
+		list = append(list, *b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// popExpired 取出并移除所有已到期的封禁
+func (s *BanStore) popExpired(now time.Time) []Ban {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []Ban
+	for id, b := range s.bans {
+		if !b.Permanent() && !now.Before(b.ExpireAt) {
+			expired = append(expired, *b)
+			delete(s.bans, id)
+		}
+	}
+	if len(expired) > 0 {
+		s.saveLocked()
+	}
+	return expired
+}
+
+// saveLocked 持久化封禁数据，调用方需持有锁
+func (s *BanStore) saveLocked() {
+	list := make([]*Ban, 0, len(s.bans))
+	for _, b := range s.bans {
+		list = append(list, b)
+	}
+	if err := saveJSON(banFileName, list); err != nil {
+		llog.Errorf("[dst forward封禁] 保存封禁数据失败: %v", err)
+	}
+}
+
+// watchExpire 定时检查到期的封禁并下发解封命令
+func (s *BanStore) watchExpire() {
+	ticker := time.NewTicker(banCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.expire(now)
+	}
+}
+
+// expire 向封禁所在的集群下发到期封禁的解封命令
+func (s *BanStore) expire(now time.Time) {
+	for _, b := range s.popExpired(now) {
+		for _, cluster := range b.clusters() {
+			queueFor(cluster).enqueueCmdMsg("unban", b.KleiID, Source{}, Sender{})
+		}
+		llog.Infof("[dst forward封禁] %s 封禁到期，已向 %s 下发解封命令", b.KleiID, strings.Join(b.clusters(), "、"))
+	}
+}
+
+// parseBanDuration 解析封禁时长，支持 d(天) h(小时) m(分钟) 单位，可以组合，如 3d、12h、1d12h30m
+func parseBanDuration(s string) (time.Duration, bool) {
+	s = strings.Join(strings.Fields(s), "")
+	if s == "" {
+		return 0, false
+	}
+	var total time.Duration
+	for s != "" {
+		i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, false
+		}
+		num, err := strconv.Atoi(s[:i])
+		if err != nil || num <= 0 {
+			return 0, false
+		}
+		var unit time.Duration
+		switch s[i] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'h':
+			unit = time.Hour
+		case 'm':
+			unit = time.Minute
+		default:
+			return 0, false
+		}
+		total += time.Duration(num) * unit
+		s = s[i+1:]
+	}
+	return total, true
+}
+
+// formatDuration 将时长格式化为便于阅读的文本
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "0分钟"
+	}
+	var parts []string
+	if days := d / (24 * time.Hour); days > 0 {
+		parts = append(parts, fmt.Sprintf("%d天", days))
+		d -= days * 24 * time.Hour
+	}
+	if hours := d / time.Hour; hours > 0 {
+		parts = append(parts, fmt.Sprintf("%d小时", hours))
+		d -= hours * time.Hour
+	}
+	if minutes := d / time.Minute; minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%d分钟", minutes))
+	}
+	return strings.Join(parts, "")
+}
+
+var GlobalBanStore *BanStore
@@ -0,0 +1,70 @@
+package dstforward
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseBanDuration(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"30m", 30 * time.Minute, true},
+		{"12h", 12 * time.Hour, true},
+		{"7d", 7 * 24 * time.Hour, true},
+		{"1d12h30m", 36*time.Hour + 30*time.Minute, true},
+		{"1d 12h", 36 * time.Hour, true},
+		{"1d12", 0, false},
+		{"d3", 0, false},
+		{"", 0, false},
+		{"m", 0, false},
+		{"0m", 0, false},
+		{"-1h", 0, false},
+		{"10s", 0, false},
+		{"1.5h", 0, false},
+		{"永久", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseBanDuration(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseBanDuration(%q) = (%v, %v), want (%v, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{30 * time.Second, "0分钟"},
+		{30 * time.Minute, "30分钟"},
+		{2 * time.Hour, "2小时"},
+		{26*time.Hour + 5*time.Minute, "1天2小时5分钟"},
+		{7 * 24 * time.Hour, "7天"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.in); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBanStoreKeepsClusters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewBanStore()
+	s.Add(Ban{KleiID: "KU_1", Reason: "烧家"})
+	s.Add(Ban{KleiID: "KU_1", Reason: "再次烧家", Clusters: []string{"cave"}})
+
+	// 再次封禁会覆盖原因，但仍需在之前下发过封禁的集群解封
+	bans := NewBanStore().List()
+	if len(bans) != 1 || bans[0].Reason != "再次烧家" {
+		t.Fatalf("封禁记录 = %+v", bans)
+	}
+	if got := bans[0].clusters(); !reflect.DeepEqual(got, []string{"cave", defaultCluster}) {
+		t.Fatalf("clusters = %v, want [cave default]", got)
+	}
+}
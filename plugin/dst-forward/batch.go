@@ -0,0 +1,156 @@
+package dstforward
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 消息去重的时间窗口，窗口内相同 msgId 的消息只处理一次
+const dedupWindow = 10 * time.Minute
+
+// 单次批量请求最多包含的条目数
+const maxBatchSize = 100
+
+// 批量条目类型
+const (
+	BatchItemMsg   = "msg"   // 聊天消息
+	BatchItemEvent = "event" // 游戏事件
+)
+
+// 批量条目处理状态
+const (
+	BatchStatusOK        = "ok"        // 处理成功
+	BatchStatusDuplicate = "duplicate" // 重复消息，已忽略
+	BatchStatusInvalid   = "invalid"   // 校验失败，未处理
+)
+
+// Deduper 按客户端消息id去重
+type Deduper struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewDeduper 创建去重器
+func NewDeduper() *Deduper {
+	return &Deduper{seen: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+// Seen 判断消息是否已在时间窗口内处理过，未处理过时记录该消息，msgId 为空时不去重
+func (d *Deduper) Seen(cluster string, msgID string) bool {
+	if msgID == "" {
+		return false
+	}
+	key := cluster + "/" + msgID
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.lastSweep) >= dedupWindow {
+		for k, t := range d.seen {
+			if now.Sub(t) >= dedupWindow {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+	if t, ok := d.seen[key]; ok && now.Sub(t) < dedupWindow {
+		return true
+	}
+	d.seen[key] = now
+	return false
+}
+
+// BatchItem 批量请求中的一条消息或事件
+type BatchItem struct {
+	// Type 条目类型: msg, event
+	Type string `json:"type"`
+	// Msg 聊天消息，type 为 msg 时存在
+	Msg *DstMsg `json:"msg,omitempty"`
+	// Event 游戏事件，type 为 event 时存在
+	Event *DstEvent `json:"event,omitempty"`
+}
+
+// SendBatch POST /send_batch 的请求体
+type SendBatch struct {
+	Items []BatchItem `json:"items"`
+}
+
+func (b *SendBatch) Validate() error {
+	if len(b.Items) == 0 {
+		return missingField("items")
+	}
+	if len(b.Items) > maxBatchSize {
+		return invalidField("items", "单次最多提交 %d 条", maxBatchSize)
+	}
+	return nil
+}
+
+// BatchItemResult 单个条目的处理结果
+type BatchItemResult struct {
+	Index  int            `json:"index"`
+	Status string         `json:"status"`
+	Error  *ProtocolError `json:"error,omitempty"`
+}
+
+// BatchResponse POST /send_batch 的响应
+type BatchResponse struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+// validate 校验单个条目
+func (item *BatchItem) validate() error {
+	switch item.Type {
+	case "":
+		return missingField("type")
+	case BatchItemMsg:
+		if item.Msg == nil {
+			return missingField("msg")
+		}
+		return item.Msg.Validate()
+	case BatchItemEvent:
+		if item.Event == nil {
+			return missingField("event")
+		}
+		return item.Event.Validate()
+	default:
+		return invalidField("type", "未知的条目类型 %s", item.Type)
+	}
+}
+
+// handleBatch 按顺序处理批量请求，单个条目校验失败不影响其他条目
+func handleBatch(batch SendBatch, trusted bool) BatchResponse {
+	results := make([]BatchItemResult, 0, len(batch.Items))
+	for i, item := range batch.Items {
+		result := BatchItemResult{Index: i, Status: BatchStatusOK}
+		if err := item.validate(); err != nil {
+			var pe *ProtocolError
+			if !errors.As(err, &pe) {
+				pe = &ProtocolError{Status: http.StatusUnprocessableEntity, Code: ErrCodeInvalidField, Message: err.Error()}
+			}
+			pe.Message = fmt.Sprintf("第 %d 条: %s", i, pe.Message)
+			result.Status = BatchStatusInvalid
+			result.Error = pe
+			results = append(results, result)
+			continue
+		}
+
+		var duplicate bool
+		switch item.Type {
+		case BatchItemMsg:
+			duplicate = handleDstMsg(*item.Msg, trusted)
+		case BatchItemEvent:
+			duplicate = handleDstEvent(*item.Event)
+		}
+		if duplicate {
+			result.Status = BatchStatusDuplicate
+		}
+		results = append(results, result)
+	}
+	return BatchResponse{Results: results}
+}
+
+var GlobalDedup = NewDeduper()
@@ -0,0 +1,122 @@
+package dstforward
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduperSeen(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster string
+		msgID   string
+		want    bool
+	}{
+		{"首次出现", "default", "1", false},
+		{"重复", "default", "1", true},
+		{"其他集群的相同id", "cave", "1", false},
+		{"其他id", "default", "2", false},
+		{"空id不去重", "default", "", false},
+		{"空id再次出现", "default", "", false},
+	}
+	d := NewDeduper()
+	for _, tt := range tests {
+		if got := d.Seen(tt.cluster, tt.msgID); got != tt.want {
+			t.Errorf("%s: Seen(%q, %q) = %v, want %v", tt.name, tt.cluster, tt.msgID, got, tt.want)
+		}
+	}
+}
+
+func TestDeduperWindow(t *testing.T) {
+	d := NewDeduper()
+	d.Seen("default", "old")
+	d.Seen("default", "recent")
+
+	now := time.Now()
+	d.seen["default/old"] = now.Add(-dedupWindow)
+	d.lastSweep = now.Add(-dedupWindow)
+
+	// 超出时间窗口的消息可以再次处理，并在清理时删除
+	if d.Seen("default", "old") {
+		t.Fatal("超出时间窗口的消息不应视为重复")
+	}
+	if !d.Seen("default", "recent") {
+		t.Fatal("时间窗口内的消息应视为重复")
+	}
+	if len(d.seen) != 2 {
+		t.Fatalf("记录数 = %d, want 2", len(d.seen))
+	}
+}
+
+func TestSendBatchValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		items int
+		want  string
+	}{
+		{"空", 0, ErrCodeMissingField},
+		{"上限", maxBatchSize, ""},
+		{"超出上限", maxBatchSize + 1, ErrCodeInvalidField},
+	}
+	for _, tt := range tests {
+		batch := SendBatch{Items: make([]BatchItem, tt.items)}
+		err := batch.Validate()
+		var code string
+		if err != nil {
+			code = err.(*ProtocolError).Code
+		}
+		if code != tt.want {
+			t.Errorf("%s: Validate() code = %q, want %q", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	saved := GlobalDedup
+	GlobalDedup = NewDeduper()
+	defer func() { GlobalDedup = saved }()
+	GlobalDedup.Seen("default", "m1")
+	GlobalDedup.Seen("cave", "e1")
+
+	batch := SendBatch{Items: []BatchItem{
+		{Type: ""},
+		{Type: "chat"},
+		{Type: BatchItemMsg},
+		{Type: BatchItemEvent},
+		{Type: BatchItemMsg, Msg: &DstMsg{UserName: "wilson"}},
+		{Type: BatchItemEvent, Event: &DstEvent{Type: EventJoin, UserName: "wilson", KleiID: "123"}},
+		{Type: BatchItemMsg, Msg: &DstMsg{UserName: "wilson", Message: "hi", Cluster: "default", MsgID: "m1"}},
+		{Type: BatchItemEvent, Event: &DstEvent{Type: EventAnnounce, Message: "hi", Cluster: "cave", MsgID: "e1"}},
+	}}
+	want := []struct {
+		status string
+		field  string
+	}{
+		{BatchStatusInvalid, "type"},
+		{BatchStatusInvalid, "type"},
+		{BatchStatusInvalid, "msg"},
+		{BatchStatusInvalid, "event"},
+		{BatchStatusInvalid, "message"},
+		{BatchStatusInvalid, "kleiId"},
+		{BatchStatusDuplicate, ""},
+		{BatchStatusDuplicate, ""},
+	}
+
+	resp := handleBatch(batch, false)
+	if len(resp.Results) != len(want) {
+		t.Fatalf("结果数 = %d, want %d", len(resp.Results), len(want))
+	}
+	for i, result := range resp.Results {
+		if result.Index != i || result.Status != want[i].status {
+			t.Errorf("第 %d 条: index = %d, status = %s, want %d, %s", i, result.Index, result.Status, i, want[i].status)
+			continue
+		}
+		var field string
+		if result.Error != nil {
+			field = result.Error.Field
+		}
+		if field != want[i].field {
+			t.Errorf("第 %d 条: 错误字段 = %q, want %q", i, field, want[i].field)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package dstforward
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"llma.dev/utils/llog"
+)
+
+// 绑定数据文件名
+const bindFileName = "bindings.json"
+
+// 验证码有效期
+const bindCodeTTL = 5 * time.Minute
+
+// Binding QQ号与科雷id的绑定关系
+type Binding struct {
+	// KleiID 科雷id
+	KleiID string `json:"kleiId"`
+	// QQ QQ号码
+	QQ uint32 `json:"qq"`
+	// QQName 绑定时的QQ名称
+	QQName string `json:"qqName"`
+	// BoundAt 绑定时间
+	BoundAt time.Time `json:"boundAt"`
+}
+
+// pendingBind 等待游戏内验证的绑定请求
+type pendingBind struct {
+	binding  Binding
+	code     string
+	expireAt time.Time
+	// 验证通过后的通知回调
+	notify func(text string)
+}
+
+// BindStore 绑定关系存储
+type BindStore struct {
+	mu       sync.RWMutex
+	bindings map[string]*Binding     // kleiID -> 绑定
+	pending  map[string]*pendingBind // kleiID -> 待验证请求
+}
+
+// NewBindStore 创建绑定存储并读取持久化数据
+func NewBindStore() *BindStore {
+	s := &BindStore{
+		bindings: make(map[string]*Binding),
+		pending:  make(map[string]*pendingBind),
+	}
+	var list []*Binding
+	if err := loadJSON(bindFileName, &list); err != nil {
+		llog.Errorf("[dst forward绑定] 读取绑定数据失败: %v", err)
+	}
+	for _, b := range list {
+		s.bindings[b.KleiID] = b
+	}
+	return s
+}
+
+// ByKleiID 通过科雷id查询绑定
+func (s *BindStore) ByKleiID(kleiID string) (Binding, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.bindings[kleiID]
+	if !ok {
+		return Binding{}, false
+	}
+	return *b, true
+}
+
+// ByQQ 通过QQ号查询绑定
+func (s *BindStore) ByQQ(qq uint32) (Binding, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, b := range s.bindings {
+		if b.QQ == qq {
+			return *b, true
+		}
+	}
+	return Binding{}, false
+}
+
+// Request 发起绑定请求，返回需要在游戏内发送的验证码
+func (s *BindStore) Request(kleiID string, qq uint32, qqName string, notify func(text string)) (string, error) {
+	code, err := randomCode()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked(time.Now())
+	s.pending[kleiID] = &pendingBind{
+		binding: Binding{
+			KleiID: kleiID,
+			QQ:     qq,
+			QQName: qqName,
+		},
+		code:     code,
+		expireAt: time.Now().Add(bindCodeTTL),
+		notify:   notify,
+	}
+	return code, nil
+}
+
+// Verify 校验玩家在游戏内发送的验证码，通过则完成绑定
+func (s *BindStore) Verify(kleiID string, code string) bool {
+	s.mu.Lock()
+	p, ok := s.pending[kleiID]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	if time.Now().After(p.expireAt) {
+		delete(s.pending, kleiID)
+		s.mu.Unlock()
+		return false
+	}
+	if p.code != code {
+		s.mu.Unlock()
+		return false
+	}
+	delete(s.pending, kleiID)
+
+	// 一个QQ只保留一个绑定
+	for id, b := range s.bindings {
+		if b.QQ == p.binding.QQ {
+			delete(s.bindings, id)
+		}
+	}
+	binding := p.binding
+	binding.BoundAt = time.Now()
+	s.bindings[kleiID] = &binding
+	err := s.saveLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		llog.Errorf("[dst forward绑定] 保存绑定数据失败: %v", err)
+	}
+	llog.Infof("[dst forward绑定] %s 已绑定QQ %d", kleiID, binding.QQ)
+	if p.notify != nil {
+		p.notify(fmt.Sprintf("绑定成功: %s <-> %s(%d)", kleiID, binding.QQName, binding.QQ))
+	}
+	return true
+}
+
+// sweepLocked 清理已过期的待验证请求，调用方需持有锁
+func (s *BindStore) sweepLocked(now time.Time) {
+	for id, p := range s.pending {
+		if now.After(p.expireAt) {
+			delete(s.pending, id)
+		}
+	}
+}
+
+// saveLocked 持久化绑定数据，调用方需持有锁
+func (s *BindStore) saveLocked() error {
+	list := make([]*Binding, 0, len(s.bindings))
+	for _, b := range s.bindings {
+		list = append(list, b)
+	}
+	return saveJSON(bindFileName, list)
+}
+
+// randomCode 生成6位数字验证码
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+var GlobalBindStore *BindStore
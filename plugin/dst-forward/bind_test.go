@@ -0,0 +1,94 @@
+package dstforward
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBindStoreVerify(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewBindStore()
+
+	var notified string
+	code, err := s.Request("KU_a", 10001, "小明", func(text string) { notified = text })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 6 {
+		t.Fatalf("验证码 %q 应为6位数字", code)
+	}
+
+	if s.Verify("KU_b", code) {
+		t.Error("其它玩家发送验证码不应完成绑定")
+	}
+	if s.Verify("KU_a", "不是验证码") {
+		t.Error("错误的验证码不应完成绑定")
+	}
+	if !s.Verify("KU_a", code) {
+		t.Fatal("正确的验证码应完成绑定")
+	}
+	if notified == "" {
+		t.Error("绑定成功后应通知发起绑定的用户")
+	}
+	if s.Verify("KU_a", code) {
+		t.Error("验证码只能使用一次")
+	}
+
+	b, ok := s.ByQQ(10001)
+	if !ok || b.KleiID != "KU_a" || b.QQName != "小明" || b.BoundAt.IsZero() {
+		t.Errorf("ByQQ(10001) = %+v, %v", b, ok)
+	}
+
+	// 重新读取持久化数据
+	if b, ok := NewBindStore().ByKleiID("KU_a"); !ok || b.QQ != 10001 {
+		t.Errorf("重新加载后 ByKleiID(KU_a) = %+v, %v", b, ok)
+	}
+}
+
+func TestBindStoreRebindReplacesOldAccount(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewBindStore()
+
+	for _, kleiID := range []string{"KU_old", "KU_new"} {
+		code, err := s.Request(kleiID, 10001, "小明", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.Verify(kleiID, code) {
+			t.Fatalf("%s 绑定失败", kleiID)
+		}
+	}
+
+	if _, ok := s.ByKleiID("KU_old"); ok {
+		t.Error("一个QQ只保留最新的绑定")
+	}
+	if b, _ := s.ByQQ(10001); b.KleiID != "KU_new" {
+		t.Errorf("ByQQ(10001).KleiID = %s, want KU_new", b.KleiID)
+	}
+}
+
+func TestBindStoreExpiredCode(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewBindStore()
+
+	code, err := s.Request("KU_a", 10001, "小明", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.pending["KU_a"].expireAt = time.Now().Add(-time.Second)
+	if s.Verify("KU_a", code) {
+		t.Error("过期的验证码不应完成绑定")
+	}
+
+	// 过期未验证的请求在下一次发起绑定时清理
+	if _, err := s.Request("KU_b", 10002, "小红", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.pending["KU_b"].expireAt = time.Now().Add(-time.Second)
+	if _, err := s.Request("KU_c", 10003, "小刚", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.pending["KU_b"]; ok {
+		t.Error("过期的待验证请求应被清理")
+	}
+}
@@ -0,0 +1,106 @@
+package dstforward
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"llma.dev/logic"
+)
+
+// clusterSelection QQ用户当前选择的集群，QQ命令下发到该集群，未选择时为 default 集群
+type clusterSelection struct {
+	mu       sync.RWMutex
+	selected map[uint32]string
+}
+
+// get 用户当前选择的集群
+func (s *clusterSelection) get(uin uint32) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cluster, ok := s.selected[uin]; ok {
+		return cluster
+	}
+	return defaultCluster
+}
+
+// set 选择集群，选择 default 集群时移除记录
+func (s *clusterSelection) set(uin uint32, cluster string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cluster == defaultCluster {
+		delete(s.selected, uin)
+		return
+	}
+	s.selected[uin] = cluster
+}
+
+var selectedClusters = &clusterSelection{selected: make(map[uint32]string)}
+
+// clusterName 集群名称，未填写集群时为 default 集群
+func clusterName(cluster string) string {
+	if cluster == "" {
+		return defaultCluster
+	}
+	return cluster
+}
+
+// knownClusters 已知的集群，包括 default 与拉取过消息的集群
+func knownClusters() []string {
+	clusterQueuesMu.Lock()
+	clusters := make([]string, 0, len(clusterQueues)+1)
+	for cluster := range clusterQueues {
+		clusters = append(clusters, cluster)
+	}
+	clusterQueuesMu.Unlock()
+	sort.Strings(clusters)
+	return append([]string{defaultCluster}, clusters...)
+}
+
+// commandCluster 命令作用的集群，QQ命令作用于发送者选择的集群，游戏内命令作用于玩家所在集群
+func commandCluster(ctx *logic.MessageContext) string {
+	if player, ok := dstPlayerOf(ctx); ok {
+		return clusterName(player.msg.Cluster)
+	}
+	if uin, _, ok := senderInfo(ctx); ok {
+		return selectedClusters.get(uin)
+	}
+	return defaultCluster
+}
+
+// ClusterHandler 查看或切换QQ命令作用的集群 /集群 [名称]
+type ClusterHandler struct{}
+
+func (h *ClusterHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	uin, _, ok := senderInfo(ctx)
+	if !ok {
+		return nil
+	}
+	known := knownClusters()
+	if !args.Has("名称") {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("当前集群: %s\n已知集群: %s",
+			selectedClusters.get(uin), strings.Join(known, "、"))))
+		return nil
+	}
+	cluster := args.String("名称")
+	if !slices.Contains(known, cluster) {
+		return logic.NewUsageError("未知的集群 %s，已知集群: %s", cluster, strings.Join(known, "、"))
+	}
+	selectedClusters.set(uin, cluster)
+	ctx.Reply(simpleTextElements(fmt.Sprintf("之后的命令将作用于集群 %s", cluster)))
+	return nil
+}
+
+// clusterCommands 集群切换命令
+func clusterCommands() []*logic.Command {
+	return []*logic.Command{
+		{
+			Name:        "集群",
+			Description: "查看或切换管理命令作用的集群，不填时查看当前集群",
+			Args:        []logic.Arg{{Name: "名称"}},
+			Handler:     &ClusterHandler{},
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package dstforward
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"llma.dev/config"
+	"llma.dev/logic"
+	"llma.dev/utils/llog"
+)
+
+// 自定义命令的参数类型
+const (
+	ArgString = "string"
+	ArgInt    = "int"
+	ArgKleiID = "kleiid"
+	ArgText   = "text"
+)
+
+// ConfigCommandHandler 配置文件定义的自定义命令处理器
+type ConfigCommandHandler struct {
+	cfg      config.CommandConfig
+	template *template.Template
+}
+
+// NewConfigCommandHandler 校验配置并创建自定义命令处理器
+func NewConfigCommandHandler(cfg config.CommandConfig) (*ConfigCommandHandler, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("命令名称不能为空")
+	}
+	if cfg.Head == "" {
+		return nil, fmt.Errorf("命令 %s 未配置 head", cfg.Name)
+	}
+
+	h := &ConfigCommandHandler{cfg: cfg}
+	if cfg.Content != "" {
+		tmpl, err := template.New(cfg.Name).Option("missingkey=zero").Parse(cfg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("命令 %s 的 content 模板无效: %w", cfg.Name, err)
+		}
+		h.template = tmpl
+	}
+	return h, nil
+}
+
+// Command 根据配置生成声明式命令
+func (h *ConfigCommandHandler) Command() (*logic.Command, error) {
+	cmd := &logic.Command{
+		Name:        h.cfg.Name,
+		Aliases:     h.cfg.Aliases,
+		Description: h.cfg.Description,
+		Handler:     h,
+	}
+	permission, err := permissionOfRole(h.cfg.Permission)
+	if err != nil {
+		return nil, fmt.Errorf("自定义命令 %s 的权限无效: %w", h.cfg.Name, err)
+	}
+	cmd.Permission = permission
+
+	for _, arg := range h.cfg.Args {
+		switch arg.Type {
+		case "", ArgString:
+			cmd.Args = append(cmd.Args, logic.Arg{Name: arg.Name, Required: arg.Required})
+		case ArgInt:
+			cmd.Args = append(cmd.Args, logic.Arg{Name: arg.Name, Type: logic.ArgInt, Required: arg.Required})
+		case ArgKleiID:
+			cmd.Args = append(cmd.Args, kleiIDArg(arg.Name, arg.Required, ""))
+		case ArgText:
+			cmd.Args = append(cmd.Args, logic.Arg{Name: arg.Name, Type: logic.ArgText, Required: arg.Required})
+		default:
+			return nil, fmt.Errorf("命令 %s 的参数 %s 类型 %s 无效", h.cfg.Name, arg.Name, arg.Type)
+		}
+	}
+	return cmd, nil
+}
+
+func (h *ConfigCommandHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	content, err := h.render(args)
+	if err != nil {
+		return fmt.Errorf("渲染命令 %s 正文失败: %w", h.cfg.Name, err)
+	}
+
+	execute := func() {
+		if enqueueCmd(ctx, h.cfg.Head, content) {
+			ctx.Reply(simpleTextElements(fmt.Sprintf("已下发 %s 命令", h.cfg.Name)))
+		}
+	}
+	if !h.cfg.Confirm {
+		execute()
+		return nil
+	}
+
+	cancelFunc := func() {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("已取消 %s 操作", h.cfg.Name)))
+	}
+	ctx.Confirm(h.cfg.Name, 0, execute, cancelFunc)
+	return nil
+}
+
+// render 生成下发给mod的命令正文
+func (h *ConfigCommandHandler) render(args logic.Args) (any, error) {
+	if h.template == nil {
+		switch len(h.cfg.Args) {
+		case 0:
+			return nil, nil
+		case 1:
+			return args.Get(h.cfg.Args[0].Name), nil
+		default:
+			return map[string]any(args), nil
+		}
+	}
+	// 未填写的可选参数渲染为空，而不是模板默认的 <no value>
+	data := make(map[string]any, len(h.cfg.Args))
+	for _, arg := range h.cfg.Args {
+		data[arg.Name] = ""
+	}
+	for name, value := range args {
+		data[name] = value
+	}
+	var sb strings.Builder
+	if err := h.template.Execute(&sb, data); err != nil {
+		return nil, err
+	}
+	return sb.String(), nil
+}
+
+// configCommands 配置文件中的自定义命令，配置错误的命令会被跳过
+func configCommands() []*logic.Command {
+	var commands []*logic.Command
+	for _, cfg := range config.GlobalConfig.Commands {
+		handler, err := NewConfigCommandHandler(cfg)
+		if err != nil {
+			llog.Errorf("[dst forward] 自定义命令配置错误，已跳过: %v", err)
+			continue
+		}
+		cmd, err := handler.Command()
+		if err != nil {
+			llog.Errorf("[dst forward] 自定义命令配置错误，已跳过: %v", err)
+			continue
+		}
+		commands = append(commands, cmd)
+		llog.Infof("[dst forward] 已注册自定义命令 %s", cfg.Name)
+	}
+	return commands
+}
@@ -0,0 +1,114 @@
+package dstforward
+
+import (
+	"reflect"
+	"testing"
+
+	"llma.dev/config"
+	"llma.dev/logic"
+)
+
+func TestConfigCommandValidation(t *testing.T) {
+	invalid := map[string]config.CommandConfig{
+		"名称为空":   {Head: "give"},
+		"缺少head": {Name: "给予"},
+		"模板无效":   {Name: "给予", Head: "give", Content: "{{.科雷id"},
+	}
+	for name, cfg := range invalid {
+		if _, err := NewConfigCommandHandler(cfg); err == nil {
+			t.Errorf("%s: NewConfigCommandHandler 应返回错误", name)
+		}
+	}
+
+	for name, cfg := range map[string]config.CommandConfig{
+		"未知参数类型": {Name: "给予", Head: "give", Args: []config.CommandArgConfig{{Name: "数量", Type: "float"}}},
+		"未知权限":   {Name: "给予", Head: "give", Permission: "root"},
+	} {
+		h, err := NewConfigCommandHandler(cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := h.Command(); err == nil {
+			t.Errorf("%s: Command() 应返回错误", name)
+		}
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	h, err := NewConfigCommandHandler(config.CommandConfig{
+		Name:       "给予",
+		Aliases:    []string{"give"},
+		Permission: "admin",
+		Head:       "give",
+		Content:    `{{.科雷id}} {{.物品}} {{.数量}}`,
+		Args: []config.CommandArgConfig{
+			{Name: "科雷id", Type: ArgKleiID, Required: true},
+			{Name: "物品", Required: true},
+			{Name: "数量", Type: ArgInt},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := h.Command()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("声明", func(t *testing.T) {
+		if cmd.Permission != PermAdmin {
+			t.Errorf("Permission = %q, want %q", cmd.Permission, PermAdmin)
+		}
+		if got, want := cmd.Usage("/"), "/给予 <科雷id> <物品> [数量]"; got != want {
+			t.Errorf("Usage = %q, want %q", got, want)
+		}
+		if _, err := cmd.Args[0].Parse("wilson"); err == nil {
+			t.Error("kleiid 参数应校验科雷id格式")
+		}
+		if cmd.Args[2].Type != logic.ArgInt {
+			t.Errorf("数量参数类型 = %v, want int", cmd.Args[2].Type)
+		}
+	})
+
+	t.Run("模板", func(t *testing.T) {
+		content, err := h.render(logic.Args{"科雷id": "KU_1", "物品": "log", "数量": 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != "KU_1 log 20" {
+			t.Errorf("render = %q, want %q", content, "KU_1 log 20")
+		}
+		// 未填写的可选参数渲染为空
+		content, _ = h.render(logic.Args{"科雷id": "KU_1", "物品": "log"})
+		if content != "KU_1 log " {
+			t.Errorf("render 缺少可选参数 = %q, want %q", content, "KU_1 log ")
+		}
+	})
+}
+
+func TestConfigCommandRenderWithoutTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		args []config.CommandArgConfig
+		in   logic.Args
+		want any
+	}{
+		{"无参数", nil, logic.Args{}, nil},
+		{"单个参数直接作为正文", []config.CommandArgConfig{{Name: "科雷id"}}, logic.Args{"科雷id": "KU_1"}, "KU_1"},
+		{"多个参数作为对象", []config.CommandArgConfig{{Name: "a"}, {Name: "b"}}, logic.Args{"a": "1", "b": 2},
+			map[string]any{"a": "1", "b": 2}},
+	}
+	for _, tt := range tests {
+		h, err := NewConfigCommandHandler(config.CommandConfig{Name: "test", Head: "test", Args: tt.args})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := h.render(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: render = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,52 @@
 package dstforward
 
+import (
+	"time"
+
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
 func Init() {
+	GlobalMsgQueue.configure(config.GlobalConfig.Queue)
+	GlobalRelay = NewRelayTable(config.GlobalConfig.Relays)
+	groupPolicies = loadGroupPolicies(config.GlobalConfig.GroupPolicies)
+	GlobalBindStore = NewBindStore()
+	GlobalBanStore = NewBanStore()
+	GlobalRoleStore = NewRoleStore(config.GlobalConfig.Role, config.GlobalConfig.Other.AllowedUIDs)
+	go GlobalBanStore.watchExpire()
+	GlobalScheduler = NewScheduler(config.GlobalConfig.Schedules)
+	go GlobalScheduler.Run()
+	if cfg := config.GlobalConfig.Archive; cfg.Enable {
+		a, err := OpenArchive(cfg.Path, time.Duration(cfg.RetentionDays)*24*time.Hour)
+		if err != nil {
+			llog.Errorf("[dst forward] 打开聊天记录数据库失败，聊天记录存档已禁用: %v", err)
+		} else {
+			GlobalArchive = a
+			go GlobalArchive.watchPurge()
+		}
+	}
+	if cfg := config.GlobalConfig.Stats; cfg.Enable {
+		GlobalStats = NewStatsStore()
+		go GlobalStats.watchSave()
+		if cfg.WeeklySummary != "" {
+			if err := GlobalScheduler.AddFunc("每周统计", cfg.WeeklySummary, postWeeklySummary); err != nil {
+				llog.Errorf("[dst forward] 每周统计配置错误: %v", err)
+			}
+		}
+	}
+	if cfg := config.GlobalConfig.Moderation; cfg.Enable {
+		m, err := NewModerator(cfg)
+		if err != nil {
+			llog.Errorf("[dst forward] 审核规则配置错误，消息审核已禁用: %v", err)
+		} else {
+			GlobalModerator.Store(m)
+		}
+	}
+	if cfg := config.GlobalConfig.Flood; cfg.Enable {
+		GlobalFloodGuard = NewFloodGuard(cfg)
+		go GlobalFloodGuard.watchFlush()
+	}
 	RegisterCustomLogic()
 	go registerServer()
 }
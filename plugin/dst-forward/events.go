@@ -0,0 +1,42 @@
+package dstforward
+
+import "llma.dev/logic"
+
+// 游戏相关的事件类型
+const (
+	EventTypeDstConnected = "dst.connected"
+	EventTypeDstMessage   = "dst.message"
+	EventTypeDstEvent     = "dst.event"
+)
+
+// DstConnected mod 握手成功
+type DstConnected struct {
+	Handshake Handshake
+}
+
+func (DstConnected) EventType() string  { return EventTypeDstConnected }
+func (e DstConnected) OrderKey() string { return e.Handshake.Cluster }
+
+// DstMessageReceived 收到游戏内聊天消息，重复的消息不会发布
+type DstMessageReceived struct {
+	Msg DstMsg
+}
+
+func (DstMessageReceived) EventType() string  { return EventTypeDstMessage }
+func (e DstMessageReceived) OrderKey() string { return e.Msg.Cluster }
+
+// DstEventReceived 收到游戏事件，重复的事件不会发布
+type DstEventReceived struct {
+	Event DstEvent
+}
+
+func (DstEventReceived) EventType() string  { return EventTypeDstEvent }
+func (e DstEventReceived) OrderKey() string { return e.Event.Cluster }
+
+// publishEvent 发布事件到逻辑管理器的事件总线
+func publishEvent[T logic.Payload](payload T) {
+	if logic.Manager == nil {
+		return
+	}
+	logic.Publish(logic.Manager.GetEventBus(), payload)
+}
@@ -0,0 +1,157 @@
+package dstforward
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
+// 刷屏统计检查间隔
+const floodCheckInterval = time.Second
+
+// floodState 玩家在当前时间窗口内的发言情况
+type floodState struct {
+	name        string
+	cluster     string
+	windowStart time.Time
+	count       int
+	suppressed  int
+	offenses    int
+	lastOffense time.Time
+}
+
+// FloodGuard 游戏聊天刷屏保护，按科雷id限制转发到QQ的消息频率
+type FloodGuard struct {
+	mu      sync.Mutex
+	cfg     config.FloodConfig
+	window  time.Duration
+	players map[string]*floodState
+	// notify 发送刷屏与禁言提示，默认发送到接收游戏消息的绑定群
+	notify func(text string)
+}
+
+// NewFloodGuard 创建刷屏保护
+func NewFloodGuard(cfg config.FloodConfig) *FloodGuard {
+	if cfg.Burst <= 0 {
+		cfg.Burst = 5
+	}
+	if cfg.WindowSeconds <= 0 {
+		cfg.WindowSeconds = 10
+	}
+	return &FloodGuard{
+		cfg:     cfg,
+		window:  time.Duration(cfg.WindowSeconds) * time.Second,
+		players: make(map[string]*floodState),
+		notify:  sendToQQGroups,
+	}
+}
+
+// Allow 判断玩家消息是否转发，超出限制的消息会被计数并在窗口结束时合并提示
+func (g *FloodGuard) Allow(msg DstMsg) bool {
+	if msg.KleiID == "" {
+		return true
+	}
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state, ok := g.players[msg.KleiID]
+	if !ok {
+		state = &floodState{windowStart: now}
+		g.players[msg.KleiID] = state
+	}
+	state.name = msg.UserName
+	state.cluster = msg.Cluster
+	if now.Sub(state.windowStart) >= g.window {
+		g.closeWindowLocked(msg.KleiID, state)
+		state.windowStart = now
+	}
+
+	state.count++
+	if state.count <= g.cfg.Burst {
+		return true
+	}
+	state.suppressed++
+	return false
+}
+
+// flush 结算所有已结束的时间窗口，并清理长时间未发言的玩家
+func (g *FloodGuard) flush(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for id, state := range g.players {
+		if now.Sub(state.windowStart) < g.window {
+			continue
+		}
+		g.closeWindowLocked(id, state)
+		state.windowStart = now
+		if state.offenses == 0 || now.Sub(state.lastOffense) >= g.offenseTTL() {
+			delete(g.players, id)
+		}
+	}
+}
+
+// closeWindowLocked 结算时间窗口: 发送省略提示，累计违规并在达到阈值时下发禁言，调用方需持有锁
+func (g *FloodGuard) closeWindowLocked(kleiID string, state *floodState) {
+	suppressed := state.suppressed
+	state.count = 0
+	state.suppressed = 0
+	if suppressed == 0 {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(state.lastOffense) >= g.offenseTTL() {
+		state.offenses = 0
+	}
+	state.offenses++
+	state.lastOffense = now
+	llog.Infof("[dst forward刷屏] %s(%s) 刷屏，已省略 %d 条消息，累计 %d 次", state.name, kleiID, suppressed, state.offenses)
+	notices := []string{fmt.Sprintf("(玩家 %s 刷屏，已省略 %d 条)", state.name, suppressed)}
+
+	if g.cfg.MuteAfter > 0 && state.offenses >= g.cfg.MuteAfter {
+		state.offenses = 0
+		muteSeconds := g.cfg.MuteSeconds
+		if muteSeconds <= 0 {
+			muteSeconds = 300
+		}
+		queueFor(state.cluster).enqueueCmdMsg("mute", fmt.Sprintf("%s %d", kleiID, muteSeconds), Source{}, Sender{})
+		llog.Infof("[dst forward刷屏] %s(%s) 多次刷屏，已下发禁言 %d 秒", state.name, kleiID, muteSeconds)
+		notices = append(notices, fmt.Sprintf("玩家 %s 多次刷屏，已禁言 %s", state.name,
+			formatDuration(time.Duration(muteSeconds)*time.Second)))
+	}
+
+	// 在锁外按顺序发送提示，省略提示总在禁言提示之前
+	go func() {
+		for _, text := range notices {
+			g.notify(text)
+		}
+	}()
+}
+
+// offenseTTL 违规次数的有效期，超过该时间未再刷屏时清零
+func (g *FloodGuard) offenseTTL() time.Duration {
+	return 10 * g.window
+}
+
+// watchFlush 定时结算时间窗口，保证刷屏停止后也能发出省略提示
+func (g *FloodGuard) watchFlush() {
+	ticker := time.NewTicker(floodCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		g.flush(now)
+	}
+}
+
+// allowFlood 刷屏检查，未启用刷屏保护时总是放行
+func allowFlood(msg DstMsg) bool {
+	if GlobalFloodGuard == nil {
+		return true
+	}
+	return GlobalFloodGuard.Allow(msg)
+}
+
+var GlobalFloodGuard *FloodGuard
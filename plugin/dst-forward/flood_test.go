@@ -0,0 +1,93 @@
+package dstforward
+
+import (
+	"testing"
+	"time"
+
+	"llma.dev/config"
+)
+
+func newTestFloodGuard(cfg config.FloodConfig) (*FloodGuard, chan string) {
+	notices := make(chan string, 10)
+	g := NewFloodGuard(cfg)
+	g.notify = func(text string) { notices <- text }
+	return g, notices
+}
+
+func expectNotice(t *testing.T, notices chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-notices:
+		if got != want {
+			t.Errorf("提示 = %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("没有收到提示 %q", want)
+	}
+}
+
+func TestFloodGuardSuppressesBurst(t *testing.T) {
+	g, notices := newTestFloodGuard(config.FloodConfig{Burst: 2, WindowSeconds: 10})
+	wilson := DstMsg{UserName: "wilson", KleiID: "KU_1", Message: "刷屏"}
+	willow := DstMsg{UserName: "willow", KleiID: "KU_2", Message: "你好"}
+
+	var allowed int
+	for range 5 {
+		if g.Allow(wilson) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("时间窗口内放行 %d 条, want 2", allowed)
+	}
+	if !g.Allow(willow) {
+		t.Error("其他玩家不受影响")
+	}
+	for range 5 {
+		if !g.Allow(DstMsg{UserName: "server"}) {
+			t.Fatal("没有科雷id的消息总是放行")
+		}
+	}
+
+	// 窗口结束后合并提示一次，下一个窗口重新计数
+	g.flush(time.Now().Add(g.window))
+	expectNotice(t, notices, "(玩家 wilson 刷屏，已省略 3 条)")
+	select {
+	case extra := <-notices:
+		t.Errorf("没有刷屏的玩家不应提示: %q", extra)
+	default:
+	}
+	if _, ok := g.players["KU_2"]; ok {
+		t.Error("没有违规的玩家应在窗口结束后清理")
+	}
+}
+
+func TestFloodGuardMutesRepeatOffenders(t *testing.T) {
+	g, notices := newTestFloodGuard(config.FloodConfig{Burst: 1, WindowSeconds: 10, MuteAfter: 2, MuteSeconds: 600})
+	queueFor("cave").drain()
+	msg := DstMsg{UserName: "wilson", KleiID: "KU_1", Message: "刷屏", Cluster: "cave"}
+
+	g.Allow(msg)
+	g.Allow(msg)
+	g.flush(time.Now().Add(g.window))
+	expectNotice(t, notices, "(玩家 wilson 刷屏，已省略 1 条)")
+	if cmds := drainCmds("cave"); len(cmds) != 0 {
+		t.Fatalf("第一次刷屏不应禁言: %v", cmds)
+	}
+
+	// flush 将下一个窗口的开始时间设为结算时间，这里移回当前时间
+	g.players["KU_1"].windowStart = time.Now()
+	g.Allow(msg)
+	g.Allow(msg)
+	g.flush(time.Now().Add(g.window))
+	expectNotice(t, notices, "(玩家 wilson 刷屏，已省略 1 条)")
+	expectNotice(t, notices, "玩家 wilson 多次刷屏，已禁言 10分钟")
+
+	if cmds := drainCmds("cave"); cmds["mute"] != "KU_1 600" {
+		t.Errorf("下发的命令 = %v, want mute KU_1 600", cmds)
+	}
+	// 禁言后违规次数清零，玩家记录随之清理
+	if _, ok := g.players["KU_1"]; ok {
+		t.Error("禁言后应清零违规次数")
+	}
+}
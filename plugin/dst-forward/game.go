@@ -0,0 +1,254 @@
+package dstforward
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/bot"
+	"llma.dev/config"
+	"llma.dev/logic"
+	"llma.dev/utils/llog"
+)
+
+// 多久内发过言的群友视为在线
+const memberActiveWindow = 30 * time.Minute
+
+// PlatformDst 游戏内消息的来源平台
+const PlatformDst = "dst"
+
+// dstPlayerMessage 游戏内玩家发送的命令消息，实现 logic.ExternalMessage
+type dstPlayerMessage struct {
+	msg DstMsg
+}
+
+func (m *dstPlayerMessage) Platform() string {
+	return PlatformDst
+}
+
+func (m *dstPlayerMessage) Text() string {
+	return strings.TrimSpace(m.msg.Message)
+}
+
+func (m *dstPlayerMessage) SenderID() string {
+	return m.msg.KleiID
+}
+
+func (m *dstPlayerMessage) SenderName() string {
+	return m.msg.UserName
+}
+
+// Reply 通过消息队列回复给发送命令的玩家
+func (m *dstPlayerMessage) Reply(elements []message.IMessageElement) {
+	queueFor(m.msg.Cluster).enqueue(Message{
+		Type: MsgText,
+		Data: Data{
+			Sender:  Sender{Name: "bot"},
+			Content: message.ToReadableString(elements),
+			Target:  m.msg.KleiID,
+		},
+	})
+}
+
+// dispatchGameCommand 将匹配游戏内命令的消息交给路由处理，返回消息是否为命令
+// 以命令前缀开头但没有匹配命令的消息，如 "!!!"，仍按普通聊天转发
+func dispatchGameCommand(msg DstMsg) bool {
+	prefix := config.GlobalConfig.Other.GameCommandPrefix
+	if prefix == "" || !strings.HasPrefix(strings.TrimSpace(msg.Message), prefix) {
+		return false
+	}
+	if logic.Manager == nil {
+		return false
+	}
+	player := &dstPlayerMessage{msg: msg}
+	if !logic.Manager.MatchesCommand(player) {
+		return false
+	}
+	llog.Debugf("[dst forward游戏命令] %s(%s) 执行命令: %s", msg.UserName, msg.KleiID, msg.Message)
+	go logic.Manager.Dispatch(player)
+	return true
+}
+
+// dstPlayerOf 获取游戏内命令的发送者
+func dstPlayerOf(ctx *logic.MessageContext) (*dstPlayerMessage, bool) {
+	ext, ok := ctx.GetExternalMessage()
+	if !ok {
+		return nil, false
+	}
+	m, ok := ext.(*dstPlayerMessage)
+	return m, ok
+}
+
+// activeMember 最近发言的群友
+type activeMember struct {
+	uin      uint32
+	name     string
+	lastSeen time.Time
+}
+
+// memberActivity 记录绑定群中群友的最近发言时间
+type memberActivity struct {
+	mu      sync.Mutex
+	members map[uint32]map[uint32]*activeMember
+}
+
+// touch 记录群友发言
+func (a *memberActivity) touch(groupUin uint32, uin uint32, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	group, ok := a.members[groupUin]
+	if !ok {
+		group = make(map[uint32]*activeMember)
+		a.members[groupUin] = group
+	}
+	group[uin] = &activeMember{uin: uin, name: name, lastSeen: time.Now()}
+}
+
+// active 获取时间窗口内发过言的群友，按群号分组
+func (a *memberActivity) active(window time.Duration) map[uint32][]activeMember {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	result := make(map[uint32][]activeMember)
+	for gid, group := range a.members {
+		for uin, m := range group {
+			if now.Sub(m.lastSeen) >= window {
+				delete(group, uin)
+				continue
+			}
+			result[gid] = append(result[gid], *m)
+		}
+	}
+	return result
+}
+
+var groupActivity = &memberActivity{members: make(map[uint32]map[uint32]*activeMember)}
+
+// OnlineMembersHandler 游戏内查询最近活跃的群友
+type OnlineMembersHandler struct{}
+
+func (h *OnlineMembersHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	active := groupActivity.active(memberActiveWindow)
+	var sb strings.Builder
+	for _, gid := range config.GlobalConfig.Other.BindGroups {
+		members := active[gid]
+		if len(members) == 0 {
+			continue
+		}
+		slices.SortFunc(members, func(a, b activeMember) int {
+			return b.lastSeen.Compare(a.lastSeen)
+		})
+		names := make([]string, 0, len(members))
+		for _, m := range members {
+			names = append(names, m.name)
+		}
+		groupName := strconv.FormatUint(uint64(gid), 10)
+		if info := bot.QQClient.Client().GetCachedGroupInfo(gid); info != nil {
+			groupName = info.GroupName
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s\n", groupName, strings.Join(names, "、")))
+	}
+	if sb.Len() == 0 {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("最近 %s 内没有群友发言", formatDuration(memberActiveWindow))))
+		return nil
+	}
+	ctx.Reply(simpleTextElements(fmt.Sprintf("最近 %s 内发言的群友:\n%s",
+		formatDuration(memberActiveWindow), strings.TrimSuffix(sb.String(), "\n"))))
+	return nil
+}
+
+// SendToQQHandler 游戏内向群友发送消息 !qq <QQ号或群名片> <消息>
+// 与游戏聊天转发到群聊一样经过刷屏保护、消息审核与群聊转发策略
+type SendToQQHandler struct{}
+
+func (h *SendToQQHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	player, ok := dstPlayerOf(ctx)
+	if !ok {
+		return nil
+	}
+	target := args.String("群友")
+
+	gid, uin, ok := findBindGroupMember(target)
+	if !ok {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("绑定群中找不到群友 %s", target)))
+		return nil
+	}
+	if !allowFlood(player.msg) {
+		ctx.Reply(simpleTextElements("发送过于频繁，请稍后再试"))
+		return nil
+	}
+	content, ok := moderate(PolicyToQQ, args.String("消息"), player.msg.KleiID, player.SenderName(), player.msg.Cluster)
+	if !ok {
+		ctx.Reply(simpleTextElements("消息未通过审核，未发送"))
+		return nil
+	}
+	bot.QQClient.Client().SendGroupMessage(gid, []message.IMessageElement{
+		message.NewAt(uin),
+		message.NewText(fmt.Sprintf(" 游戏内玩家 %s 对你说: %s", player.SenderName(), content)),
+	})
+	ctx.Reply(simpleTextElements("消息已发送"))
+	return nil
+}
+
+// findBindGroupMember 在允许转发到群聊的绑定群中按QQ号或群名片查找群友
+func findBindGroupMember(target string) (uint32, uint32, bool) {
+	client := bot.QQClient.Client()
+	groups := qqTargetGroups()
+	if id, err := strconv.ParseUint(target, 10, 32); err == nil {
+		for _, gid := range groups {
+			if client.GetCachedMemberInfo(uint32(id), gid) != nil {
+				return gid, uint32(id), true
+			}
+		}
+	}
+	for _, gid := range groups {
+		for uin, member := range client.GetCachedMembersInfo(gid) {
+			if member.DisplayName() == target || member.Nickname == target {
+				return gid, uin, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// gameCommands 游戏内命令，未配置命令前缀时为空
+func gameCommands() []*logic.Command {
+	prefix := config.GlobalConfig.Other.GameCommandPrefix
+	if prefix == "" {
+		return nil
+	}
+	prefixes := []string{prefix}
+	sources := []string{"external"}
+	return []*logic.Command{
+		{
+			Name:        "help",
+			Prefixes:    prefixes,
+			Sources:     sources,
+			Description: "显示帮助",
+			Args:        []logic.Arg{{Name: "命令"}},
+			Handler:     &HelpHandler{},
+		},
+		{
+			Name:        "在线群友",
+			Prefixes:    prefixes,
+			Sources:     sources,
+			Description: "查看最近发言的群友",
+			Handler:     &OnlineMembersHandler{},
+		},
+		{
+			Name:        "qq",
+			Prefixes:    prefixes,
+			Sources:     sources,
+			Description: "在群里@群友并发送消息",
+			Args: []logic.Arg{
+				{Name: "群友", Required: true, Description: "QQ号或群名片"},
+				{Name: "消息", Type: logic.ArgText, Required: true},
+			},
+			Handler: &SendToQQHandler{},
+		},
+	}
+}
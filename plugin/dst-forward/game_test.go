@@ -0,0 +1,78 @@
+package dstforward
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"llma.dev/config"
+	"llma.dev/logic"
+)
+
+func TestDispatchGameCommand(t *testing.T) {
+	savedConfig, savedManager := config.GlobalConfig, logic.Manager
+	defer func() { config.GlobalConfig, logic.Manager = savedConfig, savedManager }()
+
+	config.GlobalConfig = &config.Config{Other: config.OtherConfig{GameCommandPrefix: "!"}}
+	logic.Manager = logic.NewLogicManager(nil)
+	handled := make(chan string, 1)
+	err := logic.Manager.RegisterCommand(&logic.Command{
+		Name:     "ping",
+		Prefixes: []string{"!"},
+		Sources:  []string{"external"},
+		Handler: logic.CommandHandlerFunc(func(ctx *logic.MessageContext, _ logic.Args) error {
+			handled <- ctx.GetMessageText()
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有匹配到游戏内命令的消息才会被消费，其余按聊天转发
+	tests := map[string]bool{
+		"!ping":   true,
+		" !ping ": true,
+		"!!!":     false,
+		"!pong":   false,
+		"ping":    false,
+		"hello !": false,
+	}
+	for text, want := range tests {
+		msg := DstMsg{UserName: "wilson", KleiID: "KU_1", Message: text}
+		if got := dispatchGameCommand(msg); got != want {
+			t.Errorf("dispatchGameCommand(%q) = %v, want %v", text, got, want)
+		}
+		if want {
+			<-handled
+		}
+	}
+}
+
+func TestModRequestTrusted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		allowedIPs []string
+		token      string
+		header     string
+		want       bool
+	}{
+		{"无令牌无白名单", nil, "", "", false},
+		{"白名单", []string{"127.0.0.1"}, "", "", true},
+		{"令牌正确", nil, "secret", "Bearer secret", true},
+		{"令牌错误", nil, "secret", "Bearer guess", false},
+		{"缺少令牌", []string{"127.0.0.1"}, "secret", "", false},
+		{"格式错误", nil, "secret", "secret", false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/send_msg", nil)
+		if tt.header != "" {
+			c.Request.Header.Set("Authorization", tt.header)
+		}
+		if got := modRequestTrusted(c, tt.allowedIPs, tt.token); got != tt.want {
+			t.Errorf("%s: modRequestTrusted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
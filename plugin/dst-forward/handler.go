@@ -3,7 +3,7 @@ package dstforward
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -15,201 +15,632 @@ import (
 	"llma.dev/utils/llog"
 )
 
-// EchoHandler 回声处理器
-type EchoHandler struct{}
+// 命令权限，角色权限与角色同名，见 registerRolePermissions
+const (
+	PermOwner    = "owner"    // 所有者
+	PermAdmin    = "admin"    // 管理员及以上角色
+	PermOperator = "operator" // 操作员及以上角色
+	PermLua      = "lua"      // 管理员及以上角色，且在 allowedLuaUIDs 中
+)
 
-func (h *EchoHandler) Handle(ctx *logic.MessageContext) error {
-	text := ctx.GetMessageText()
-	if text == "" {
-		return nil
+// kleiIDArg 科雷id参数
+func kleiIDArg(name string, required bool, description string) logic.Arg {
+	return logic.Arg{
+		Name:        name,
+		Required:    required,
+		Description: description,
+		Parse: func(raw string) (any, error) {
+			if !strings.HasPrefix(raw, "KU_") || len(raw) <= len("KU_") {
+				return nil, fmt.Errorf("必须是以 KU_ 开头的科雷id")
+			}
+			return raw, nil
+		},
 	}
+}
+
+// durationArg 封禁时长参数
+func durationArg(name string, description string) logic.Arg {
+	return logic.Arg{
+		Name:        name,
+		Description: description,
+		Parse: func(raw string) (any, error) {
+			d, ok := parseBanDuration(raw)
+			if !ok {
+				return nil, fmt.Errorf("格式应为 3d、12h 或 1d12h30m")
+			}
+			return d, nil
+		},
+	}
+}
+
+// EchoHandler 回声处理器
+type EchoHandler struct{}
 
+func (h *EchoHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
 	ctx.Reply([]message.IMessageElement{
-		message.NewText("你说了: " + text),
+		message.NewText("你说了: " + args.String("消息")),
 	})
-
 	return nil
 }
 
 // SaveHandler 存档处理器
 type SaveHandler struct{}
 
-func (h *SaveHandler) Handle(ctx *logic.MessageContext) error {
-
-	if privateMsg, ok := ctx.GetPrivateMessage(); ok {
-		GlobalMsgQueue.enqueueCmdMsgByPrivate(
-			"save",
-			nil,
-			privateMsg)
-		ctx.Reply(simpleTextElements("保存成功!"))
-		return nil
-	}
-	if groupMsg, ok := ctx.GetGroupMessage(); ok {
-		GlobalMsgQueue.enqueueCmdMsgByGroup(
-			"save",
-			nil,
-			groupMsg)
+func (h *SaveHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	if enqueueCmd(ctx, "save", nil) {
 		ctx.Reply(simpleTextElements("保存成功!"))
-		return nil
 	}
-
 	return nil
 }
 
 // RollBackHandler 回档处理器
 type RollBackHandler struct{}
 
-func (h *RollBackHandler) Handle(ctx *logic.MessageContext) error {
-	text := ctx.GetMessageText()
-	if text == "" {
+func (h *RollBackHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	dayNum := args.Int("天数")
+	llog.Debugf("[回档]回档天数: %d", dayNum)
+
+	confirmFunc := func() {
+		if enqueueCmd(ctx, "rollback", dayNum) {
+			ctx.Reply(simpleTextElements(fmt.Sprintf("已下发回档 %d 天命令", dayNum)))
+		}
+	}
+	cancelFunc := func() {
+		ctx.Reply(simpleTextElements("已取消回档操作"))
+	}
+
+	ctx.Confirm(fmt.Sprintf("回档 %d 天", dayNum), 0, confirmFunc, cancelFunc)
+	return nil
+}
+
+// BanHandler 封禁处理器
+type BanHandler struct{}
+
+func (h *BanHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	kleiId := args.String("科雷id")
+	duration, _ := args.Get("时长").(time.Duration)
+
+	operator, operatorName, _ := senderInfo(ctx)
+	ban := Ban{
+		KleiID:       kleiId,
+		Reason:       args.String("原因"),
+		Operator:     operator,
+		OperatorName: operatorName,
+		CreatedAt:    time.Now(),
+		Clusters:     []string{commandCluster(ctx)},
+	}
+	if duration > 0 {
+		ban.ExpireAt = ban.CreatedAt.Add(duration)
+	}
+
+	if !enqueueCmdTo(ctx, ban.Clusters[0], "ban", kleiId) {
 		return nil
 	}
-	privateMsg, isPrivate := ctx.GetPrivateMessage()
-	groupMsg, isGroup := ctx.GetGroupMessage()
+	GlobalBanStore.Add(ban)
+
+	if duration > 0 {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("已在集群 %s 将用户 %s 封禁 %s", ban.Clusters[0], kleiId, formatDuration(duration))))
+	} else {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("已在集群 %s 将用户 %s 封禁", ban.Clusters[0], kleiId)))
+	}
+	return nil
+}
 
-	re := regexp.MustCompile(`/回档\s+(\d+)`) // 捕获数字
-	match := re.FindStringSubmatch(text)
-	var dayNum int
-	if len(match) > 1 {
-		dayNum, _ = strconv.Atoi(match[1])
-		llog.Debugf("[回档]匹配到数字: %d", dayNum)
+// UnbanHandler 解封处理器
+type UnbanHandler struct{}
+
+func (h *UnbanHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	kleiId := args.String("科雷id")
+	if _, _, ok := sessionOf(ctx); !ok {
+		return nil
+	}
+	clusters := []string{commandCluster(ctx)}
+	removed, found := GlobalBanStore.Remove(kleiId)
+	if found {
+		for _, cluster := range removed.clusters() {
+			if !slices.Contains(clusters, cluster) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+	for _, cluster := range clusters {
+		enqueueCmdTo(ctx, cluster, "unban", kleiId)
 	}
-	if len(match) <= 1 || dayNum < 1 {
-		ctx.Reply(simpleTextElements("请输入有效的回档天数 示例: /回档 1"))
+	if !found {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("本地无 %s 的封禁记录，已尝试在集群 %s 下发解封命令", kleiId, clusters[0])))
 		return nil
-	} else if dayNum > 100 {
-		ctx.Reply(simpleTextElements("输入的回档天数过长，请输入有效的回档天数 示例: /回档 1"))
+	}
+	ctx.Reply(simpleTextElements(fmt.Sprintf("已将用户 %s 在集群 %s 解封", kleiId, strings.Join(clusters, "、"))))
+	return nil
+}
+
+// BanListHandler 封禁列表处理器
+type BanListHandler struct{}
+
+func (h *BanListHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	bans := GlobalBanStore.List()
+	if len(bans) == 0 {
+		ctx.Reply(simpleTextElements("当前没有封禁记录"))
 		return nil
 	}
+	lines := make([]string, 0, len(bans)+1)
+	lines = append(lines, fmt.Sprintf("封禁列表 (共 %d 条):", len(bans)))
+	for _, b := range bans {
+		lines = append(lines, b.String())
+	}
+	ctx.Reply(simpleTextElements(strings.Join(lines, "\n")))
+	return nil
+}
+
+// KickHandler 踢出玩家处理器
+type KickHandler struct{}
+
+func (h *KickHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	kleiId := args.String("科雷id")
 
 	confirmFunc := func() {
-		okElements := simpleTextElements(fmt.Sprintf("已下发回档 %d 天命令", dayNum))
-		if isPrivate {
-			GlobalMsgQueue.enqueueCmdMsgByPrivate(
-				"rollback",
-				dayNum,
-				privateMsg)
-			ctx.Reply(okElements)
-			return
+		if enqueueCmd(ctx, "kick", kleiId) {
+			ctx.Reply(simpleTextElements(fmt.Sprintf("已将用户 %s 踢出", kleiId)))
 		}
-		if isGroup {
-			GlobalMsgQueue.enqueueCmdMsgByGroup(
-				"rollback",
-				dayNum,
-				groupMsg)
-			ctx.Reply(okElements)
-			return
+	}
+	cancelFunc := func() {
+		ctx.Reply(simpleTextElements("已取消踢出操作"))
+	}
+
+	ctx.Confirm(fmt.Sprintf("踢出 %s", kleiId), 0, confirmFunc, cancelFunc)
+	return nil
+}
+
+// AnnounceHandler 游戏内公告处理器
+type AnnounceHandler struct{}
+
+func (h *AnnounceHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	if enqueueCmd(ctx, "announce", args.String("内容")) {
+		ctx.Reply(simpleTextElements("已发送公告"))
+	}
+	return nil
+}
+
+// RestartHandler 重启服务器处理器
+type RestartHandler struct{}
+
+func (h *RestartHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	confirmFunc := func() {
+		if enqueueCmd(ctx, "restart", nil) {
+			ctx.Reply(simpleTextElements("已下发重启命令"))
 		}
 	}
+	cancelFunc := func() {
+		ctx.Reply(simpleTextElements("已取消重启操作"))
+	}
+
+	ctx.Confirm("重启服务器", 0, confirmFunc, cancelFunc)
+	return nil
+}
+
+// LuaHandler 远程控制台处理器，执行结果通过 /cmd_result 回传
+type LuaHandler struct{}
+
+func (h *LuaHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	code := args.String("代码")
 
+	confirmFunc := func() {
+		if enqueueCmdWithResult(ctx, "lua", code) {
+			ctx.Reply(simpleTextElements("已下发代码，等待执行结果"))
+		}
+	}
 	cancelFunc := func() {
-		ctx.Reply(simpleTextElements("已取消回档操作"))
+		ctx.Reply(simpleTextElements("已取消执行代码"))
 	}
 
-	ctx.Prompt(fmt.Sprintf("回档 %d 天", dayNum), 30*time.Second, confirmFunc, cancelFunc)
+	ctx.Confirm(fmt.Sprintf("执行代码 %s", code), 0, confirmFunc, cancelFunc)
 	return nil
 }
 
-// BanHandler 封禁处理器
-type BanHandler struct{}
+// ScheduleListHandler 计划任务列表处理器
+type ScheduleListHandler struct{}
 
-func (h *BanHandler) Handle(ctx *logic.MessageContext) error {
-	text := ctx.GetMessageText()
-	if text == "" {
+func (h *ScheduleListHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	jobs := GlobalScheduler.List()
+	if len(jobs) == 0 {
+		ctx.Reply(simpleTextElements("当前没有计划任务"))
 		return nil
 	}
+	lines := make([]string, 0, len(jobs)+1)
+	lines = append(lines, fmt.Sprintf("计划任务 (共 %d 个):", len(jobs)))
+	for _, job := range jobs {
+		lines = append(lines, job.String())
+	}
+	ctx.Reply(simpleTextElements(strings.Join(lines, "\n")))
+	return nil
+}
 
-	re := regexp.MustCompile(`/ban\s+(KU_\S+)`) // 捕获字符串
-	match := re.FindStringSubmatch(text)
-	var kleiId string
-	if len(match) > 1 {
-		kleiId = match[1]
-		llog.Debugf("[ban]匹配到kleiid: %s", kleiId)
+// ScheduleAddHandler 添加计划任务处理器
+type ScheduleAddHandler struct{}
+
+func (h *ScheduleAddHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	// cron 表达式由5个字段组成，剩余部分为动作、选项与内容
+	fields := strings.Fields(args.String("cron与动作"))
+	if len(fields) < 6 {
+		return logic.NewUsageError("请输入 分 时 日 月 周 与动作 示例: /计划 添加 维护重启 0 5 * * * restart 提醒=10,5,1")
+	}
+	job := &Job{
+		Name:   args.String("名称"),
+		Spec:   strings.Join(fields[:5], " "),
+		Action: fields[5],
+	}
+	content, err := parseJobOptions(job, fields[6:])
+	if err != nil {
+		return logic.NewUsageError("%s", err.Error())
 	}
-	if len(match) <= 1 {
-		errorElemets := simpleTextElements("请输入有效的kleiid 示例: /ban KU_xxxxx")
-		ctx.Reply(errorElemets)
+	job.Content = strings.Join(content, " ")
+	if err := GlobalScheduler.Add(job); err != nil {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("添加计划任务失败: %s", err.Error())))
 		return nil
 	}
+	ctx.Reply(simpleTextElements("已添加计划任务 " + job.String()))
+	return nil
+}
 
-	okElements := simpleTextElements(fmt.Sprintf("已将用户 %s 封禁", kleiId))
-	if privateMsg, ok := ctx.GetPrivateMessage(); ok {
-		GlobalMsgQueue.enqueueCmdMsgByPrivate(
-			"ban",
-			kleiId,
-			privateMsg)
-		ctx.Reply(okElements)
+// ScheduleRemoveHandler 删除计划任务处理器
+type ScheduleRemoveHandler struct{}
+
+func (h *ScheduleRemoveHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	name := args.String("名称")
+	if err := GlobalScheduler.Remove(name); err != nil {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("删除计划任务失败: %s", err.Error())))
 		return nil
 	}
-	if groupMsg, ok := ctx.GetGroupMessage(); ok {
-		GlobalMsgQueue.enqueueCmdMsgByGroup(
-			"ban",
-			kleiId,
-			groupMsg)
-		ctx.Reply(okElements)
+	ctx.Reply(simpleTextElements("已删除计划任务 " + name))
+	return nil
+}
+
+// ArchiveSearchHandler 聊天记录查询处理器
+type ArchiveSearchHandler struct{}
+
+func (h *ArchiveSearchHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	if GlobalArchive == nil {
+		ctx.Reply(simpleTextElements("未启用聊天记录存档"))
 		return nil
 	}
 
+	records, err := GlobalArchive.Search(args.String("关键词"), 10)
+	if err != nil {
+		return fmt.Errorf("检索聊天记录失败: %w", err)
+	}
+	if len(records) == 0 {
+		ctx.Reply(simpleTextElements("未找到相关记录"))
+		return nil
+	}
+	lines := make([]string, 0, len(records)+1)
+	lines = append(lines, fmt.Sprintf("最近 %d 条相关记录:", len(records)))
+	for _, r := range records {
+		lines = append(lines, fmt.Sprintf("[%s] %s: %s", r.Time.Format("01-02 15:04"), r.SenderName, r.Content))
+	}
+	ctx.Reply(simpleTextElements(strings.Join(lines, "\n")))
 	return nil
 }
 
-// ResetHandler 重置世界处理器
-type ResetHandler struct{}
+// StatsHandler 玩家统计处理器
+type StatsHandler struct{}
 
-func (h *ResetHandler) Handle(ctx *logic.MessageContext) error {
+func (h *StatsHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	if GlobalStats == nil {
+		ctx.Reply(simpleTextElements("未启用玩家统计"))
+		return nil
+	}
 
-	confirmFunc := func() {
-		okElements := simpleTextElements("已重置世界")
-		if privateMsg, ok := ctx.GetPrivateMessage(); ok {
-			GlobalMsgQueue.enqueueCmdMsgByPrivate(
-				"reset",
-				nil,
-				privateMsg)
-			ctx.Reply(okElements)
+	kleiId := args.String("科雷id")
+	if kleiId == "" {
+		// 未指定时查询自己绑定的账号
+		uin, _, ok := senderInfo(ctx)
+		if !ok {
+			return nil
 		}
-		if groupMsg, ok := ctx.GetGroupMessage(); ok {
-			GlobalMsgQueue.enqueueCmdMsgByGroup(
-				"reset",
-				nil,
-				groupMsg)
-			ctx.Reply(okElements)
+		binding, found := GlobalBindStore.ByQQ(uin)
+		if !found {
+			return logic.NewUsageError("请输入科雷id，或先使用 /绑定 绑定游戏账号")
 		}
+		kleiId = binding.KleiID
 	}
 
+	stats, ok := GlobalStats.Get(args.String("集群"), kleiId)
+	if !ok {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("没有 %s 的统计数据", kleiId)))
+		return nil
+	}
+	ctx.Reply(simpleTextElements(stats.String()))
+	return nil
+}
+
+// RankHandler 排行榜处理器
+type RankHandler struct{}
+
+func (h *RankHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	if GlobalStats == nil {
+		ctx.Reply(simpleTextElements("未启用玩家统计"))
+		return nil
+	}
+
+	kind := RankPlaytime
+	if args.Has("类型") {
+		kind = args.String("类型")
+	}
+	lines, err := GlobalStats.Rank(args.String("集群"), kind, 10)
+	if err != nil {
+		ctx.Reply(simpleTextElements(err.Error()))
+		return nil
+	}
+	if len(lines) == 0 {
+		ctx.Reply(simpleTextElements("暂无统计数据"))
+		return nil
+	}
+	ctx.Reply(simpleTextElements(kind + "排行:\n" + strings.Join(lines, "\n")))
+	return nil
+}
+
+// ModerationReloadHandler 重载审核规则处理器
+type ModerationReloadHandler struct{}
+
+func (h *ModerationReloadHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	if err := reloadModeration(); err != nil {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("重载审核规则失败，已保留原规则: %s", err.Error())))
+		return nil
+	}
+	if GlobalModerator.Load() == nil {
+		ctx.Reply(simpleTextElements("消息审核未启用"))
+		return nil
+	}
+	ctx.Reply(simpleTextElements("已重载审核规则"))
+	return nil
+}
+
+// ResetHandler 重置世界处理器
+type ResetHandler struct{}
+
+func (h *ResetHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	confirmFunc := func() {
+		if enqueueCmd(ctx, "reset", nil) {
+			ctx.Reply(simpleTextElements("已重置世界"))
+		}
+	}
 	cancelFunc := func() {
 		ctx.Reply(simpleTextElements("已取消重置世界操作"))
 	}
 
-	ctx.Prompt("重置世界", 30*time.Second, confirmFunc, cancelFunc)
+	ctx.Confirm("重置世界", 0, confirmFunc, cancelFunc)
 	return nil
 }
 
-// HelpHandler 帮助命令处理器
-type HelpHandler struct{}
+// BindHandler 绑定科雷id处理器
+type BindHandler struct{}
 
-func (h *HelpHandler) Handle(ctx *logic.MessageContext) error {
-	help := `可用命令:
-/help - 显示帮助
-/echo <消息> - 回声消息
-/回档 <天数> - 回档指定天数
-/保存 - 即时存档
-/重置世界 - 重新生成整个世界(谨慎使用)
-/ban <科雷id> - 封禁玩家
-`
+func (h *BindHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	kleiId := args.String("科雷id")
 
-	if privateMsg, ok := ctx.GetPrivateMessage(); ok {
-		ctx.Client.SendPrivateMessage(privateMsg.Sender.Uin, []message.IMessageElement{
-			message.NewText(help),
-		})
-	} else if groupMsg, ok := ctx.GetGroupMessage(); ok {
-		ctx.Client.SendGroupMessage(groupMsg.GroupUin, []message.IMessageElement{
-			message.NewText(help),
-		})
+	uin, name, ok := senderInfo(ctx)
+	if !ok {
+		return nil
 	}
 
+	code, err := GlobalBindStore.Request(kleiId, uin, name, func(text string) {
+		ctx.Reply(simpleTextElements(text))
+	})
+	if err != nil {
+		return fmt.Errorf("生成验证码失败: %w", err)
+	}
+	ctx.Reply(simpleTextElements(fmt.Sprintf(
+		"请在 %s 内使用 %s 在游戏中发送验证码 %s 完成绑定",
+		bindCodeTTL.String(), kleiId, code)))
+	return nil
+}
+
+// QueryBindHandler 查询绑定处理器
+type QueryBindHandler struct{}
+
+func (h *QueryBindHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	var (
+		binding Binding
+		found   bool
+	)
+	switch {
+	case args.Has("科雷id"):
+		binding, found = GlobalBindStore.ByKleiID(args.String("科雷id"))
+	case args.Has("QQ号"):
+		binding, found = GlobalBindStore.ByQQ(args.Uin("QQ号"))
+	default:
+		// 未指定参数时查询自己
+		uin, _, ok := senderInfo(ctx)
+		if !ok {
+			return nil
+		}
+		binding, found = GlobalBindStore.ByQQ(uin)
+	}
+
+	if !found {
+		ctx.Reply(simpleTextElements("未找到绑定记录"))
+		return nil
+	}
+	ctx.Reply(simpleTextElements(fmt.Sprintf(
+		"%s <-> %s(%d)\n绑定时间: %s",
+		binding.KleiID, binding.QQName, binding.QQ,
+		binding.BoundAt.Format("2006-01-02 15:04:05"))))
+	return nil
+}
+
+// HelpHandler 帮助命令处理器，帮助文本由已注册的命令生成
+type HelpHandler struct{}
+
+func (h *HelpHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	help, ok := logic.Manager.Help(ctx, args.String("命令"))
+	if !ok {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("命令 %s 不存在", args.String("命令"))))
+		return nil
+	}
+	ctx.Reply(simpleTextElements(help))
 	return nil
 }
 
+// builtinCommands 内置命令
+func builtinCommands() []*logic.Command {
+	return []*logic.Command{
+		{
+			Name:        "help",
+			Description: "显示帮助，指定命令时显示该命令的详细用法",
+			Args:        []logic.Arg{{Name: "命令"}},
+			Handler:     &HelpHandler{},
+		},
+		{
+			Name:        "echo",
+			Description: "回声消息",
+			Args:        []logic.Arg{{Name: "消息", Type: logic.ArgText, Required: true}},
+			Handler:     &EchoHandler{},
+		},
+		{
+			Name:        "保存",
+			Description: "即时存档",
+			Permission:  PermOperator,
+			Handler:     &SaveHandler{},
+		},
+		{
+			Name:        "回档",
+			Description: "回档指定天数",
+			Permission:  PermAdmin,
+			Args:        []logic.Arg{{Name: "天数", Type: logic.ArgInt, Required: true, Min: 1, Max: 100}},
+			Handler:     &RollBackHandler{},
+		},
+		{
+			Name:        "重置世界",
+			Description: "重新生成整个世界(谨慎使用)",
+			Permission:  PermOwner,
+			Handler:     &ResetHandler{},
+		},
+		{
+			Name:        "ban",
+			Description: "在当前集群封禁玩家，使用 /集群 切换集群",
+			Permission:  PermAdmin,
+			Args: []logic.Arg{
+				kleiIDArg("科雷id", true, ""),
+				durationArg("时长", "如 3d、12h 或 1d12h30m，不填为永久"),
+				{Name: "原因", Type: logic.ArgText},
+			},
+			Handler: &BanHandler{},
+		},
+		{
+			Name:        "unban",
+			Description: "解封玩家，同时在封禁记录中的全部集群解封",
+			Permission:  PermAdmin,
+			Args:        []logic.Arg{kleiIDArg("科雷id", true, "")},
+			Handler:     &UnbanHandler{},
+		},
+		{
+			Name:        "banlist",
+			Description: "查看封禁列表",
+			Permission:  PermOperator,
+			Handler:     &BanListHandler{},
+		},
+		{
+			Name:        "kick",
+			Description: "踢出玩家",
+			Permission:  PermOperator,
+			Args:        []logic.Arg{kleiIDArg("科雷id", true, "")},
+			Handler:     &KickHandler{},
+		},
+		{
+			Name:        "公告",
+			Description: "发送游戏内公告",
+			Permission:  PermOperator,
+			Args:        []logic.Arg{{Name: "内容", Type: logic.ArgText, Required: true}},
+			Handler:     &AnnounceHandler{},
+		},
+		{
+			Name:        "重启",
+			Description: "重启服务器",
+			Permission:  PermAdmin,
+			Handler:     &RestartHandler{},
+		},
+		{
+			Name:        "lua",
+			Description: "在服务器控制台执行代码",
+			Permission:  PermLua,
+			Args:        []logic.Arg{{Name: "代码", Type: logic.ArgText, Required: true}},
+			Handler:     &LuaHandler{},
+		},
+		{
+			Name:        "计划",
+			Description: "管理计划任务",
+			Permission:  PermAdmin,
+			Handler:     &ScheduleListHandler{},
+			Subcommands: []*logic.Command{
+				{Name: "列表", Description: "查看计划任务", Handler: &ScheduleListHandler{}},
+				{
+					Name:        "添加",
+					Description: "添加计划任务，动作: save 存档, announce 公告, restart 重启, message 群消息",
+					Args: []logic.Arg{
+						{Name: "名称", Required: true},
+						{Name: "cron与动作", Type: logic.ArgText, Required: true,
+							Description: "分 时 日 月 周 动作 [提醒=分钟,分钟] [集群=名称] [内容]，如 0 5 * * * restart 提醒=10,5,1"},
+					},
+					Handler: &ScheduleAddHandler{},
+				},
+				{
+					Name:        "删除",
+					Description: "删除计划任务",
+					Args:        []logic.Arg{{Name: "名称", Required: true}},
+					Handler:     &ScheduleRemoveHandler{},
+				},
+			},
+		},
+		{
+			Name:        "审核",
+			Description: "管理消息审核",
+			Permission:  PermAdmin,
+			Subcommands: []*logic.Command{
+				{Name: "重载", Description: "重新加载消息审核规则", Handler: &ModerationReloadHandler{}},
+			},
+		},
+		{
+			Name:        "绑定",
+			Description: "绑定游戏账号",
+			Args:        []logic.Arg{kleiIDArg("科雷id", true, "")},
+			Handler:     &BindHandler{},
+		},
+		{
+			Name:        "查绑定",
+			Description: "查询绑定关系，不填时查询自己",
+			Args: []logic.Arg{
+				kleiIDArg("科雷id", false, ""),
+				{Name: "QQ号", Type: logic.ArgUin},
+			},
+			Handler: &QueryBindHandler{},
+		},
+		{
+			Name:        "查记录",
+			Description: "检索聊天记录",
+			Args:        []logic.Arg{{Name: "关键词", Type: logic.ArgText, Required: true, Description: "关键词、玩家名称或科雷id"}},
+			Handler:     &ArchiveSearchHandler{},
+		},
+		{
+			Name:        "统计",
+			Description: "查询玩家统计，不填科雷id时查询自己绑定的账号",
+			Args: []logic.Arg{
+				kleiIDArg("科雷id", false, ""),
+				{Name: "集群"},
+			},
+			Handler: &StatsHandler{},
+		},
+		{
+			Name:        "排行",
+			Description: "查看排行榜",
+			Args: []logic.Arg{
+				{Name: "类型", Choices: []string{RankPlaytime, RankMessages, RankDeaths}},
+				{Name: "集群"},
+			},
+			Handler: &RankHandler{},
+		},
+	}
+}
+
 // RegisterCustomLogic 注册所有自定义逻辑
 func RegisterCustomLogic() {
 	if logic.Manager == nil {
@@ -220,60 +651,88 @@ func RegisterCustomLogic() {
 	groupMiddle := logic.AllowedGroupMiddleware(config.GlobalConfig.Other.AllowedGroups)
 	logic.Manager.GetRouter().Use(groupMiddle)
 
-	// 身份认证列表
-	authMiddle := logic.AuthMiddleware(config.GlobalConfig.Other.AllowedUIDs)
+	// 远程控制台权限，为空时禁用
+	luaAuthMiddle := logic.StrictAuthMiddleware(config.GlobalConfig.Other.AllowedLuaUIDs)
 
-	// 注册help命令
-	logic.Manager.HandleCommand("/", "help", func(ctx *logic.MessageContext) error {
-		handler := &HelpHandler{}
-		return handler.Handle(ctx)
+	if prefixes := config.GlobalConfig.Other.CommandPrefixes; len(prefixes) > 0 {
+		if err := logic.Manager.SetCommandPrefixes(prefixes...); err != nil {
+			llog.Errorf("[dst forward] 设置命令前缀失败: %v", err)
+		}
+	}
+	conversation := config.GlobalConfig.Conversation
+	logic.Manager.Conversations().SetKeywords(conversation.ConfirmWords, conversation.CancelWords)
+	logic.Manager.Conversations().SetDefaultTimeout(time.Duration(conversation.TimeoutSeconds) * time.Second)
+	errorReply := config.GlobalConfig.ErrorReply
+	policy, err := logic.NewErrorPolicy(logic.ErrorPolicyOptions{
+		Templates:    errorReply.Templates,
+		Internal:     errorReply.Internal,
+		QuoteInGroup: errorReply.QuoteInGroup,
+		Throttle:     time.Duration(errorReply.ThrottleSeconds) * time.Second,
 	})
+	if err != nil {
+		llog.Errorf("[dst forward] 错误回复配置无效，使用默认配置: %v", err)
+	} else {
+		logic.Manager.SetErrorPolicy(policy)
+	}
 
-	// 注册echo命令
-	logic.Manager.HandleCommand("/", "echo", func(ctx *logic.MessageContext) error {
-		handler := &EchoHandler{}
-		return handler.Handle(ctx)
-	})
+	registerRolePermissions()
+	logic.Manager.RegisterPermission(PermLua, "远程控制台",
+		logic.ChainMiddleware(logic.RoleMiddleware(logic.RoleAdmin, resolveRole), luaAuthMiddle))
+
+	commands := builtinCommands()
+	// 权限管理命令
+	commands = append(commands, roleCommands()...)
+	// 集群切换命令
+	commands = append(commands, clusterCommands()...)
+	// 配置文件中的自定义命令
+	commands = append(commands, configCommands()...)
+	// 游戏内命令
+	commands = append(commands, gameCommands()...)
+	applyCommandRoles(commands, config.GlobalConfig.Role.Commands)
+	applyCommandCooldowns(commands, config.GlobalConfig.RateLimit.Commands)
+	logic.Manager.SetRateLimitIdle(time.Duration(config.GlobalConfig.RateLimit.IdleSeconds) * time.Second)
+	for _, cmd := range commands {
+		if err := logic.Manager.RegisterCommand(cmd); err != nil {
+			llog.Errorf("[dst forward] 注册命令失败，已跳过: %v", err)
+		}
+	}
 
-	logic.Manager.HandleCommand("/", "保存", func(ctx *logic.MessageContext) error {
-		handler := &SaveHandler{}
-		return handler.Handle(ctx)
-	}, authMiddle)
-	logic.Manager.HandleCommand("/", "回档", func(ctx *logic.MessageContext) error {
-		handler := &RollBackHandler{}
-		return handler.Handle(ctx)
-	}, authMiddle)
-	logic.Manager.HandleCommand("/", "重置世界", func(ctx *logic.MessageContext) error {
-		handler := &ResetHandler{}
-		return handler.Handle(ctx)
-	}, authMiddle)
-	logic.Manager.HandleCommand("/", "ban", func(ctx *logic.MessageContext) error {
-		handler := &BanHandler{}
-		return handler.Handle(ctx)
-	}, authMiddle)
-
-	commands := []string{"/help", "/echo", "/回档", "/重置世界", "/ban"}
-
-	// 转发
-	logic.Manager.HandleGroupMessage(func(ctx *logic.MessageContext) error {
+	// 转发，命令路由优先级更高，命令消息已被处理时不会转发
+	logic.Manager.HandleGroupMessageWithPriority(logic.PriorityLow, func(ctx *logic.MessageContext) error {
 		if msg, isOk := ctx.GetGroupMessage(); isOk {
 			llog.Debugf("[dst forward]收到群消息:%v", msg)
-			msgText := msg.ToString()
-			for _, cmd := range commands {
-				if strings.HasPrefix(msgText, cmd) {
-					return nil
-				}
+			// 忽略bot自己发送的消息，避免转发到其他群的消息再被转发
+			if msg.Sender.Uin == ctx.Client.Uin {
+				return nil
+			}
+			name := msg.Sender.CardName
+			if name == "" {
+				name = msg.Sender.Nickname
 			}
-			GlobalMsgQueue.enqueueGroupMessage(msg)
+			groupActivity.touch(msg.GroupUin, msg.Sender.Uin, name)
+			msgText := msg.ToString()
+			relayGroupMessage(msg)
+			archive(ArchiveRecord{
+				Direction:  DirectionToDst,
+				GroupID:    msg.GroupUin,
+				SenderID:   strconv.FormatUint(uint64(msg.Sender.Uin), 10),
+				SenderName: msg.Sender.CardName,
+				Content:    msgText,
+			})
 		}
 		return nil
 	})
 
 	// 注册事件监听器
-	logic.Manager.GetEventBus().Subscribe(logic.EventTypeCommandExecuted, func(ctx context.Context, event logic.Event) error {
-		if msgEvent, ok := event.(*logic.MessageEvent); ok {
-			command := msgEvent.MessageContext.GetString("executed_command")
-			llog.Infof("[dst forward] 命令 %s 已执行", command)
+	logic.Subscribe(logic.Manager.GetEventBus(), func(ctx context.Context, event logic.CommandExecuted) error {
+		llog.Infof("[dst forward] 命令 %s 已执行", event.Command)
+		return nil
+	})
+	logic.Subscribe(logic.Manager.GetEventBus(), func(ctx context.Context, event logic.BotLeftGroup) error {
+		if event.Kicked() {
+			llog.Warningf("[dst forward] 机器人已被 %d 移出群 %d", event.Event.OperatorUin, event.Event.GroupUin)
+		} else {
+			llog.Warningf("[dst forward] 机器人已退出群 %d", event.Event.GroupUin)
 		}
 		return nil
 	})
@@ -304,6 +763,61 @@ func (h *GroupMessageHandler) Handle(client *client.QQClient, msg any) error {
 	return nil
 }
 
+// enqueueCmd 按消息来源将命令插入命令作用集群的队列，无法识别来源时返回 false
+func enqueueCmd(ctx *logic.MessageContext, head string, content any) bool {
+	return enqueueCmdTo(ctx, commandCluster(ctx), head, content)
+}
+
+// enqueueCmdTo 按消息来源将命令插入指定集群的队列，无法识别来源时返回 false
+func enqueueCmdTo(ctx *logic.MessageContext, cluster string, head string, content any) bool {
+	source, sender, ok := sessionOf(ctx)
+	if !ok {
+		return false
+	}
+	queueFor(cluster).enqueueCmdMsg(head, content, source, sender)
+	return true
+}
+
+// sessionOf 获取消息的来源与发送者信息
+func sessionOf(ctx *logic.MessageContext) (Source, Sender, bool) {
+	if privateMsg, ok := ctx.GetPrivateMessage(); ok {
+		return Source{
+			ID:   privateMsg.Sender.Uin,
+			Name: privateMsg.Sender.CardName,
+		}, Sender{
+			ID:   privateMsg.Sender.Uin,
+			Name: privateMsg.Sender.CardName,
+			Nick: privateMsg.Sender.Nickname,
+		}, true
+	}
+	if groupMsg, ok := ctx.GetGroupMessage(); ok {
+		return Source{
+			ID:   groupMsg.GroupUin,
+			Name: groupMsg.GroupName,
+		}, Sender{
+			ID:   groupMsg.Sender.Uin,
+			Name: groupMsg.Sender.CardName,
+			Nick: groupMsg.Sender.Nickname,
+		}, true
+	}
+	return Source{}, Sender{}, false
+}
+
+// senderInfo 获取消息发送者的QQ号与名称
+func senderInfo(ctx *logic.MessageContext) (uint32, string, bool) {
+	if privateMsg, ok := ctx.GetPrivateMessage(); ok {
+		return privateMsg.Sender.Uin, privateMsg.Sender.Nickname, true
+	}
+	if groupMsg, ok := ctx.GetGroupMessage(); ok {
+		name := groupMsg.Sender.CardName
+		if name == "" {
+			name = groupMsg.Sender.Nickname
+		}
+		return groupMsg.Sender.Uin, name, true
+	}
+	return 0, "", false
+}
+
 func simpleTextElements(text string) []message.IMessageElement {
 	return []message.IMessageElement{&message.TextElement{Content: text}}
 }
@@ -0,0 +1,316 @@
+package dstforward
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"llma.dev/bot"
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
+// 审核动作
+const (
+	ModerationMask = "mask" // 将违规内容替换为 *
+	ModerationDrop = "drop" // 丢弃消息
+	ModerationWarn = "warn" // 丢弃消息并通知管理员
+)
+
+// moderationRule 编译后的审核规则
+type moderationRule struct {
+	words     []string
+	regexes   []*regexp.Regexp
+	action    string
+	direction string
+}
+
+// appliesTo 规则是否作用于该方向
+func (r *moderationRule) appliesTo(direction string) bool {
+	return r.direction == PolicyBoth || r.direction == direction
+}
+
+// match 查找文本中命中规则的全部片段
+func (r *moderationRule) match(text string) [][]int {
+	var ranges [][]int
+	lower := strings.ToLower(text)
+	for _, word := range r.words {
+		for start := 0; ; {
+			i := strings.Index(lower[start:], word)
+			if i < 0 {
+				break
+			}
+			ranges = append(ranges, []int{start + i, start + i + len(word)})
+			start += i + len(word)
+		}
+	}
+	for _, re := range r.regexes {
+		ranges = append(ranges, re.FindAllStringIndex(text, -1)...)
+	}
+	return ranges
+}
+
+// ModerationResult 审核结果
+type ModerationResult struct {
+	// Text 处理后的文本
+	Text string
+	// Dropped 消息是否被丢弃
+	Dropped bool
+	// Action 命中的最严重的动作，未命中时为空
+	Action string
+}
+
+// Moderator 双向消息审核
+type Moderator struct {
+	mu      sync.RWMutex
+	cfg     config.ModerationConfig
+	rules   []*moderationRule
+	strikes map[string]int
+}
+
+// NewModerator 创建审核器
+func NewModerator(cfg config.ModerationConfig) (*Moderator, error) {
+	m := &Moderator{strikes: make(map[string]int)}
+	if err := m.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload 重新加载审核规则，规则有误时保留原规则
+func (m *Moderator) Reload(cfg config.ModerationConfig) error {
+	rules := make([]*moderationRule, 0, len(cfg.Rules))
+	for i, rc := range cfg.Rules {
+		rule := &moderationRule{action: rc.Action, direction: rc.Direction}
+		if rule.direction == "" {
+			rule.direction = PolicyBoth
+		}
+		switch rule.direction {
+		case PolicyBoth, PolicyToDst, PolicyToQQ:
+		default:
+			return fmt.Errorf("第 %d 条审核规则的方向 %s 无效", i+1, rc.Direction)
+		}
+		switch rule.action {
+		case ModerationMask, ModerationDrop, ModerationWarn:
+		default:
+			return fmt.Errorf("第 %d 条审核规则的动作 %s 无效", i+1, rc.Action)
+		}
+		for _, word := range rc.Words {
+			if word != "" {
+				rule.words = append(rule.words, strings.ToLower(word))
+			}
+		}
+		for _, pattern := range rc.Regex {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("第 %d 条审核规则的正则 %s 无效: %w", i+1, pattern, err)
+			}
+			rule.regexes = append(rule.regexes, re)
+		}
+		rules = append(rules, rule)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg = cfg
+	m.rules = rules
+	llog.Infof("[dst forward审核] 已加载 %d 条审核规则", len(rules))
+	return nil
+}
+
+// Check 审核消息，player 为违规计数使用的玩家标识(科雷id或QQ号)，name 为展示名称
+// clusters 为自动踢出或封禁下发的集群，为空时下发到默认集群
+func (m *Moderator) Check(direction string, text string, player string, name string, clusters ...string) ModerationResult {
+	result := m.evaluate(direction, text)
+	m.punish(result, text, player, name, clusters)
+	return result
+}
+
+// evaluate 按方向匹配审核规则，不记录违规
+func (m *Moderator) evaluate(direction string, text string) ModerationResult {
+	m.mu.RLock()
+	rules := m.rules
+	m.mu.RUnlock()
+
+	result := ModerationResult{Text: text}
+	for _, rule := range rules {
+		if !rule.appliesTo(direction) {
+			continue
+		}
+		ranges := rule.match(result.Text)
+		if len(ranges) == 0 {
+			continue
+		}
+		switch rule.action {
+		case ModerationMask:
+			result.Text = maskRanges(result.Text, ranges)
+			if result.Action == "" {
+				result.Action = ModerationMask
+			}
+		case ModerationDrop, ModerationWarn:
+			result.Dropped = true
+			if result.Action != ModerationWarn {
+				result.Action = rule.action
+			}
+		}
+	}
+
+	return result
+}
+
+// punish 记录违规并通知管理员，text 为原始消息
+func (m *Moderator) punish(result ModerationResult, text string, player string, name string, clusters []string) {
+	if result.Action == "" {
+		return
+	}
+	llog.Infof("[dst forward审核] %s(%s) 的消息命中审核规则，动作: %s", name, player, result.Action)
+	if result.Action == ModerationWarn {
+		m.warnAdmins(fmt.Sprintf("[审核] %s(%s) 发送了违规消息，已拦截:\n%s", name, player, text))
+	}
+	m.strike(player, name, clusters)
+}
+
+// strike 增加玩家违规次数，达到阈值时向各集群下发踢出或封禁命令
+func (m *Moderator) strike(player string, name string, clusters []string) {
+	if player == "" {
+		return
+	}
+	m.mu.Lock()
+	m.strikes[player]++
+	count := m.strikes[player]
+	cfg := m.cfg
+	if cfg.BanStrikes > 0 && count >= cfg.BanStrikes {
+		delete(m.strikes, player)
+	}
+	m.mu.Unlock()
+
+	// 只有科雷id才能对游戏内玩家执行处罚
+	if !strings.HasPrefix(player, "KU_") {
+		return
+	}
+	if len(clusters) == 0 {
+		clusters = []string{defaultCluster}
+	}
+	switch {
+	case cfg.BanStrikes > 0 && count >= cfg.BanStrikes:
+		ban := Ban{
+			KleiID:       player,
+			Reason:       fmt.Sprintf("违规 %d 次自动封禁", count),
+			OperatorName: "自动审核",
+			CreatedAt:    time.Now(),
+			Clusters:     clusters,
+		}
+		if d, ok := parseBanDuration(cfg.BanDuration); ok {
+			ban.ExpireAt = ban.CreatedAt.Add(d)
+		}
+		GlobalBanStore.Add(ban)
+		for _, cluster := range clusters {
+			queueFor(cluster).enqueueCmdMsg("ban", player, Source{}, Sender{})
+		}
+		m.warnAdmins(fmt.Sprintf("[审核] %s(%s) 违规 %d 次，已自动封禁", name, player, count))
+	case cfg.KickStrikes > 0 && count == cfg.KickStrikes:
+		for _, cluster := range clusters {
+			queueFor(cluster).enqueueCmdMsg("kick", player, Source{}, Sender{})
+		}
+		m.warnAdmins(fmt.Sprintf("[审核] %s(%s) 违规 %d 次，已自动踢出", name, player, count))
+	}
+}
+
+// warnAdmins 私聊通知管理员
+func (m *Moderator) warnAdmins(text string) {
+	for _, uid := range GlobalRoleStore.Admins() {
+		bot.QQClient.Client().SendPrivateMessage(uid, simpleTextElements(text))
+	}
+}
+
+// maskRanges 将命中的片段按字符替换为 *
+func maskRanges(text string, ranges [][]int) string {
+	masked := make([]bool, len(text))
+	for _, r := range ranges {
+		// 转小写后个别字符长度可能变化，越界部分忽略
+		for i := r[0]; i < r[1] && i < len(text); i++ {
+			masked[i] = true
+		}
+	}
+	var sb strings.Builder
+	for i, r := range text {
+		if masked[i] {
+			sb.WriteRune('*')
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// moderationSeverity 审核动作的严重程度
+func moderationSeverity(action string) int {
+	switch action {
+	case ModerationWarn:
+		return 3
+	case ModerationDrop:
+		return 2
+	case ModerationMask:
+		return 1
+	}
+	return 0
+}
+
+// reloadMu 避免同时重载审核规则
+var reloadMu sync.Mutex
+
+// reloadModeration 从配置文件重新读取审核规则
+func reloadModeration() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	var cfg config.Config
+	if _, err := toml.DecodeFile(config.FILE_NAME, &cfg); err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if !cfg.Moderation.Enable {
+		GlobalModerator.Store(nil)
+		return nil
+	}
+	if m := GlobalModerator.Load(); m != nil {
+		return m.Reload(cfg.Moderation)
+	}
+	m, err := NewModerator(cfg.Moderation)
+	if err != nil {
+		return err
+	}
+	GlobalModerator.Store(m)
+	return nil
+}
+
+// moderate 审核消息，未启用审核时原样返回，cluster 为自动处罚下发的集群
+func moderate(direction string, text string, player string, name string, cluster string) (string, bool) {
+	m := GlobalModerator.Load()
+	if m == nil {
+		return text, true
+	}
+	result := m.Check(direction, text, player, name, cluster)
+	return result.Text, !result.Dropped
+}
+
+// moderateGroupMessage 分别按转发到游戏与转发到QQ群审核群消息，只按较严重的结果记录一次违规
+func moderateGroupMessage(text string, player string, name string, clusters []string) (toDst ModerationResult, toQQ ModerationResult) {
+	m := GlobalModerator.Load()
+	if m == nil {
+		return ModerationResult{Text: text}, ModerationResult{Text: text}
+	}
+	toDst = m.evaluate(PolicyToDst, text)
+	toQQ = m.evaluate(PolicyToQQ, text)
+	worse := toDst
+	if moderationSeverity(toQQ.Action) > moderationSeverity(toDst.Action) {
+		worse = toQQ
+	}
+	m.punish(worse, text, player, name, clusters)
+	return toDst, toQQ
+}
+
+// GlobalModerator 消息审核器，未启用审核时为空，重载命令与消息处理会并发访问
+var GlobalModerator atomic.Pointer[Moderator]
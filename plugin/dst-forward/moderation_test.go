@@ -0,0 +1,132 @@
+package dstforward
+
+import (
+	"testing"
+	"time"
+
+	"llma.dev/config"
+)
+
+func newTestModerator(t *testing.T, cfg config.ModerationConfig) *Moderator {
+	t.Helper()
+	m, err := NewModerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestModeratorEvaluate(t *testing.T) {
+	m := newTestModerator(t, config.ModerationConfig{Rules: []config.ModerationRuleConfig{
+		{Words: []string{"Badword"}, Action: ModerationMask},
+		{Regex: []string{`\d{6,}`}, Action: ModerationDrop, Direction: PolicyToQQ},
+		{Words: []string{"外挂"}, Action: ModerationWarn, Direction: PolicyToDst},
+	}})
+
+	tests := []struct {
+		direction string
+		text      string
+		want      ModerationResult
+	}{
+		{PolicyToQQ, "hello", ModerationResult{Text: "hello"}},
+		{PolicyToQQ, "a BADWORD b", ModerationResult{Text: "a ******* b", Action: ModerationMask}},
+		{PolicyToQQ, "加群 1234567", ModerationResult{Text: "加群 1234567", Dropped: true, Action: ModerationDrop}},
+		{PolicyToDst, "加群 1234567", ModerationResult{Text: "加群 1234567"}},
+		{PolicyToDst, "badword 开外挂", ModerationResult{Text: "******* 开外挂", Dropped: true, Action: ModerationWarn}},
+		{PolicyToQQ, "开外挂", ModerationResult{Text: "开外挂"}},
+	}
+	for _, tt := range tests {
+		if got := m.evaluate(tt.direction, tt.text); got != tt.want {
+			t.Errorf("evaluate(%s, %q) = %+v, want %+v", tt.direction, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestModeratorReloadKeepsRulesOnError(t *testing.T) {
+	m := newTestModerator(t, config.ModerationConfig{Rules: []config.ModerationRuleConfig{
+		{Words: []string{"bad"}, Action: ModerationDrop},
+	}})
+	invalid := []config.ModerationRuleConfig{
+		{Words: []string{"x"}, Action: "ban"},
+		{Words: []string{"x"}, Action: ModerationDrop, Direction: "sideways"},
+		{Regex: []string{"("}, Action: ModerationDrop},
+	}
+	for _, rule := range invalid {
+		if err := m.Reload(config.ModerationConfig{Rules: []config.ModerationRuleConfig{rule}}); err == nil {
+			t.Errorf("Reload(%+v) 应返回错误", rule)
+		}
+	}
+	if !m.evaluate(PolicyToQQ, "bad").Dropped {
+		t.Fatal("规则有误时应保留原规则")
+	}
+}
+
+// drainCmds 取出集群队列中的命令，返回 命令 -> 内容
+func drainCmds(cluster string) map[string]any {
+	cmds := make(map[string]any)
+	for _, msg := range queueFor(cluster).drain() {
+		if msg.Type == MsgCmd {
+			cmds[msg.Data.Head] = msg.Data.Content
+		}
+	}
+	return cmds
+}
+
+func TestModeratorPunishesOnSourceClusters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	savedBans, savedRoles := GlobalBanStore, GlobalRoleStore
+	GlobalBanStore, GlobalRoleStore = NewBanStore(), NewRoleStore(config.RoleConfig{}, nil)
+	defer func() { GlobalBanStore, GlobalRoleStore = savedBans, savedRoles }()
+	for _, cluster := range []string{defaultCluster, "cave", "forest"} {
+		drainCmds(cluster)
+	}
+
+	m := newTestModerator(t, config.ModerationConfig{
+		KickStrikes: 2,
+		BanStrikes:  3,
+		BanDuration: "1h",
+		Rules:       []config.ModerationRuleConfig{{Words: []string{"bad"}, Action: ModerationDrop}},
+	})
+
+	m.Check(PolicyToQQ, "bad", "KU_1", "wilson", "cave")
+	if cmds := drainCmds("cave"); len(cmds) != 0 {
+		t.Fatalf("第一次违规不应处罚: %v", cmds)
+	}
+	m.Check(PolicyToQQ, "bad", "KU_1", "wilson", "cave")
+	if cmds := drainCmds("cave"); cmds["kick"] != "KU_1" {
+		t.Fatalf("第二次违规应在来源集群踢出: %v", cmds)
+	}
+	m.Check(PolicyToQQ, "bad", "KU_1", "wilson", "cave", "forest")
+	for _, cluster := range []string{"cave", "forest"} {
+		if cmds := drainCmds(cluster); cmds["ban"] != "KU_1" {
+			t.Fatalf("第三次违规应在 %s 封禁: %v", cluster, cmds)
+		}
+	}
+	if cmds := drainCmds(defaultCluster); len(cmds) != 0 {
+		t.Fatalf("不应向其他集群下发处罚: %v", cmds)
+	}
+
+	// 限时封禁到期后向封禁所在的集群解封
+	GlobalBanStore.expire(time.Now().Add(2 * time.Hour))
+	for _, cluster := range []string{"cave", "forest"} {
+		if cmds := drainCmds(cluster); cmds["unban"] != "KU_1" {
+			t.Fatalf("封禁到期后应在 %s 解封: %v", cluster, cmds)
+		}
+	}
+	if cmds := drainCmds(defaultCluster); len(cmds) != 0 {
+		t.Fatalf("不应向其他集群下发解封: %v", cmds)
+	}
+}
+
+func TestModeratorIgnoresNonPlayers(t *testing.T) {
+	drainCmds(defaultCluster)
+	m := newTestModerator(t, config.ModerationConfig{
+		KickStrikes: 1,
+		Rules:       []config.ModerationRuleConfig{{Words: []string{"bad"}, Action: ModerationMask}},
+	})
+	// QQ号只计数，不能对游戏内玩家执行处罚
+	m.Check(PolicyToDst, "bad", "10001", "群友")
+	if cmds := drainCmds(defaultCluster); len(cmds) != 0 {
+		t.Fatalf("非科雷id不应下发处罚: %v", cmds)
+	}
+}
@@ -0,0 +1,123 @@
+package dstforward
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/bot"
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
+// 转发方向
+const (
+	PolicyBoth  = "both"   // 双向转发
+	PolicyToDst = "to_dst" // 只转发QQ群消息到游戏
+	PolicyToQQ  = "to_qq"  // 只转发游戏消息到QQ群
+	PolicyNone  = "none"   // 不转发
+)
+
+// GroupPolicy 群聊转发策略
+type GroupPolicy struct {
+	config.GroupPolicyConfig
+}
+
+// defaultPolicy 未配置策略的群聊使用的默认策略
+var defaultPolicy = &GroupPolicy{config.GroupPolicyConfig{Direction: PolicyBoth}}
+
+// toDst 判断群消息是否转发出本群(到游戏或其它群)，返回去掉触发前缀后的正文
+func (p *GroupPolicy) toDst(groupMsg *message.GroupMessage) (string, bool) {
+	if p.Direction != PolicyBoth && p.Direction != PolicyToDst {
+		return "", false
+	}
+	if slices.Contains(p.IgnoredUsers, groupMsg.Sender.Uin) {
+		return "", false
+	}
+
+	text := groupMsg.ToString()
+	if p.TriggerPrefix != "" {
+		content, ok := strings.CutPrefix(text, p.TriggerPrefix)
+		if !ok {
+			return "", false
+		}
+		text = strings.TrimSpace(content)
+		if text == "" {
+			return "", false
+		}
+	}
+
+	if p.MinLevel > 0 {
+		member := bot.QQClient.Client().GetCachedMemberInfo(groupMsg.Sender.Uin, groupMsg.GroupUin)
+		if member == nil || member.GroupLevel < p.MinLevel {
+			llog.Debugf("[dst forward策略] 群 %d 成员 %d 等级不足，不转发", groupMsg.GroupUin, groupMsg.Sender.Uin)
+			return "", false
+		}
+	}
+	return text, true
+}
+
+// toQQ 判断游戏消息是否转发到群聊
+func (p *GroupPolicy) toQQ() bool {
+	return p.Direction == PolicyBoth || p.Direction == PolicyToQQ
+}
+
+// acceptsEvent 判断游戏事件是否转发到群聊
+func (p *GroupPolicy) acceptsEvent(eventType string) bool {
+	if !p.toQQ() {
+		return false
+	}
+	return len(p.Events) == 0 || slices.Contains(p.Events, eventType)
+}
+
+// policyFor 获取群聊的转发策略
+func policyFor(groupID uint32) *GroupPolicy {
+	if p, ok := groupPolicies[groupID]; ok {
+		return p
+	}
+	return defaultPolicy
+}
+
+// qqTargetGroups 允许游戏消息转发到群聊的绑定群
+func qqTargetGroups() []uint32 {
+	groups := make([]uint32, 0, len(config.GlobalConfig.Other.BindGroups))
+	for _, gid := range config.GlobalConfig.Other.BindGroups {
+		if policyFor(gid).toQQ() {
+			groups = append(groups, gid)
+		}
+	}
+	return groups
+}
+
+// sendToQQGroups 向允许游戏消息转发到群聊的绑定群发送文本消息，用于刷屏提示等源自游戏的通知
+func sendToQQGroups(text string) {
+	elements := simpleTextElements(text)
+	for _, gid := range qqTargetGroups() {
+		bot.QQClient.Client().SendGroupMessage(gid, elements)
+	}
+}
+
+// loadGroupPolicies 读取配置文件中的群聊转发策略
+func loadGroupPolicies(configs []config.GroupPolicyConfig) map[uint32]*GroupPolicy {
+	policies := make(map[uint32]*GroupPolicy, len(configs))
+	for _, c := range configs {
+		if c.Direction == "" {
+			c.Direction = PolicyBoth
+		}
+		switch c.Direction {
+		case PolicyBoth, PolicyToDst, PolicyToQQ, PolicyNone:
+		default:
+			llog.Errorf("[dst forward策略] 群 %d 的转发方向 %s 无效，已跳过", c.Group, c.Direction)
+			continue
+		}
+		if invalid := slices.DeleteFunc(slices.Clone(c.Events), func(e string) bool {
+			return e == EventJoin || e == EventLeave || e == EventDeath || e == EventAnnounce
+		}); len(invalid) > 0 {
+			llog.Errorf("[dst forward策略] 群 %d 的事件类型 %v 无效，已忽略", c.Group, invalid)
+		}
+		policies[c.Group] = &GroupPolicy{c}
+	}
+	return policies
+}
+
+var groupPolicies = make(map[uint32]*GroupPolicy)
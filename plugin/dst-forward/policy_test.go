@@ -0,0 +1,83 @@
+package dstforward
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/config"
+)
+
+func TestQQTargetGroups(t *testing.T) {
+	savedConfig, savedPolicies := config.GlobalConfig, groupPolicies
+	defer func() { config.GlobalConfig, groupPolicies = savedConfig, savedPolicies }()
+
+	config.GlobalConfig = &config.Config{Other: config.OtherConfig{BindGroups: []uint32{1, 2, 3, 4}}}
+	groupPolicies = loadGroupPolicies([]config.GroupPolicyConfig{
+		{Group: 2, Direction: PolicyToDst},
+		{Group: 3, Direction: PolicyNone},
+		{Group: 4, Direction: PolicyToQQ},
+	})
+
+	// 未配置策略的群默认双向转发，只转发到游戏与不转发的群不接收游戏侧的通知
+	if got, want := qqTargetGroups(), []uint32{1, 4}; !slices.Equal(got, want) {
+		t.Errorf("qqTargetGroups() = %v, want %v", got, want)
+	}
+}
+
+func TestGroupPolicyToDst(t *testing.T) {
+	groupMsg := func(uin uint32, text string) *message.GroupMessage {
+		return &message.GroupMessage{
+			GroupUin: 1,
+			Sender:   &message.Sender{Uin: uin},
+			Elements: []message.IMessageElement{&message.TextElement{Content: text}},
+		}
+	}
+	policies := loadGroupPolicies([]config.GroupPolicyConfig{
+		{Group: 1},
+		{Group: 2, Direction: PolicyToQQ},
+		{Group: 3, TriggerPrefix: "#", IgnoredUsers: []uint32{99}},
+		{Group: 4, Direction: "sideways"},
+	})
+	if _, ok := policies[4]; ok {
+		t.Error("转发方向无效的策略应被跳过")
+	}
+
+	tests := []struct {
+		name   string
+		group  uint32
+		sender uint32
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{"默认双向转发", 1, 10, "大家好", "大家好", true},
+		{"只转发到QQ", 2, 10, "大家好", "", false},
+		{"去掉触发前缀", 3, 10, "# 大家好", "大家好", true},
+		{"没有触发前缀", 3, 10, "大家好", "", false},
+		{"只有触发前缀", 3, 10, "# ", "", false},
+		{"忽略的用户", 3, 99, "#大家好", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := policies[tt.group].toDst(groupMsg(tt.sender, tt.text))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: toDst = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGroupPolicyAcceptsEvent(t *testing.T) {
+	policies := loadGroupPolicies([]config.GroupPolicyConfig{
+		{Group: 1, Events: []string{EventJoin, EventLeave}},
+		{Group: 2, Direction: PolicyToDst},
+	})
+	if !policies[1].acceptsEvent(EventJoin) || policies[1].acceptsEvent(EventDeath) {
+		t.Error("配置了事件列表的群只接收列表中的事件")
+	}
+	if policies[2].acceptsEvent(EventAnnounce) {
+		t.Error("只转发到游戏的群不接收游戏事件")
+	}
+	if !defaultPolicy.acceptsEvent(EventDeath) {
+		t.Error("未配置策略的群接收全部事件")
+	}
+}
@@ -0,0 +1,273 @@
+package dstforward
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"llma.dev/utils/llog"
+)
+
+// ProtocolVersion 当前协议版本
+const ProtocolVersion = 1
+
+// SupportedVersions 兼容的协议版本
+var SupportedVersions = []int{1}
+
+// 协议版本请求头，未携带时视为当前版本
+const protocolHeader = "X-Protocol-Version"
+
+// 协议错误码
+const (
+	ErrCodeInvalidJSON        = "invalid_json"
+	ErrCodeUnknownField       = "unknown_field"
+	ErrCodeMissingField       = "missing_field"
+	ErrCodeInvalidField       = "invalid_field"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+)
+
+//go:embed schema
+var schemaFS embed.FS
+
+// ProtocolError 协议错误，会以json返回给mod
+type ProtocolError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"error"`
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
+
+// missingField 缺少必填字段
+func missingField(field string) *ProtocolError {
+	return &ProtocolError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    ErrCodeMissingField,
+		Field:   field,
+		Message: fmt.Sprintf("缺少必填字段 %s", field),
+	}
+}
+
+// invalidField 字段值无效
+func invalidField(field string, format string, args ...any) *ProtocolError {
+	return &ProtocolError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    ErrCodeInvalidField,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// validator 可校验的请求体
+type validator interface {
+	Validate() error
+}
+
+// Handshake mod 启动时发送的握手请求
+type Handshake struct {
+	// Version mod 使用的协议版本
+	Version int `json:"version"`
+	// ModVersion mod 版本，仅用于日志
+	ModVersion string `json:"modVersion"`
+	// Cluster 集群名称，可选
+	Cluster string `json:"cluster"`
+}
+
+func (h *Handshake) Validate() error {
+	if h.Version == 0 {
+		return missingField("version")
+	}
+	if !slices.Contains(SupportedVersions, h.Version) {
+		return unsupportedVersion(h.Version)
+	}
+	return nil
+}
+
+// HandshakeResponse 握手响应
+type HandshakeResponse struct {
+	Version           int    `json:"version"`
+	SupportedVersions []int  `json:"supportedVersions"`
+	Schema            string `json:"schema"`
+}
+
+func (m *DstMsg) Validate() error {
+	if m.UserName == "" {
+		return missingField("userName")
+	}
+	if m.Message == "" {
+		return missingField("message")
+	}
+	if m.KleiID != "" && !strings.HasPrefix(m.KleiID, "KU_") {
+		return invalidField("kleiId", "kleiId 必须以 KU_ 开头")
+	}
+	if m.Origin != nil {
+		if m.Origin.Kind != EndpointGroup && m.Origin.Kind != EndpointServer {
+			return invalidField("origin.kind", "origin.kind 必须是 group 或 server")
+		}
+		if m.Origin.ID == "" {
+			return missingField("origin.id")
+		}
+	}
+	return nil
+}
+
+func (e *DstEvent) Validate() error {
+	switch e.Type {
+	case "":
+		return missingField("type")
+	case EventJoin, EventLeave, EventDeath:
+		if e.UserName == "" {
+			return missingField("userName")
+		}
+	case EventAnnounce:
+		if e.Message == "" {
+			return missingField("message")
+		}
+	default:
+		return invalidField("type", "未知的事件类型 %s", e.Type)
+	}
+	if e.KleiID != "" && !strings.HasPrefix(e.KleiID, "KU_") {
+		return invalidField("kleiId", "kleiId 必须以 KU_ 开头")
+	}
+	return nil
+}
+
+func (r *CmdResult) Validate() error {
+	if r.ID == "" {
+		return missingField("id")
+	}
+	return nil
+}
+
+// bindStrict 严格解析请求体: 拒绝未知字段与多余内容，并执行字段校验，失败时写入错误响应
+func bindStrict(c *gin.Context, v validator) bool {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		if _, extra := decoder.Token(); !errors.Is(extra, io.EOF) {
+			abortProtocolError(c, &ProtocolError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrCodeInvalidJSON,
+				Message: "请求体只能包含一个json对象",
+			})
+			return false
+		}
+	}
+	if err != nil {
+		pe := &ProtocolError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrCodeInvalidJSON,
+			Message: fmt.Sprintf("请求体不是有效的json: %s", err.Error()),
+		}
+		// encoding/json 对未知字段的错误格式为 json: unknown field "xxx"
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			pe.Code = ErrCodeUnknownField
+			pe.Field = strings.Trim(field, `"`)
+			pe.Message = fmt.Sprintf("未知字段 %s", pe.Field)
+		}
+		abortProtocolError(c, pe)
+		return false
+	}
+	if err := v.Validate(); err != nil {
+		var pe *ProtocolError
+		if !errors.As(err, &pe) {
+			pe = &ProtocolError{Status: http.StatusUnprocessableEntity, Code: ErrCodeInvalidField, Message: err.Error()}
+		}
+		abortProtocolError(c, pe)
+		return false
+	}
+	return true
+}
+
+// ProtocolVersionMiddleware 校验请求头中的协议版本
+func ProtocolVersionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(protocolHeader)
+		if header == "" {
+			c.Next()
+			return
+		}
+		version, err := strconv.Atoi(header)
+		if err != nil {
+			abortProtocolError(c, &ProtocolError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrCodeInvalidField,
+				Field:   protocolHeader,
+				Message: fmt.Sprintf("%s 必须是整数", protocolHeader),
+			})
+			return
+		}
+		if !slices.Contains(SupportedVersions, version) {
+			abortProtocolError(c, unsupportedVersion(version))
+			return
+		}
+		c.Header(protocolHeader, strconv.Itoa(ProtocolVersion))
+		c.Next()
+	}
+}
+
+// registerProtocolRoutes 注册握手与协议 schema 接口
+func registerProtocolRoutes(router *gin.Engine) {
+	router.POST("/handshake", func(c *gin.Context) {
+		var handshake Handshake
+		if !bindStrict(c, &handshake) {
+			return
+		}
+		llog.Infof("[dst forward] mod 握手成功 协议版本: %d mod版本: %s 集群: %s",
+			handshake.Version, handshake.ModVersion, handshake.Cluster)
+		publishEvent(DstConnected{Handshake: handshake})
+		c.JSON(http.StatusOK, HandshakeResponse{
+			Version:           ProtocolVersion,
+			SupportedVersions: SupportedVersions,
+			Schema:            "/schema",
+		})
+	})
+
+	router.GET("/schema", func(c *gin.Context) {
+		entries, err := schemaFS.ReadDir("schema")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		index := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".json")
+			index[name] = "/schema/" + name
+		}
+		c.JSON(http.StatusOK, gin.H{"version": ProtocolVersion, "schemas": index})
+	})
+
+	router.GET("/schema/:name", func(c *gin.Context) {
+		content, err := schemaFS.ReadFile(path.Join("schema", path.Base(c.Param("name"))+".json"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "schema 不存在"})
+			return
+		}
+		c.Data(http.StatusOK, "application/schema+json", content)
+	})
+}
+
+func unsupportedVersion(version int) *ProtocolError {
+	return &ProtocolError{
+		Status:  http.StatusUpgradeRequired,
+		Code:    ErrCodeUnsupportedVersion,
+		Field:   "version",
+		Message: fmt.Sprintf("不支持的协议版本 %d，支持的版本: %v", version, SupportedVersions),
+	}
+}
+
+func abortProtocolError(c *gin.Context, pe *ProtocolError) {
+	c.AbortWithStatusJSON(pe.Status, pe)
+}
@@ -0,0 +1,108 @@
+package dstforward
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newProtocolRouter 挂载协议中间件、握手接口与一个严格解析 DstMsg 的测试接口
+func newProtocolRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ProtocolVersionMiddleware())
+	registerProtocolRoutes(router)
+	router.POST("/msg", func(c *gin.Context) {
+		var msg DstMsg
+		if bindStrict(c, &msg) {
+			c.Status(http.StatusOK)
+		}
+	})
+	return router
+}
+
+func TestProtocolValidation(t *testing.T) {
+	router := newProtocolRouter()
+	tests := []struct {
+		name       string
+		path       string
+		version    string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{"有效消息", "/msg", "", `{"userName":"wilson","kleiId":"KU_1","message":"hi"}`, 200, "", ""},
+		{"声明当前版本", "/msg", "1", `{"userName":"wilson","message":"hi"}`, 200, "", ""},
+		{"不支持的版本", "/msg", "2", `{"userName":"wilson","message":"hi"}`, 426, ErrCodeUnsupportedVersion, "version"},
+		{"版本不是整数", "/msg", "v1", `{}`, 400, ErrCodeInvalidField, protocolHeader},
+		{"无效json", "/msg", "", `{"userName":`, 400, ErrCodeInvalidJSON, ""},
+		{"多个对象", "/msg", "", `{"userName":"a","message":"b"}{}`, 400, ErrCodeInvalidJSON, ""},
+		{"未知字段", "/msg", "", `{"userName":"a","message":"b","color":"red"}`, 400, ErrCodeUnknownField, "color"},
+		{"缺少消息", "/msg", "", `{"userName":"wilson"}`, 422, ErrCodeMissingField, "message"},
+		{"科雷id格式", "/msg", "", `{"userName":"a","message":"b","kleiId":"123"}`, 422, ErrCodeInvalidField, "kleiId"},
+		{"来源类型", "/msg", "", `{"userName":"a","message":"b","origin":{"kind":"web","id":"1"}}`, 422, ErrCodeInvalidField, "origin.kind"},
+		{"握手", "/handshake", "", `{"version":1,"modVersion":"1.0.0"}`, 200, "", ""},
+		{"握手缺少版本", "/handshake", "", `{"modVersion":"1.0.0"}`, 422, ErrCodeMissingField, "version"},
+		{"握手版本过高", "/handshake", "", `{"version":99}`, 426, ErrCodeUnsupportedVersion, "version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.version != "" {
+				req.Header.Set(protocolHeader, tt.version)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var pe ProtocolError
+			if err := json.Unmarshal(w.Body.Bytes(), &pe); err != nil {
+				t.Fatal(err)
+			}
+			if pe.Code != tt.wantCode || pe.Field != tt.wantField {
+				t.Errorf("error = %+v, want code %s field %s", pe, tt.wantCode, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestProtocolSchemas(t *testing.T) {
+	router := newProtocolRouter()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/schema", nil))
+	var index struct {
+		Version int               `json:"version"`
+		Schemas map[string]string `json:"schemas"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Version != ProtocolVersion || index.Schemas["dst_msg"] != "/schema/dst_msg" {
+		t.Fatalf("schema 索引 = %+v", index)
+	}
+
+	// 发布的每个 schema 都应是有效的json
+	for name, path := range index.Schemas {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+			t.Errorf("schema %s: status %d, 内容不是有效的json", name, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/schema/..%2Fprotocol", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("不存在的 schema 返回 %d, want 404", w.Code)
+	}
+}
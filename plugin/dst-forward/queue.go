@@ -0,0 +1,172 @@
+package dstforward
+
+import (
+	"fmt"
+	"sync"
+
+	"llma.dev/bot"
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
+// 聊天队列溢出策略
+const (
+	OverflowDropOldest = "drop-oldest" // 丢弃最早的消息
+	OverflowDropNewest = "drop-newest" // 丢弃新消息
+	OverflowMerge      = "merge"       // 将新消息合并到最后一条消息中，来源或接收者不同时丢弃最早的消息
+)
+
+// MsgQueue 等待mod拉取的消息队列
+// 命令与发给指定玩家的回复单独排队，不受队列长度限制，永远不会被丢弃
+type MsgQueue struct {
+	mu sync.Mutex
+	// Commands 命令与发给指定玩家的回复
+	Commands []Message
+	// Messages 聊天消息队列
+	Messages []Message
+	// MaxSize 聊天消息队列最大长度
+	MaxSize int
+	// Overflow 聊天消息队列溢出策略
+	Overflow string
+	// NotifySender 消息被丢弃时是否通知发送者
+	NotifySender bool
+
+	dropped uint64
+	merged  uint64
+}
+
+// QueueStats 队列统计
+type QueueStats struct {
+	// Commands 待拉取的命令与指定玩家回复数
+	Commands int `json:"commands"`
+	// Messages 待拉取的聊天消息数
+	Messages int `json:"messages"`
+	// Dropped 累计丢弃的聊天消息数
+	Dropped uint64 `json:"dropped"`
+	// Merged 累计被合并的聊天消息数
+	Merged uint64 `json:"merged"`
+}
+
+func DefaultQueue() *MsgQueue {
+	return &MsgQueue{MaxSize: 5, Overflow: OverflowDropOldest}
+}
+
+// configure 应用配置文件中的队列设置，配置无效时保留默认值
+func (m *MsgQueue) configure(cfg config.QueueConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cfg.MaxSize > 0 {
+		m.MaxSize = cfg.MaxSize
+	}
+	switch cfg.Overflow {
+	case "":
+	case OverflowDropOldest, OverflowDropNewest, OverflowMerge:
+		m.Overflow = cfg.Overflow
+	default:
+		llog.Errorf("[dst forward队列] 溢出策略 %s 无效，使用 %s", cfg.Overflow, m.Overflow)
+	}
+	m.NotifySender = cfg.NotifySender
+}
+
+// 入队
+func (m *MsgQueue) enqueue(msg Message) {
+	llog.Debugf("[dst forward队列] 插入队列消息: %v", msg)
+	msg.Version = ProtocolVersion
+
+	m.mu.Lock()
+	if msg.Type == MsgCmd || msg.Data.Target != "" {
+		m.Commands = append(m.Commands, msg)
+		m.mu.Unlock()
+		return
+	}
+	if len(m.Messages) < m.MaxSize {
+		m.Messages = append(m.Messages, msg)
+		m.mu.Unlock()
+		return
+	}
+
+	var dropped Message
+	overflow := m.Overflow
+	if overflow == OverflowMerge && !mergeable(m.Messages[len(m.Messages)-1], msg) {
+		overflow = OverflowDropOldest
+	}
+	switch overflow {
+	case OverflowDropNewest:
+		dropped = msg
+	case OverflowMerge:
+		last := &m.Messages[len(m.Messages)-1]
+		if last.Data.Sender.Name == msg.Data.Sender.Name {
+			last.Data.Content = fmt.Sprintf("%v\n%v", last.Data.Content, msg.Data.Content)
+		} else {
+			last.Data.Content = fmt.Sprintf("%v\n%s: %v", last.Data.Content, msg.Data.Sender.Name, msg.Data.Content)
+		}
+		m.merged++
+		m.mu.Unlock()
+		llog.Debugf("[dst forward队列] 聊天队列已满，消息已合并到上一条")
+		return
+	default:
+		dropped = m.Messages[0]
+		m.Messages = append(m.Messages[1:], msg)
+	}
+	m.dropped++
+	total := m.dropped
+	notify := m.NotifySender
+	m.mu.Unlock()
+
+	llog.Warningf("[dst forward队列] 聊天队列已满(%d)，丢弃 %s 的消息: %v，累计丢弃 %d 条",
+		m.MaxSize, dropped.Data.Sender.Name, dropped.Data.Content, total)
+	if notify && dropped.Data.Source.ID != 0 && dropped.Data.Sender.ID != 0 {
+		go bot.QQClient.Client().SendGroupMessage(dropped.Data.Source.ID, simpleTextElements(
+			fmt.Sprintf("%s 的消息因游戏内消息过多未能送达: %v", dropped.Data.Sender.Name, dropped.Data.Content)))
+	}
+}
+
+// mergeable 两条聊天消息能否合并，接收者、来源与转发来源都相同时才能合并
+// 否则私聊回复会混入广播消息，合并后的消息也会丢失防止循环转发所需的来源
+func mergeable(a Message, b Message) bool {
+	if a.Data.Target != b.Data.Target || a.Data.Source != b.Data.Source {
+		return false
+	}
+	if a.Data.Origin == nil || b.Data.Origin == nil {
+		return a.Data.Origin == b.Data.Origin
+	}
+	return *a.Data.Origin == *b.Data.Origin
+}
+
+// 全取出，命令排在聊天消息之前
+func (m *MsgQueue) drain() []Message {
+	m.mu.Lock()
+	msgs := append(m.Commands, m.Messages...)
+	m.Commands = nil
+	m.Messages = nil
+	m.mu.Unlock()
+
+	llog.Debugf("[dst forward队列] 取出当前队列: %v", msgs)
+	if len(msgs) == 0 {
+		return []Message{}
+	}
+	return msgs
+}
+
+// Stats 队列统计
+func (m *MsgQueue) Stats() QueueStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return QueueStats{
+		Commands: len(m.Commands),
+		Messages: len(m.Messages),
+		Dropped:  m.dropped,
+		Merged:   m.merged,
+	}
+}
+
+// queueStats 全部集群的队列统计
+func queueStats() map[string]QueueStats {
+	stats := map[string]QueueStats{defaultCluster: GlobalMsgQueue.Stats()}
+	clusterQueuesMu.Lock()
+	defer clusterQueuesMu.Unlock()
+	for cluster, q := range clusterQueues {
+		stats[cluster] = q.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,189 @@
+package dstforward
+
+import (
+	"reflect"
+	"testing"
+
+	"llma.dev/config"
+)
+
+// chat 测试用的聊天消息
+func chat(sender string, content string) Message {
+	return Message{Type: MsgText, Data: Data{Sender: Sender{Name: sender}, Content: content}}
+}
+
+// withOrigin 设置消息的转发来源
+func withOrigin(msg Message, origin *Origin) Message {
+	msg.Data.Origin = origin
+	return msg
+}
+
+// contents 队列中聊天消息的内容
+func contents(msgs []Message) []any {
+	result := make([]any, 0, len(msgs))
+	for _, msg := range msgs {
+		result = append(result, msg.Data.Content)
+	}
+	return result
+}
+
+func TestMsgQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		overflow    string
+		msgs        []Message
+		want        []any
+		wantDropped uint64
+		wantMerged  uint64
+	}{
+		{
+			name:     "未满",
+			overflow: OverflowDropOldest,
+			msgs:     []Message{chat("a", "1"), chat("a", "2")},
+			want:     []any{"1", "2"},
+		},
+		{
+			name:        "丢弃最早的消息",
+			overflow:    OverflowDropOldest,
+			msgs:        []Message{chat("a", "1"), chat("a", "2"), chat("a", "3"), chat("a", "4")},
+			want:        []any{"2", "3", "4"},
+			wantDropped: 1,
+		},
+		{
+			name:        "丢弃新消息",
+			overflow:    OverflowDropNewest,
+			msgs:        []Message{chat("a", "1"), chat("a", "2"), chat("a", "3"), chat("a", "4"), chat("a", "5")},
+			want:        []any{"1", "2", "3"},
+			wantDropped: 2,
+		},
+		{
+			name:       "合并同一发送者",
+			overflow:   OverflowMerge,
+			msgs:       []Message{chat("a", "1"), chat("a", "2"), chat("a", "3"), chat("a", "4")},
+			want:       []any{"1", "2", "3\n4"},
+			wantMerged: 1,
+		},
+		{
+			name:       "合并不同发送者时带上名称",
+			overflow:   OverflowMerge,
+			msgs:       []Message{chat("a", "1"), chat("a", "2"), chat("a", "3"), chat("b", "4"), chat("c", "5")},
+			want:       []any{"1", "2", "3\nb: 4\nc: 5"},
+			wantMerged: 2,
+		},
+		{
+			name:     "来源不同时不合并",
+			overflow: OverflowMerge,
+			msgs: []Message{chat("a", "1"), chat("a", "2"), chat("a", "3"),
+				withOrigin(chat("a", "4"), &Origin{Kind: EndpointServer, ID: "cave"})},
+			want:        []any{"2", "3", "4"},
+			wantDropped: 1,
+		},
+		{
+			name:     "转发来源相同时合并",
+			overflow: OverflowMerge,
+			msgs: []Message{chat("a", "1"), chat("a", "2"),
+				withOrigin(chat("a", "3"), &Origin{Kind: EndpointServer, ID: "cave"}),
+				withOrigin(chat("a", "4"), &Origin{Kind: EndpointServer, ID: "cave"})},
+			want:       []any{"1", "2", "3\n4"},
+			wantMerged: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &MsgQueue{MaxSize: 3, Overflow: tt.overflow}
+			for _, msg := range tt.msgs {
+				q.enqueue(msg)
+			}
+			stats := q.Stats()
+			if got := contents(q.drain()); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("队列内容 = %v, want %v", got, tt.want)
+			}
+			if stats.Dropped != tt.wantDropped || stats.Merged != tt.wantMerged {
+				t.Fatalf("dropped = %d, merged = %d, want %d, %d",
+					stats.Dropped, stats.Merged, tt.wantDropped, tt.wantMerged)
+			}
+		})
+	}
+}
+
+func TestMsgQueueCommandsAreNeverDropped(t *testing.T) {
+	q := &MsgQueue{MaxSize: 1, Overflow: OverflowDropNewest}
+	q.enqueue(chat("a", "1"))
+	for i := 0; i < 5; i++ {
+		q.enqueueCmdMsg(ActionSave, nil, Source{}, Sender{})
+	}
+	q.enqueue(chat("a", "2"))
+
+	stats := q.Stats()
+	if stats.Commands != 5 || stats.Messages != 1 || stats.Dropped != 1 {
+		t.Fatalf("stats = %+v, want 5 条命令 1 条消息 丢弃 1 条", stats)
+	}
+
+	msgs := q.drain()
+	if len(msgs) != 6 {
+		t.Fatalf("drain 返回 %d 条, want 6", len(msgs))
+	}
+	// 命令排在聊天消息之前
+	for i, msg := range msgs[:5] {
+		if msg.Type != MsgCmd {
+			t.Fatalf("第 %d 条类型 = %v, want 命令", i, msg.Type)
+		}
+	}
+	if msgs[5].Data.Content != "1" {
+		t.Fatalf("聊天消息 = %v, want 1", msgs[5].Data.Content)
+	}
+	for _, msg := range msgs {
+		if msg.Version != ProtocolVersion {
+			t.Fatalf("消息版本 = %d, want %d", msg.Version, ProtocolVersion)
+		}
+	}
+	if stats := q.Stats(); stats.Commands != 0 || stats.Messages != 0 {
+		t.Fatalf("drain 后队列应为空: %+v", stats)
+	}
+}
+
+func TestMsgQueueDrainEmpty(t *testing.T) {
+	msgs := DefaultQueue().drain()
+	if msgs == nil || len(msgs) != 0 {
+		t.Fatalf("空队列 drain = %#v, want 非 nil 的空切片", msgs)
+	}
+}
+
+func TestMsgQueueConfigure(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.QueueConfig
+		wantMaxSize  int
+		wantOverflow string
+	}{
+		{"空配置保留默认值", config.QueueConfig{}, 5, OverflowDropOldest},
+		{"有效配置", config.QueueConfig{MaxSize: 20, Overflow: OverflowMerge}, 20, OverflowMerge},
+		{"无效策略保留默认值", config.QueueConfig{MaxSize: -1, Overflow: "drop-all"}, 5, OverflowDropOldest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := DefaultQueue()
+			q.configure(tt.cfg)
+			if q.MaxSize != tt.wantMaxSize || q.Overflow != tt.wantOverflow {
+				t.Fatalf("MaxSize = %d, Overflow = %s, want %d, %s", q.MaxSize, q.Overflow, tt.wantMaxSize, tt.wantOverflow)
+			}
+		})
+	}
+}
+
+func TestMsgQueueTargetedRepliesAreNeverDropped(t *testing.T) {
+	q := &MsgQueue{MaxSize: 1, Overflow: OverflowMerge}
+	q.enqueue(chat("bot", "大家好"))
+	reply := chat("bot", "只有你能看到")
+	reply.Data.Target = "KU_1"
+	q.enqueue(reply)
+	q.enqueue(chat("bot", "广播"))
+
+	msgs := q.drain()
+	if got := contents(msgs); !reflect.DeepEqual(got, []any{"只有你能看到", "大家好\n广播"}) {
+		t.Fatalf("队列内容 = %v", got)
+	}
+	if msgs[0].Data.Target != "KU_1" || msgs[1].Data.Target != "" {
+		t.Fatalf("私聊回复不能与广播消息合并: %+v", msgs)
+	}
+}
@@ -0,0 +1,48 @@
+package dstforward
+
+import (
+	"time"
+
+	"llma.dev/config"
+	"llma.dev/logic"
+	"llma.dev/utils/llog"
+)
+
+// applyCommandCooldowns 按配置设置命令冷却，子命令的名称为 "命令 子命令"
+func applyCommandCooldowns(commands []*logic.Command, limits map[string]config.CommandRateLimitConfig) {
+	var apply func(c *logic.Command, path string)
+	apply = func(c *logic.Command, path string) {
+		if cfg, ok := limits[path]; ok {
+			cooldown, err := cooldownOf(cfg)
+			if err != nil {
+				llog.Errorf("[dst forward限流] 命令 %s 的冷却配置错误，已忽略: %v", path, err)
+			} else {
+				c.Cooldown = cooldown
+			}
+		}
+		for _, sub := range c.Subcommands {
+			apply(sub, path+" "+sub.Name)
+		}
+	}
+	for _, c := range commands {
+		apply(c, c.Name)
+	}
+}
+
+// cooldownOf 将配置转换为命令冷却，间隔为0时不限制
+func cooldownOf(cfg config.CommandRateLimitConfig) (*logic.Cooldown, error) {
+	scope, err := logic.ParseRateLimitScope(cfg.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.IntervalSeconds <= 0 {
+		return nil, nil
+	}
+	return &logic.Cooldown{
+		Scope: scope,
+		RateLimit: logic.RateLimit{
+			Burst:    max(cfg.Burst, 1),
+			Interval: time.Duration(cfg.IntervalSeconds) * time.Second,
+		},
+	}, nil
+}
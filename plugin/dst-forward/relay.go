@@ -0,0 +1,240 @@
+package dstforward
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/bot"
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
+// 转发端点类型
+const (
+	EndpointGroup  = "group"  // QQ群
+	EndpointServer = "server" // 饥荒集群
+)
+
+// Endpoint 转发端点，如 group:114514 或 server:default
+type Endpoint struct {
+	Kind string
+	ID   string
+}
+
+// ParseEndpoint 解析 类型:id 格式的端点
+func ParseEndpoint(s string) (Endpoint, error) {
+	kind, id, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || id == "" {
+		return Endpoint{}, fmt.Errorf("端点 %s 格式错误，应为 group:群号 或 server:集群名", s)
+	}
+	switch kind {
+	case EndpointGroup:
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			return Endpoint{}, fmt.Errorf("端点 %s 的群号无效", s)
+		}
+	case EndpointServer:
+	default:
+		return Endpoint{}, fmt.Errorf("端点 %s 类型无效，应为 group 或 server", s)
+	}
+	return Endpoint{Kind: kind, ID: id}, nil
+}
+
+func groupEndpoint(gid uint32) Endpoint {
+	return Endpoint{Kind: EndpointGroup, ID: strconv.FormatUint(uint64(gid), 10)}
+}
+
+func serverEndpoint(cluster string) Endpoint {
+	if cluster == "" {
+		cluster = defaultCluster
+	}
+	return Endpoint{Kind: EndpointServer, ID: cluster}
+}
+
+func (e Endpoint) String() string {
+	return e.Kind + ":" + e.ID
+}
+
+// groupID 群端点的群号
+func (e Endpoint) groupID() uint32 {
+	id, _ := strconv.ParseUint(e.ID, 10, 32)
+	return uint32(id)
+}
+
+// Origin 转发消息的来源信息，用于防止消息被转发回来源
+type Origin struct {
+	// Kind 来源类型: group, server
+	Kind string `json:"kind"`
+	// ID 群号或集群名称
+	ID string `json:"id"`
+	// Name 群名称或集群名称
+	Name string `json:"name,omitempty"`
+}
+
+func (o Origin) endpoint() Endpoint {
+	return Endpoint{Kind: o.Kind, ID: o.ID}
+}
+
+// RelayTable 转发拓扑
+type RelayTable struct {
+	edges map[Endpoint][]Endpoint
+}
+
+// NewRelayTable 根据配置创建转发拓扑，配置错误的项会被跳过
+func NewRelayTable(relays []config.RelayConfig) *RelayTable {
+	t := &RelayTable{edges: make(map[Endpoint][]Endpoint)}
+	for _, r := range relays {
+		from, err := ParseEndpoint(r.From)
+		if err != nil {
+			llog.Errorf("[dst forward转发] 转发配置错误，已跳过: %v", err)
+			continue
+		}
+		to, err := ParseEndpoint(r.To)
+		if err != nil {
+			llog.Errorf("[dst forward转发] 转发配置错误，已跳过: %v", err)
+			continue
+		}
+		if from == to {
+			llog.Errorf("[dst forward转发] 转发配置 %s 的来源与目标相同，已跳过", from)
+			continue
+		}
+		t.edges[from] = append(t.edges[from], to)
+		if r.Bidirectional {
+			t.edges[to] = append(t.edges[to], from)
+		}
+		llog.Infof("[dst forward转发] 已添加转发 %s -> %s 双向: %t", from, to, r.Bidirectional)
+	}
+	return t
+}
+
+// Targets 计算消息的转发目标
+// base 为默认目标，origin 不为空时消息已被转发过一次，只投递默认目标不再继续转发，
+// 目标中总是排除消息所在端点与消息的原始来源
+func (t *RelayTable) Targets(from Endpoint, origin *Origin, base []Endpoint) []Endpoint {
+	exclude := map[Endpoint]bool{from: true}
+	if origin != nil {
+		exclude[origin.endpoint()] = true
+	}
+
+	candidates := base
+	if origin == nil {
+		candidates = append(append([]Endpoint{}, base...), t.edges[from]...)
+	}
+
+	targets := make([]Endpoint, 0, len(candidates))
+	for _, e := range candidates {
+		if exclude[e] {
+			continue
+		}
+		exclude[e] = true
+		targets = append(targets, e)
+	}
+	return targets
+}
+
+// relayGroupMessage 将QQ群消息转发到各目标
+func relayGroupMessage(groupMsg *message.GroupMessage) {
+	from := groupEndpoint(groupMsg.GroupUin)
+	origin := Origin{Kind: EndpointGroup, ID: from.ID, Name: groupMsg.GroupName}
+	name := groupMsg.Sender.CardName
+	if name == "" {
+		name = groupMsg.Sender.Nickname
+	}
+
+	// 群聊转发策略作用于全部目标，包括游戏与其它群
+	content, ok := policyFor(groupMsg.GroupUin).toDst(groupMsg)
+	if !ok {
+		return
+	}
+	player := strconv.FormatUint(uint64(groupMsg.Sender.Uin), 10)
+	if b, ok := GlobalBindStore.ByQQ(groupMsg.Sender.Uin); ok {
+		player = b.KleiID
+	}
+
+	targets := GlobalRelay.Targets(from, nil, []Endpoint{serverEndpoint(defaultCluster)})
+	var clusters []string
+	for _, target := range targets {
+		if target.Kind == EndpointServer {
+			clusters = append(clusters, target.ID)
+		}
+	}
+	toDst, toQQ := moderateGroupMessage(content, player, name, clusters)
+
+	for _, target := range targets {
+		switch target.Kind {
+		case EndpointServer:
+			if !toDst.Dropped {
+				queueFor(target.ID).enqueueGroupMessage(groupMsg, toDst.Text, origin)
+			}
+		case EndpointGroup:
+			if toQQ.Dropped || !policyFor(target.groupID()).toQQ() {
+				continue
+			}
+			bot.QQClient.Client().SendGroupMessage(target.groupID(), simpleTextElements(
+				fmt.Sprintf("[%s] %s: %s", groupMsg.GroupName, name, toQQ.Text)))
+		}
+	}
+}
+
+// relayDstMsg 将游戏聊天消息转发到各目标
+func relayDstMsg(msg DstMsg) {
+	text, ok := moderate(PolicyToQQ, msg.Message, msg.KleiID, msg.UserName, msg.Cluster)
+	if !ok {
+		return
+	}
+	msg.Message = text
+
+	from := serverEndpoint(msg.Cluster)
+	base := make([]Endpoint, 0, len(config.GlobalConfig.Other.BindGroups))
+	for _, gid := range config.GlobalConfig.Other.BindGroups {
+		base = append(base, groupEndpoint(gid))
+	}
+
+	for _, target := range GlobalRelay.Targets(from, msg.Origin, base) {
+		switch target.Kind {
+		case EndpointGroup:
+			if !policyFor(target.groupID()).toQQ() {
+				continue
+			}
+			bot.QQClient.Client().SendGroupMessage(target.groupID(),
+				[]message.IMessageElement{parseDstMsg(msg)})
+		case EndpointServer:
+			queueFor(target.ID).enqueue(Message{
+				Type: MsgText,
+				Data: Data{
+					Source:  Source{Name: from.ID},
+					Sender:  Sender{Name: msg.UserName},
+					Content: msg.Message,
+					Origin:  &Origin{Kind: EndpointServer, ID: from.ID, Name: from.ID},
+				},
+			})
+		}
+	}
+}
+
+var (
+	clusterQueues   = make(map[string]*MsgQueue)
+	clusterQueuesMu sync.Mutex
+)
+
+// queueFor 获取集群的消息队列，默认集群使用 GlobalMsgQueue
+func queueFor(cluster string) *MsgQueue {
+	if cluster == "" || cluster == defaultCluster {
+		return GlobalMsgQueue
+	}
+	clusterQueuesMu.Lock()
+	defer clusterQueuesMu.Unlock()
+	q, ok := clusterQueues[cluster]
+	if !ok {
+		q = DefaultQueue()
+		if config.GlobalConfig != nil {
+			q.configure(config.GlobalConfig.Queue)
+		}
+		clusterQueues[cluster] = q
+	}
+	return q
+}
+
+var GlobalRelay *RelayTable
@@ -0,0 +1,80 @@
+package dstforward
+
+import (
+	"reflect"
+	"testing"
+
+	"llma.dev/config"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	if e, err := ParseEndpoint(" group:114514 "); err != nil || e != groupEndpoint(114514) {
+		t.Errorf("ParseEndpoint(group:114514) = %v, %v", e, err)
+	}
+	if e, err := ParseEndpoint("server:cave"); err != nil || e != serverEndpoint("cave") {
+		t.Errorf("ParseEndpoint(server:cave) = %v, %v", e, err)
+	}
+	for _, s := range []string{"group", "group:", "group:abc", "channel:1", "server"} {
+		if _, err := ParseEndpoint(s); err == nil {
+			t.Errorf("ParseEndpoint(%q) 应返回错误", s)
+		}
+	}
+}
+
+func TestRelayTargets(t *testing.T) {
+	table := NewRelayTable([]config.RelayConfig{
+		{From: "server:forest", To: "server:cave", Bidirectional: true},
+		{From: "group:1", To: "group:2"},
+		{From: "group:3", To: "group:3"},
+		{From: "group:x", To: "group:1"},
+	})
+	g1, g2, g3 := groupEndpoint(1), groupEndpoint(2), groupEndpoint(3)
+	forest, cave := serverEndpoint("forest"), serverEndpoint("cave")
+
+	tests := []struct {
+		name   string
+		from   Endpoint
+		origin *Origin
+		base   []Endpoint
+		want   []Endpoint
+	}{
+		{"默认目标加转发目标", g1, nil, []Endpoint{serverEndpoint("")}, []Endpoint{serverEndpoint(""), g2}},
+		{"单向转发不反向", g2, nil, nil, []Endpoint{}},
+		{"自环配置被跳过", g3, nil, nil, []Endpoint{}},
+		{"排除消息所在端点", forest, nil, []Endpoint{g1, forest}, []Endpoint{g1, cave}},
+		{"去重", g1, nil, []Endpoint{g2, g2}, []Endpoint{g2}},
+		// 从 forest 转发到 cave 的消息再被 cave 的 mod 上报时，只投递到 cave 的默认目标，不会回到 forest
+		{"已转发的消息不再转发", cave, &Origin{Kind: EndpointServer, ID: "forest"}, []Endpoint{g1, g3}, []Endpoint{g1, g3}},
+		{"默认目标中排除原始来源", cave, &Origin{Kind: EndpointGroup, ID: "1"}, []Endpoint{g1, g3}, []Endpoint{g3}},
+	}
+	for _, tt := range tests {
+		if got := table.Targets(tt.from, tt.origin, tt.base); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Targets = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRelayDstMsgMarksOrigin(t *testing.T) {
+	savedConfig, savedRelay := config.GlobalConfig, GlobalRelay
+	defer func() { config.GlobalConfig, GlobalRelay = savedConfig, savedRelay }()
+	config.GlobalConfig = &config.Config{}
+	GlobalRelay = NewRelayTable([]config.RelayConfig{{From: "server:forest", To: "server:cave", Bidirectional: true}})
+	queueFor("forest").drain()
+	queueFor("cave").drain()
+
+	relayDstMsg(DstMsg{UserName: "wilson", KleiID: "KU_1", Message: "洞里有宝箱", Cluster: "forest"})
+	msgs := queueFor("cave").drain()
+	if len(msgs) != 1 {
+		t.Fatalf("cave 收到 %d 条消息, want 1", len(msgs))
+	}
+	relayed := msgs[0].Data
+	if relayed.Content != "洞里有宝箱" || relayed.Origin == nil || relayed.Origin.endpoint() != serverEndpoint("forest") {
+		t.Fatalf("转发到 cave 的消息 = %+v", relayed)
+	}
+
+	// cave 的 mod 将收到的转发消息连同来源一起上报，不应再转发回 forest
+	relayDstMsg(DstMsg{UserName: "wilson", Message: "洞里有宝箱", Cluster: "cave", Origin: relayed.Origin})
+	if msgs := queueFor("forest").drain(); len(msgs) != 0 {
+		t.Errorf("消息被转发回来源集群: %+v", msgs)
+	}
+}
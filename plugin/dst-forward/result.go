@@ -0,0 +1,116 @@
+package dstforward
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"llma.dev/logic"
+)
+
+// 等待命令结果的超时时间
+const cmdResultTTL = 5 * time.Minute
+
+// CmdResult mod 回传的命令执行结果
+type CmdResult struct {
+	// ID 命令id，与下发命令时 Data.ID 一致
+	ID string `json:"id"`
+	// Success 是否执行成功
+	Success bool `json:"success"`
+	// Output 执行输出
+	Output string `json:"output"`
+}
+
+// resultWaiter 等待结果的命令
+type resultWaiter struct {
+	head     string
+	expireAt time.Time
+	reply    func(text string)
+}
+
+// ResultRegistry 记录等待结果的命令，结果回传后回复到命令来源会话
+type ResultRegistry struct {
+	mu      sync.Mutex
+	waiters map[string]*resultWaiter
+}
+
+// NewResultRegistry 创建命令结果登记表
+func NewResultRegistry() *ResultRegistry {
+	return &ResultRegistry{waiters: make(map[string]*resultWaiter)}
+}
+
+// Register 登记一个等待结果的命令，返回命令id
+func (r *ResultRegistry) Register(head string, reply func(text string)) string {
+	id := newCmdID()
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 顺便清理过期的等待
+	for k, w := range r.waiters {
+		if now.After(w.expireAt) {
+			delete(r.waiters, k)
+		}
+	}
+	r.waiters[id] = &resultWaiter{
+		head:     head,
+		expireAt: now.Add(cmdResultTTL),
+		reply:    reply,
+	}
+	return id
+}
+
+// Resolve 处理回传的结果，返回是否存在对应的命令
+func (r *ResultRegistry) Resolve(result CmdResult) bool {
+	r.mu.Lock()
+	w, ok := r.waiters[result.ID]
+	delete(r.waiters, result.ID)
+	r.mu.Unlock()
+	if !ok || time.Now().After(w.expireAt) {
+		return false
+	}
+
+	status := "成功"
+	if !result.Success {
+		status = "失败"
+	}
+	text := fmt.Sprintf("命令 %s 执行%s", w.head, status)
+	if result.Output != "" {
+		text += ":\n" + result.Output
+	}
+	w.reply(text)
+	return true
+}
+
+// enqueueCmdWithResult 按消息来源向命令作用的集群插入需要回传结果的命令
+func enqueueCmdWithResult(ctx *logic.MessageContext, head string, content any) bool {
+	source, sender, ok := sessionOf(ctx)
+	if !ok {
+		return false
+	}
+	id := GlobalResults.Register(head, func(text string) {
+		ctx.Reply(simpleTextElements(text))
+	})
+	queueFor(commandCluster(ctx)).enqueue(Message{
+		Type: MsgCmd,
+		Data: Data{
+			ID:      id,
+			Source:  source,
+			Sender:  sender,
+			Head:    head,
+			Content: content,
+		},
+	})
+	return true
+}
+
+// newCmdID 生成随机命令id
+func newCmdID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var GlobalResults = NewResultRegistry()
@@ -0,0 +1,57 @@
+package dstforward
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultRegistryResolve(t *testing.T) {
+	r := NewResultRegistry()
+	var replies []string
+	id := r.Register("lua", func(text string) { replies = append(replies, text) })
+
+	if r.Resolve(CmdResult{ID: "unknown", Success: true}) {
+		t.Error("未登记的命令id不应被处理")
+	}
+	if !r.Resolve(CmdResult{ID: id, Success: false, Output: "attempt to call a nil value"}) {
+		t.Fatal("登记的命令结果应被处理")
+	}
+	if r.Resolve(CmdResult{ID: id, Success: true}) {
+		t.Error("同一个命令的结果只处理一次")
+	}
+	want := "命令 lua 执行失败:\nattempt to call a nil value"
+	if len(replies) != 1 || replies[0] != want {
+		t.Errorf("replies = %q, want [%q]", replies, want)
+	}
+
+	expired := r.Register("lua", func(string) { t.Error("过期的命令不应回复") })
+	r.waiters[expired].expireAt = time.Now().Add(-time.Second)
+	if r.Resolve(CmdResult{ID: expired, Success: true}) {
+		t.Error("过期的命令结果不应被处理")
+	}
+}
+
+func TestEnqueueCmdWithResultUsesSelectedCluster(t *testing.T) {
+	defer selectedClusters.set(30, defaultCluster)
+	selectedClusters.set(30, "cave")
+	queueFor("cave").drain()
+
+	if !enqueueCmdWithResult(privateCtx(30), "lua", "print(1)") {
+		t.Fatal("QQ私聊应能下发命令")
+	}
+	msgs := queueFor("cave").drain()
+	if len(msgs) != 1 {
+		t.Fatalf("集群 cave 收到 %d 条消息, want 1", len(msgs))
+	}
+	data := msgs[0].Data
+	if msgs[0].Type != MsgCmd || data.Head != "lua" || data.Content != "print(1)" || data.Source.ID != 30 {
+		t.Errorf("下发的命令 = %+v", msgs[0])
+	}
+	GlobalResults.mu.Lock()
+	_, waiting := GlobalResults.waiters[data.ID]
+	delete(GlobalResults.waiters, data.ID)
+	GlobalResults.mu.Unlock()
+	if !waiting {
+		t.Errorf("命令 %s 应登记等待执行结果", data.ID)
+	}
+}
@@ -0,0 +1,415 @@
+package dstforward
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LagrangeDev/LagrangeGo/client/entity"
+	"llma.dev/bot"
+	"llma.dev/config"
+	"llma.dev/logic"
+	"llma.dev/utils/llog"
+)
+
+// 角色数据文件名
+const roleFileName = "roles.json"
+
+// RoleGrant 角色分配
+type RoleGrant struct {
+	// QQ 被授予角色的QQ号
+	QQ uint32 `json:"qq"`
+	// Role 角色名称
+	Role string `json:"role"`
+	// Cluster 生效的集群，为空时对全部集群生效
+	Cluster string `json:"cluster,omitempty"`
+	// Operator 操作者QQ号，配置文件中的分配为0
+	Operator uint32 `json:"operator,omitempty"`
+	// GrantedAt 授予时间
+	GrantedAt time.Time `json:"grantedAt,omitzero"`
+}
+
+// String 角色分配的展示文本
+func (g RoleGrant) String() string {
+	role, _ := logic.ParseRole(g.Role)
+	scope := "全部"
+	if g.Cluster != "" {
+		scope = "集群 " + g.Cluster
+	}
+	if g.Operator == 0 {
+		return fmt.Sprintf("%d %s 范围: %s (配置文件)", g.QQ, role.DisplayName(), scope)
+	}
+	return fmt.Sprintf("%d %s 范围: %s 操作者: %d 授予于: %s",
+		g.QQ, role.DisplayName(), scope, g.Operator, g.GrantedAt.Format("2006-01-02 15:04"))
+}
+
+// RoleStore 角色分配存储，配置文件中的分配只读，运行时授予的分配持久化到数据目录
+type RoleStore struct {
+	mu     sync.RWMutex
+	static []RoleGrant
+	grants []*RoleGrant
+	// QQ群主与管理员自动映射的角色，为 nil 时不映射
+	groupOwnerRole *logic.Role
+	groupAdminRole *logic.Role
+}
+
+// NewRoleStore 根据配置创建角色存储并读取持久化数据
+func NewRoleStore(cfg config.RoleConfig, legacyAdmins []uint32) *RoleStore {
+	s := &RoleStore{}
+	for _, qq := range cfg.Owners {
+		s.static = append(s.static, RoleGrant{QQ: qq, Role: logic.RoleOwner.String()})
+	}
+	// allowedUIDs 中的用户视为管理员
+	for _, qq := range legacyAdmins {
+		s.static = append(s.static, RoleGrant{QQ: qq, Role: logic.RoleAdmin.String()})
+	}
+	for _, a := range cfg.Assignments {
+		role, err := logic.ParseRole(a.Role)
+		if err != nil {
+			llog.Errorf("[dst forward权限] QQ %d 的角色配置错误，已跳过: %v", a.QQ, err)
+			continue
+		}
+		s.static = append(s.static, RoleGrant{QQ: a.QQ, Role: role.String(), Cluster: a.Cluster})
+	}
+	s.groupOwnerRole = parseMappedRole("groupOwnerRole", cfg.GroupOwnerRole)
+	s.groupAdminRole = parseMappedRole("groupAdminRole", cfg.GroupAdminRole)
+
+	if err := loadJSON(roleFileName, &s.grants); err != nil {
+		llog.Errorf("[dst forward权限] 读取角色数据失败: %v", err)
+	}
+	if len(s.Admins()) == 0 && s.groupOwnerRole == nil && s.groupAdminRole == nil {
+		llog.Warningf("[dst forward权限] 未配置任何所有者或管理员，也未启用QQ群身份映射，管理命令将无人可用，请在配置文件 [role] 中设置 owners")
+	}
+	return s
+}
+
+// parseMappedRole 解析QQ群身份映射的角色，为空时不映射
+func parseMappedRole(key string, name string) *logic.Role {
+	if name == "" {
+		return nil
+	}
+	role, err := logic.ParseRole(name)
+	if err != nil {
+		llog.Errorf("[dst forward权限] %s 配置错误，已禁用映射: %v", key, err)
+		return nil
+	}
+	return &role
+}
+
+// all 全部角色分配，配置文件中的在前
+func (s *RoleStore) all() []RoleGrant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := slices.Clone(s.static)
+	for _, g := range s.grants {
+		list = append(list, *g)
+	}
+	return list
+}
+
+// List 全部角色分配
+func (s *RoleStore) List() []RoleGrant {
+	return s.all()
+}
+
+// RoleOf 查询QQ号在集群下被分配的角色，cluster 为空时只计算全局分配
+func (s *RoleStore) RoleOf(qq uint32, cluster string) logic.Role {
+	result := logic.RoleMember
+	for _, g := range s.all() {
+		if g.QQ != qq || (g.Cluster != "" && g.Cluster != cluster) {
+			continue
+		}
+		if role, err := logic.ParseRole(g.Role); err == nil && role > result {
+			result = role
+		}
+	}
+	return result
+}
+
+// Admins 全局的管理员与所有者QQ号
+func (s *RoleStore) Admins() []uint32 {
+	var admins []uint32
+	for _, g := range s.all() {
+		if role, _ := logic.ParseRole(g.Role); role >= logic.RoleAdmin && g.Cluster == "" && !slices.Contains(admins, g.QQ) {
+			admins = append(admins, g.QQ)
+		}
+	}
+	return admins
+}
+
+// GroupRole 根据QQ群身份映射的角色
+func (s *RoleStore) GroupRole(permission entity.GroupMemberPermission) logic.Role {
+	switch {
+	case permission == entity.Owner && s.groupOwnerRole != nil:
+		return *s.groupOwnerRole
+	case permission == entity.Admin && s.groupAdminRole != nil:
+		return *s.groupAdminRole
+	}
+	return logic.RoleMember
+}
+
+// Grant 授予角色，同一QQ号在同一范围内只保留一条分配
+func (s *RoleStore) Grant(grant RoleGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grants = slices.DeleteFunc(s.grants, func(g *RoleGrant) bool {
+		return g.QQ == grant.QQ && g.Cluster == grant.Cluster
+	})
+	s.grants = append(s.grants, &grant)
+	return saveJSON(roleFileName, s.grants)
+}
+
+// Revoke 撤销运行时授予的角色，配置文件中的分配无法撤销
+func (s *RoleStore) Revoke(qq uint32, cluster string) (RoleGrant, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.grants, func(g *RoleGrant) bool {
+		return g.QQ == qq && g.Cluster == cluster
+	})
+	if i < 0 {
+		return RoleGrant{}, false, nil
+	}
+	removed := *s.grants[i]
+	s.grants = slices.Delete(s.grants, i, i+1)
+	return removed, true, saveJSON(roleFileName, s.grants)
+}
+
+var GlobalRoleStore *RoleStore
+
+// resolveRole 获取消息发送者在命令作用的集群上的角色
+// 游戏内命令通过绑定关系找到QQ号
+func resolveRole(ctx *logic.MessageContext) logic.Role {
+	if GlobalRoleStore == nil {
+		return logic.RoleMember
+	}
+	var uin uint32
+	if privateMsg, ok := ctx.GetPrivateMessage(); ok {
+		uin = privateMsg.Sender.Uin
+	} else if groupMsg, ok := ctx.GetGroupMessage(); ok {
+		uin = groupMsg.Sender.Uin
+	} else if player, ok := dstPlayerOf(ctx); ok {
+		binding, found := GlobalBindStore.ByKleiID(player.SenderID())
+		if !found {
+			return logic.RoleMember
+		}
+		uin = binding.QQ
+	} else {
+		return logic.RoleMember
+	}
+	return roleOf(uin, roleGroups(ctx), commandCluster(ctx))
+}
+
+// roleGroups 计算QQ群身份映射时查看的群，群消息只看当前群，其余看全部绑定群
+func roleGroups(ctx *logic.MessageContext) []uint32 {
+	if groupMsg, ok := ctx.GetGroupMessage(); ok {
+		return []uint32{groupMsg.GroupUin}
+	}
+	return config.GlobalConfig.Other.BindGroups
+}
+
+// roleOf QQ号在集群上实际生效的角色，取角色分配与QQ群身份映射中较高的一个
+func roleOf(uin uint32, groups []uint32, cluster string) logic.Role {
+	role := GlobalRoleStore.RoleOf(uin, cluster)
+	if GlobalRoleStore.groupOwnerRole == nil && GlobalRoleStore.groupAdminRole == nil {
+		return role
+	}
+	for _, gid := range groups {
+		member := bot.QQClient.Client().GetCachedMemberInfo(uin, gid)
+		if member == nil {
+			continue
+		}
+		role = max(role, GlobalRoleStore.GroupRole(member.Permission))
+	}
+	return role
+}
+
+// registerRolePermissions 为每个角色注册同名权限
+func registerRolePermissions() {
+	for _, role := range logic.Roles() {
+		if role == logic.RoleMember {
+			continue
+		}
+		logic.Manager.RegisterPermission(role.String(), role.DisplayName(), logic.RoleMiddleware(role, resolveRole))
+	}
+}
+
+// permissionOfRole 角色对应的命令权限，成员角色不需要权限
+func permissionOfRole(name string) (string, error) {
+	if name == "" || name == "all" {
+		return "", nil
+	}
+	role, err := logic.ParseRole(name)
+	if err != nil {
+		return "", err
+	}
+	if role == logic.RoleMember {
+		return "", nil
+	}
+	return role.String(), nil
+}
+
+// applyCommandRoles 按配置覆盖命令所需的角色，子命令使用 "命令 子命令" 作为名称
+func applyCommandRoles(commands []*logic.Command, overrides map[string]string) {
+	var apply func(c *logic.Command, path string)
+	apply = func(c *logic.Command, path string) {
+		if name, ok := overrides[path]; ok {
+			permission, err := permissionOfRole(name)
+			if err != nil {
+				llog.Errorf("[dst forward权限] 命令 %s 的角色配置错误，已使用默认角色: %v", path, err)
+			} else {
+				c.Permission = permission
+			}
+		}
+		for _, sub := range c.Subcommands {
+			apply(sub, path+" "+sub.Name)
+		}
+	}
+	for _, c := range commands {
+		apply(c, c.Name)
+	}
+}
+
+// roleArg 角色参数
+func roleArg(name string) logic.Arg {
+	return logic.Arg{
+		Name:        name,
+		Required:    true,
+		Description: "member 成员, operator 操作员, admin 管理员",
+		Parse: func(raw string) (any, error) {
+			return logic.ParseRole(raw)
+		},
+	}
+}
+
+// RoleViewHandler 查看角色 /权限 [QQ号]
+type RoleViewHandler struct{}
+
+func (h *RoleViewHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	cluster := commandCluster(ctx)
+	if args.Has("QQ号") {
+		uin := args.Uin("QQ号")
+		ctx.Reply(simpleTextElements(fmt.Sprintf("%d 在集群 %s 的角色: %s",
+			uin, cluster, roleOf(uin, roleGroups(ctx), cluster).DisplayName())))
+		return nil
+	}
+	ctx.Reply(simpleTextElements(fmt.Sprintf("你在集群 %s 的角色: %s", cluster, resolveRole(ctx).DisplayName())))
+	return nil
+}
+
+// RoleListHandler 角色分配列表
+type RoleListHandler struct{}
+
+func (h *RoleListHandler) Handle(ctx *logic.MessageContext, _ logic.Args) error {
+	grants := GlobalRoleStore.List()
+	if len(grants) == 0 {
+		ctx.Reply(simpleTextElements("当前没有角色分配"))
+		return nil
+	}
+	lines := make([]string, 0, len(grants)+1)
+	lines = append(lines, fmt.Sprintf("角色分配 (共 %d 条):", len(grants)))
+	for _, g := range grants {
+		lines = append(lines, g.String())
+	}
+	ctx.Reply(simpleTextElements(strings.Join(lines, "\n")))
+	return nil
+}
+
+// RoleGrantHandler 授予角色，只能授予比自己低的角色
+type RoleGrantHandler struct{}
+
+func (h *RoleGrantHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	uin, role, cluster := args.Uin("QQ号"), args.Get("角色").(logic.Role), args.String("集群")
+	self := grantorRole(ctx, cluster)
+	if role >= self {
+		return logic.NewUsageError("只能授予比自己(%s)低的角色", self.DisplayName())
+	}
+	operator, _, _ := senderInfo(ctx)
+	err := GlobalRoleStore.Grant(RoleGrant{
+		QQ:        uin,
+		Role:      role.String(),
+		Cluster:   cluster,
+		Operator:  operator,
+		GrantedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("保存角色数据失败: %w", err)
+	}
+	llog.Infof("[dst forward权限] %d 授予 %d 角色 %s 集群: %s", operator, uin, role, cluster)
+	ctx.Reply(simpleTextElements(fmt.Sprintf("已授予 %d %s 角色", uin, role.DisplayName())))
+	return nil
+}
+
+// grantorRole 授予或撤销角色的操作者在分配范围上的角色，全局分配只看全局角色
+func grantorRole(ctx *logic.MessageContext, cluster string) logic.Role {
+	uin, _, ok := senderInfo(ctx)
+	if !ok {
+		return logic.RoleMember
+	}
+	return roleOf(uin, roleGroups(ctx), cluster)
+}
+
+// RoleRevokeHandler 撤销角色，只能撤销比自己低的角色
+type RoleRevokeHandler struct{}
+
+func (h *RoleRevokeHandler) Handle(ctx *logic.MessageContext, args logic.Args) error {
+	uin, cluster := args.Uin("QQ号"), args.String("集群")
+	self := grantorRole(ctx, cluster)
+	if target := GlobalRoleStore.RoleOf(uin, cluster); target >= self {
+		return logic.NewUsageError("只能撤销比自己(%s)低的角色", self.DisplayName())
+	}
+	removed, ok, err := GlobalRoleStore.Revoke(uin, cluster)
+	if err != nil {
+		return fmt.Errorf("保存角色数据失败: %w", err)
+	}
+	if !ok {
+		ctx.Reply(simpleTextElements(fmt.Sprintf("%d 没有可撤销的角色，配置文件中的角色需修改配置文件", uin)))
+		return nil
+	}
+	operator, _, _ := senderInfo(ctx)
+	llog.Infof("[dst forward权限] %d 撤销 %d 的角色 %s 集群: %s", operator, uin, removed.Role, cluster)
+	ctx.Reply(simpleTextElements(fmt.Sprintf("已撤销 %d 的角色", uin)))
+	return nil
+}
+
+// roleCommands 权限管理命令
+func roleCommands() []*logic.Command {
+	return []*logic.Command{
+		{
+			Name:        "权限",
+			Description: "查看与管理角色，不填QQ号时查看自己",
+			Args:        []logic.Arg{{Name: "QQ号", Type: logic.ArgUin}},
+			Handler:     &RoleViewHandler{},
+			Subcommands: []*logic.Command{
+				{
+					Name:        "列表",
+					Description: "查看角色分配",
+					Permission:  PermAdmin,
+					Handler:     &RoleListHandler{},
+				},
+				{
+					Name:        "授予",
+					Description: "授予角色，集群不填时全局生效，只能授予比自己在该范围内低的角色",
+					Permission:  PermAdmin,
+					Args: []logic.Arg{
+						{Name: "QQ号", Type: logic.ArgUin, Required: true},
+						roleArg("角色"),
+						{Name: "集群"},
+					},
+					Handler: &RoleGrantHandler{},
+				},
+				{
+					Name:        "撤销",
+					Description: "撤销运行时授予的角色",
+					Permission:  PermAdmin,
+					Args: []logic.Arg{
+						{Name: "QQ号", Type: logic.ArgUin, Required: true},
+						{Name: "集群"},
+					},
+					Handler: &RoleRevokeHandler{},
+				},
+			},
+		},
+	}
+}
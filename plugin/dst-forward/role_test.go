@@ -0,0 +1,128 @@
+package dstforward
+
+import (
+	"testing"
+
+	"github.com/LagrangeDev/LagrangeGo/message"
+	"llma.dev/config"
+	"llma.dev/logic"
+)
+
+// privateCtx QQ号发送的私聊消息上下文
+func privateCtx(uin uint32) *logic.MessageContext {
+	return logic.NewMessageContext(nil, &message.PrivateMessage{Sender: &message.Sender{Uin: uin}})
+}
+
+func TestRoleStorePerCluster(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewRoleStore(config.RoleConfig{
+		Owners: []uint32{1},
+		Assignments: []config.RoleAssignConfig{
+			{QQ: 2, Role: "operator"},
+			{QQ: 3, Role: "admin", Cluster: "cave"},
+			{QQ: 4, Role: "root"},
+		},
+	}, []uint32{5})
+
+	tests := []struct {
+		qq      uint32
+		cluster string
+		want    logic.Role
+	}{
+		{1, defaultCluster, logic.RoleOwner},
+		{1, "cave", logic.RoleOwner},
+		{2, "cave", logic.RoleOperator},
+		{3, "cave", logic.RoleAdmin},
+		{3, defaultCluster, logic.RoleMember},
+		{3, "", logic.RoleMember},
+		{4, defaultCluster, logic.RoleMember},
+		{5, "forest", logic.RoleAdmin},
+	}
+	for _, tt := range tests {
+		if got := s.RoleOf(tt.qq, tt.cluster); got != tt.want {
+			t.Errorf("RoleOf(%d, %q) = %s, want %s", tt.qq, tt.cluster, got, tt.want)
+		}
+	}
+	// 集群管理员不会收到全局的管理通知
+	if admins := s.Admins(); len(admins) != 2 {
+		t.Errorf("Admins() = %v, want [1 5]", admins)
+	}
+}
+
+func TestRoleStoreGrantPersistsClusters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewRoleStore(config.RoleConfig{}, nil)
+	for _, g := range []RoleGrant{
+		{QQ: 10, Role: "operator", Operator: 1},
+		{QQ: 10, Role: "admin", Cluster: "cave", Operator: 1},
+		{QQ: 10, Role: "operator", Cluster: "cave", Operator: 1},
+	} {
+		if err := s.Grant(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重新读取后保留集群分配，同一范围只保留最后一次授予
+	s = NewRoleStore(config.RoleConfig{}, nil)
+	if n := len(s.List()); n != 2 {
+		t.Fatalf("分配数 = %d, want 2", n)
+	}
+	if got := s.RoleOf(10, "cave"); got != logic.RoleOperator {
+		t.Fatalf("RoleOf(10, cave) = %s, want operator", got)
+	}
+	if _, ok, err := s.Revoke(10, ""); !ok || err != nil {
+		t.Fatalf("Revoke(10, \"\") = %v, %v", ok, err)
+	}
+	if got := s.RoleOf(10, defaultCluster); got != logic.RoleMember {
+		t.Fatalf("撤销全局分配后 RoleOf(10, default) = %s, want member", got)
+	}
+	if got := s.RoleOf(10, "cave"); got != logic.RoleOperator {
+		t.Fatalf("撤销全局分配不应影响集群分配: %s", got)
+	}
+}
+
+func TestResolveRoleUsesSelectedCluster(t *testing.T) {
+	t.Chdir(t.TempDir())
+	savedConfig, savedRoles := config.GlobalConfig, GlobalRoleStore
+	defer func() {
+		config.GlobalConfig, GlobalRoleStore = savedConfig, savedRoles
+		selectedClusters.set(20, defaultCluster)
+	}()
+	config.GlobalConfig = &config.Config{}
+	GlobalRoleStore = NewRoleStore(config.RoleConfig{
+		Assignments: []config.RoleAssignConfig{{QQ: 20, Role: "admin", Cluster: "cave"}},
+	}, nil)
+
+	ctx := privateCtx(20)
+	if cluster, role := commandCluster(ctx), resolveRole(ctx); cluster != defaultCluster || role != logic.RoleMember {
+		t.Fatalf("未选择集群时 = %s %s, want default member", cluster, role)
+	}
+	selectedClusters.set(20, "cave")
+	if cluster, role := commandCluster(ctx), resolveRole(ctx); cluster != "cave" || role != logic.RoleAdmin {
+		t.Fatalf("选择 cave 后 = %s %s, want cave admin", cluster, role)
+	}
+	// 全局授予只看全局角色，集群管理员不能授予全局角色
+	if role := grantorRole(ctx, ""); role != logic.RoleMember {
+		t.Fatalf("grantorRole(全局) = %s, want member", role)
+	}
+	// 选择的集群只影响自己
+	if cluster := commandCluster(privateCtx(21)); cluster != defaultCluster {
+		t.Fatalf("其他用户的集群 = %s, want default", cluster)
+	}
+}
+
+func TestCommandClusterForPlayers(t *testing.T) {
+	tests := []struct {
+		cluster string
+		want    string
+	}{
+		{"", defaultCluster},
+		{"cave", "cave"},
+	}
+	for _, tt := range tests {
+		player := &dstPlayerMessage{msg: DstMsg{UserName: "wilson", KleiID: "KU_1", Cluster: tt.cluster}}
+		if got := commandCluster(logic.NewMessageContext(nil, player)); got != tt.want {
+			t.Errorf("玩家在 %q 时 commandCluster = %s, want %s", tt.cluster, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package dstforward
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"llma.dev/config"
+	"llma.dev/utils/llog"
+)
+
+// 计划任务数据文件名
+const scheduleFileName = "schedules.json"
+
+// 计划任务动作
+const (
+	ActionSave     = "save"     // 存档
+	ActionAnnounce = "announce" // 游戏内公告
+	ActionRestart  = "restart"  // 重启服务器
+	ActionMessage  = "message"  // 向绑定群聊发送消息
+)
+
+// actionNames 动作的展示名称
+var actionNames = map[string]string{
+	ActionSave:     "存档",
+	ActionAnnounce: "公告",
+	ActionRestart:  "重启",
+	ActionMessage:  "群消息",
+}
+
+// Job 计划任务
+type Job struct {
+	// Name 任务名称，唯一
+	Name string `json:"name"`
+	// Spec cron 表达式，分 时 日 月 周
+	Spec string `json:"spec"`
+	// Action 执行的动作
+	Action string `json:"action"`
+	// Content 公告或群消息的内容
+	Content string `json:"content,omitempty"`
+	// Warnings 执行前多少分钟发出提醒，群消息在绑定群聊中提醒，其余动作在游戏内提醒
+	Warnings []int `json:"warnings,omitempty"`
+	// Cluster 执行动作的集群，为空时为 default 集群
+	Cluster string `json:"cluster,omitempty"`
+	// FromConfig 是否来自配置文件，来自配置文件的任务不能在运行时删除
+	FromConfig bool `json:"-"`
+
+	schedule cron.Schedule
+	fn       func()
+}
+
+// String 任务的展示文本
+func (j *Job) String() string {
+	text := fmt.Sprintf("%s [%s] %s", j.Name, j.Spec, actionNames[j.Action])
+	if j.Cluster != "" && j.Action != ActionMessage {
+		text += fmt.Sprintf("(%s)", j.Cluster)
+	}
+	if j.Content != "" {
+		text += " " + j.Content
+	}
+	if len(j.Warnings) > 0 {
+		text += fmt.Sprintf(" 提前提醒(分钟): %v", j.Warnings)
+	}
+	if j.FromConfig {
+		text += " (配置文件)"
+	}
+	return text
+}
+
+// Scheduler 计划任务调度器，每分钟检查一次到期任务
+type Scheduler struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewScheduler 创建调度器，载入配置文件与持久化的任务
+func NewScheduler(configJobs []config.ScheduleConfig) *Scheduler {
+	s := &Scheduler{jobs: make(map[string]*Job)}
+
+	for _, c := range configJobs {
+		job := &Job{
+			Name:       c.Name,
+			Spec:       c.Cron,
+			Action:     c.Action,
+			Content:    c.Content,
+			Warnings:   c.Warnings,
+			Cluster:    c.Cluster,
+			FromConfig: true,
+		}
+		if err := s.add(job); err != nil {
+			llog.Errorf("[dst forward计划] 配置文件中的任务 %s 无效，已跳过: %v", c.Name, err)
+		}
+	}
+
+	var saved []*Job
+	if err := loadJSON(scheduleFileName, &saved); err != nil {
+		llog.Errorf("[dst forward计划] 读取计划任务失败: %v", err)
+	}
+	for _, job := range saved {
+		if err := s.add(job); err != nil {
+			llog.Errorf("[dst forward计划] 已保存的任务 %s 无效，已跳过: %v", job.Name, err)
+		}
+	}
+	return s
+}
+
+// Add 添加运行时任务并持久化
+func (s *Scheduler) Add(job *Job) error {
+	if err := s.add(job); err != nil {
+		return err
+	}
+	s.save()
+	return nil
+}
+
+// AddFunc 添加执行函数的内部任务，不会持久化也不能删除
+func (s *Scheduler) AddFunc(name string, spec string, fn func()) error {
+	return s.add(&Job{Name: name, Spec: spec, FromConfig: true, fn: fn})
+}
+
+// Remove 删除运行时任务
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("任务 %s 不存在", name)
+	}
+	if job.FromConfig {
+		s.mu.Unlock()
+		return fmt.Errorf("任务 %s 来自配置文件，请在配置文件中删除", name)
+	}
+	delete(s.jobs, name)
+	s.mu.Unlock()
+
+	s.save()
+	return nil
+}
+
+// List 按名称排序的全部任务
+func (s *Scheduler) List() []*Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+// Run 启动调度循环
+func (s *Scheduler) Run() {
+	for {
+		// 对齐到下一分钟
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(next.Sub(now))
+		s.tick(next)
+	}
+}
+
+// tick 执行在 t 时刻到期的任务与提醒
+func (s *Scheduler) tick(t time.Time) {
+	for _, job := range s.List() {
+		if isDue(job.schedule, t) {
+			llog.Infof("[dst forward计划] 执行任务 %s", job.Name)
+			s.execute(job)
+		}
+		for _, minutes := range job.Warnings {
+			if isDue(job.schedule, t.Add(time.Duration(minutes)*time.Minute)) {
+				s.warn(job, minutes)
+			}
+		}
+	}
+}
+
+// execute 执行任务动作
+func (s *Scheduler) execute(job *Job) {
+	if job.fn != nil {
+		job.fn()
+		return
+	}
+	switch job.Action {
+	case ActionSave, ActionRestart:
+		queueFor(job.Cluster).enqueueCmdMsg(job.Action, nil, Source{}, Sender{})
+	case ActionAnnounce:
+		queueFor(job.Cluster).enqueueCmdMsg(job.Action, job.Content, Source{}, Sender{})
+	case ActionMessage:
+		sendToBindGroups(job.Content)
+	}
+}
+
+// warn 在任务执行前 minutes 分钟发出提醒
+func (s *Scheduler) warn(job *Job, minutes int) {
+	text := warningText(job, minutes)
+	if text == "" {
+		return
+	}
+	if job.Action == ActionMessage {
+		sendToBindGroups(text)
+		return
+	}
+	queueFor(job.Cluster).enqueueCmdMsg(ActionAnnounce, text, Source{}, Sender{})
+}
+
+// warningText 各动作的提醒文本，内部任务没有提醒
+func warningText(job *Job, minutes int) string {
+	switch job.Action {
+	case ActionSave:
+		return fmt.Sprintf("服务器将在 %d 分钟后存档", minutes)
+	case ActionRestart:
+		return fmt.Sprintf("服务器将在 %d 分钟后重启，请做好准备", minutes)
+	case ActionAnnounce:
+		return fmt.Sprintf("%d 分钟后公告: %s", minutes, job.Content)
+	case ActionMessage:
+		return fmt.Sprintf("%d 分钟后: %s", minutes, job.Content)
+	default:
+		return ""
+	}
+}
+
+// parseJobOptions 解析动作之后的 提醒=分钟,分钟 与 集群=名称 选项，返回剩余的内容
+func parseJobOptions(job *Job, fields []string) ([]string, error) {
+	for len(fields) > 0 {
+		key, value, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			break
+		}
+		switch key {
+		case "提醒":
+			for _, item := range strings.Split(value, ",") {
+				minutes, err := strconv.Atoi(strings.TrimSpace(item))
+				if err != nil {
+					return nil, fmt.Errorf("提醒时间 %s 无效", item)
+				}
+				job.Warnings = append(job.Warnings, minutes)
+			}
+		case "集群":
+			job.Cluster = value
+		default:
+			return fields, nil
+		}
+		fields = fields[1:]
+	}
+	return fields, nil
+}
+
+// add 校验并添加任务
+func (s *Scheduler) add(job *Job) error {
+	if job.Name == "" {
+		return fmt.Errorf("任务名称不能为空")
+	}
+	schedule, err := cron.ParseStandard(job.Spec)
+	if err != nil {
+		return fmt.Errorf("cron 表达式 %s 无效: %w", job.Spec, err)
+	}
+	if job.fn == nil {
+		if _, ok := actionNames[job.Action]; !ok {
+			return fmt.Errorf("动作 %s 无效", job.Action)
+		}
+		if (job.Action == ActionAnnounce || job.Action == ActionMessage) && job.Content == "" {
+			return fmt.Errorf("动作 %s 需要内容", job.Action)
+		}
+	}
+	if slices.ContainsFunc(job.Warnings, func(m int) bool { return m <= 0 }) {
+		return fmt.Errorf("提醒时间必须大于0分钟")
+	}
+	job.schedule = schedule
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("任务 %s 已存在", job.Name)
+	}
+	s.jobs[job.Name] = job
+	return nil
+}
+
+// save 持久化运行时添加的任务
+func (s *Scheduler) save() {
+	s.mu.RLock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if !job.FromConfig {
+			jobs = append(jobs, job)
+		}
+	}
+	s.mu.RUnlock()
+
+	if err := saveJSON(scheduleFileName, jobs); err != nil {
+		llog.Errorf("[dst forward计划] 保存计划任务失败: %v", err)
+	}
+}
+
+// isDue 判断计划是否恰好在 t 时刻触发
+func isDue(schedule cron.Schedule, t time.Time) bool {
+	return schedule.Next(t.Add(-time.Second)).Equal(t)
+}
+
+var GlobalScheduler *Scheduler
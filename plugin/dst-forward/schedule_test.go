@@ -0,0 +1,116 @@
+package dstforward
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestIsDue(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"*/30 * * * *", at(10, 0), true},
+		{"*/30 * * * *", at(10, 30), true},
+		{"*/30 * * * *", at(10, 15), false},
+		{"0 5 * * *", at(5, 0), true},
+		{"0 5 * * *", at(5, 1), false},
+		{"0 5 * * *", at(4, 59), false},
+	}
+	for _, tt := range tests {
+		schedule, err := cron.ParseStandard(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isDue(schedule, tt.t); got != tt.want {
+			t.Errorf("isDue(%q, %s) = %v, want %v", tt.spec, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseJobOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		fields       []string
+		wantWarnings []int
+		wantCluster  string
+		wantRest     []string
+		wantErr      bool
+	}{
+		{"没有选项", []string{"服务器", "即将维护"}, nil, "", []string{"服务器", "即将维护"}, false},
+		{"提醒", []string{"提醒=10,5,1"}, []int{10, 5, 1}, "", []string{}, false},
+		{"提醒与集群", []string{"集群=cave", "提醒=5", "洞穴", "重启"}, []int{5}, "cave", []string{"洞穴", "重启"}, false},
+		{"内容中的等号不是选项", []string{"a=b", "提醒=5"}, nil, "", []string{"a=b", "提醒=5"}, false},
+		{"提醒时间无效", []string{"提醒=5,x"}, nil, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &Job{}
+			rest, err := parseJobOptions(job, tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(job.Warnings, tt.wantWarnings) || job.Cluster != tt.wantCluster {
+				t.Fatalf("warnings = %v, cluster = %q, want %v, %q", job.Warnings, job.Cluster, tt.wantWarnings, tt.wantCluster)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Fatalf("rest = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestWarningText(t *testing.T) {
+	tests := []struct {
+		job  Job
+		want string
+	}{
+		{Job{Action: ActionSave}, "服务器将在 5 分钟后存档"},
+		{Job{Action: ActionRestart}, "服务器将在 5 分钟后重启，请做好准备"},
+		{Job{Action: ActionAnnounce, Content: "活动开始"}, "5 分钟后公告: 活动开始"},
+		{Job{Action: ActionMessage, Content: "开服"}, "5 分钟后: 开服"},
+		{Job{}, ""},
+	}
+	for _, tt := range tests {
+		if got := warningText(&tt.job, 5); got != tt.want {
+			t.Errorf("warningText(%s) = %q, want %q", tt.job.Action, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     Job
+		wantErr bool
+	}{
+		{"有效", Job{Name: "存档", Spec: "*/30 * * * *", Action: ActionSave}, false},
+		{"重名", Job{Name: "存档", Spec: "0 * * * *", Action: ActionSave}, true},
+		{"名称为空", Job{Spec: "0 * * * *", Action: ActionSave}, true},
+		{"cron无效", Job{Name: "a", Spec: "every day", Action: ActionSave}, true},
+		{"动作无效", Job{Name: "b", Spec: "0 * * * *", Action: "shutdown"}, true},
+		{"公告缺少内容", Job{Name: "c", Spec: "0 * * * *", Action: ActionAnnounce}, true},
+		{"提醒时间无效", Job{Name: "d", Spec: "0 5 * * *", Action: ActionRestart, Warnings: []int{5, 0}}, true},
+		{"带集群与提醒", Job{Name: "e", Spec: "0 5 * * *", Action: ActionRestart, Warnings: []int{10, 5}, Cluster: "cave"}, false},
+	}
+	s := &Scheduler{jobs: make(map[string]*Job)}
+	for _, tt := range tests {
+		job := tt.job
+		if err := s.add(&job); (err != nil) != tt.wantErr {
+			t.Errorf("%s: add() err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if n := len(s.List()); n != 2 {
+		t.Fatalf("任务数 = %d, want 2", n)
+	}
+}
@@ -1,14 +1,18 @@
 package dstforward
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/LagrangeDev/LagrangeGo/message"
 	"github.com/gin-gonic/gin"
 	"llma.dev/bot"
 	"llma.dev/config"
+	"llma.dev/logic"
 	"llma.dev/utils/llog"
 )
 
@@ -19,13 +23,10 @@ const (
 	MsgCmd  MsgType = 1 // 命令
 )
 
-type MsgQueue struct {
-	Messages []Message
-	MaxSize  int
-}
-
 // Message 消息结构
 type Message struct {
+	// Version 协议版本
+	Version int `json:"version"`
 	// Type 0 消息 1 命令
 	Type MsgType `json:"type"`
 	// Data 主要数据
@@ -34,6 +35,8 @@ type Message struct {
 
 // Data 消息主要数据
 type Data struct {
+	// ID 命令id，需要回传执行结果的命令才会存在
+	ID string `json:"id,omitempty"`
 	// Source 来源信息，群组号
 	Source Source `json:"source"`
 	// Sender 发送者信息
@@ -42,6 +45,10 @@ type Data struct {
 	Head string `json:"head"`
 	// Content 消息正文
 	Content any `json:"content"`
+	// Origin 经过转发的消息的原始来源
+	Origin *Origin `json:"origin,omitempty"`
+	// Target 仅发送给该科雷id的玩家，为空时发送给所有玩家
+	Target string `json:"target,omitempty"`
 }
 
 // Source 来源信息
@@ -62,35 +69,65 @@ type Sender struct {
 	Nick string `json:"nick,omitempty"`
 }
 
-func DefaultQueue() MsgQueue {
-	return MsgQueue{MaxSize: 5}
+type DstMsg struct {
+	UserName      string  `json:"userName"`         // 玩家名称
+	SurvivorsName string  `json:"survivorsName"`    // 角色名称，如 Wendy
+	KleiID        string  `json:"kleiId"`           // 科雷 id
+	Message       string  `json:"message"`          // 消息正文
+	Cluster       string  `json:"cluster"`          // 集群名称，可选
+	Origin        *Origin `json:"origin,omitempty"` // 消息是由其他端点转发而来时的原始来源，可选
+	MsgID         string  `json:"msgId,omitempty"`  // 客户端消息id，用于重试去重，可选
 }
 
-// 入队
-func (m *MsgQueue) enqueue(msg Message) {
-	llog.Debugf("[dst forward队列] 插入队列消息: %v", msg)
-	m.Messages = append(m.Messages, msg)
-	if len(m.Messages) > m.MaxSize {
-		m.Messages = m.Messages[len(m.Messages)-m.MaxSize : len(m.Messages)]
-	}
+// 游戏事件类型
+const (
+	EventJoin     = "join"     // 玩家加入
+	EventLeave    = "leave"    // 玩家离开
+	EventDeath    = "death"    // 玩家死亡
+	EventAnnounce = "announce" // 服务器公告
+)
+
+// DstEvent 游戏事件
+type DstEvent struct {
+	Type          string `json:"type"`            // 事件类型
+	UserName      string `json:"userName"`        // 玩家名称
+	SurvivorsName string `json:"survivorsName"`   // 角色名称
+	KleiID        string `json:"kleiId"`          // 科雷 id
+	Message       string `json:"message"`         // 事件描述，如死亡原因、公告内容
+	Cluster       string `json:"cluster"`         // 集群名称，可选
+	MsgID         string `json:"msgId,omitempty"` // 客户端消息id，用于重试去重，可选
+}
+
+// bearerTokenValid 请求是否携带了正确的 Authorization: Bearer <token>
+func bearerTokenValid(c *gin.Context, token string) bool {
+	got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
 }
 
-// 全取出
-func (m *MsgQueue) drain() []Message {
-	msgs := m.Messages
-	llog.Debugf("[dst forward队列] 取出当前队列: %v", msgs)
-	if len(msgs) == 0 {
-		return []Message{}
+// modRequestTrusted 请求是否来自可信的 mod，可信的请求才能以玩家身份执行游戏内命令与绑定验证
+// 配置了令牌时必须携带令牌，否则要求IP白名单不为空
+func modRequestTrusted(c *gin.Context, allowedIPs []string, token string) bool {
+	if token != "" {
+		return bearerTokenValid(c, token)
 	}
-	m.Messages = []Message{}
-	return msgs
+	return len(allowedIPs) > 0
 }
 
-type DstMsg struct {
-	UserName      string `json:"userName"`      // 玩家名称
-	SurvivorsName string `json:"survivorsName"` // 角色名称，如 Wendy
-	KleiID        string `json:"kleiId"`        // 科雷 id
-	Message       string `json:"message"`       // 消息正文
+// archiveAuthMiddleware 聊天记录接口认证，配置了令牌时必须携带令牌
+// 未配置令牌且IP白名单为空时任何人都能访问，此时禁用接口
+func archiveAuthMiddleware(allowedIPs []string, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" {
+			if !bearerTokenValid(c, token) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "访问令牌无效"})
+				return
+			}
+		} else if len(allowedIPs) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "未配置 allowedIPs 或 archive.token，聊天记录接口已禁用"})
+			return
+		}
+		c.Next()
+	}
 }
 
 func IPWhitelistMiddleware(allowedIPs []string) gin.HandlerFunc {
@@ -119,7 +156,7 @@ func IPWhitelistMiddleware(allowedIPs []string) gin.HandlerFunc {
 	}
 }
 
-func (queue *MsgQueue) enqueueGroupMessage(groupMsg *message.GroupMessage) {
+func (queue *MsgQueue) enqueueGroupMessage(groupMsg *message.GroupMessage, content string, origin Origin) {
 	queue.enqueue(Message{
 		Type: MsgText,
 		Data: Data{
@@ -132,41 +169,43 @@ func (queue *MsgQueue) enqueueGroupMessage(groupMsg *message.GroupMessage) {
 				Name: groupMsg.Sender.CardName,
 				Nick: groupMsg.Sender.Nickname,
 			},
-			Content: groupMsg.ToString(),
+			Content: content,
+			Origin:  &origin,
 		},
 	})
 }
 func (queue *MsgQueue) enqueueCmdMsgByGroup(head string, content any, groupMsg *message.GroupMessage) {
-	queue.enqueue(Message{
-		Type: MsgCmd,
-		Data: Data{
-			Source: Source{
-				ID:   groupMsg.GroupUin,
-				Name: groupMsg.GroupName,
-			},
-			Sender: Sender{
-				ID:   groupMsg.Sender.Uin,
-				Name: groupMsg.Sender.CardName,
-				Nick: groupMsg.Sender.Nickname,
-			},
-			Head:    head,
-			Content: content,
+	queue.enqueueCmdMsg(head, content,
+		Source{
+			ID:   groupMsg.GroupUin,
+			Name: groupMsg.GroupName,
 		},
-	})
+		Sender{
+			ID:   groupMsg.Sender.Uin,
+			Name: groupMsg.Sender.CardName,
+			Nick: groupMsg.Sender.Nickname,
+		})
 }
 func (queue *MsgQueue) enqueueCmdMsgByPrivate(head string, content any, privateMsg *message.PrivateMessage) {
+	queue.enqueueCmdMsg(head, content,
+		Source{
+			ID:   privateMsg.Sender.Uin,
+			Name: privateMsg.Sender.CardName,
+		},
+		Sender{
+			ID:   privateMsg.Sender.Uin,
+			Name: privateMsg.Sender.CardName,
+			Nick: privateMsg.Sender.Nickname,
+		})
+}
+
+// enqueueCmdMsg 插入命令消息，由bot自身发起的命令 source 和 sender 为空
+func (queue *MsgQueue) enqueueCmdMsg(head string, content any, source Source, sender Sender) {
 	queue.enqueue(Message{
 		Type: MsgCmd,
 		Data: Data{
-			Source: Source{
-				ID:   privateMsg.Sender.Uin,
-				Name: privateMsg.Sender.CardName,
-			},
-			Sender: Sender{
-				ID:   privateMsg.Sender.Uin,
-				Name: privateMsg.Sender.CardName,
-				Nick: privateMsg.Sender.Nickname,
-			},
+			Source:  source,
+			Sender:  sender,
 			Head:    head,
 			Content: content,
 		},
@@ -187,15 +226,42 @@ func (w *ErrorWriterAdapter) Write(p []byte) (n int, err error) {
 }
 
 func parseDstMsg(m DstMsg) *message.TextElement {
+	userName := m.UserName
+	// 已绑定的玩家在名称后附上QQ名
+	if b, ok := GlobalBindStore.ByKleiID(m.KleiID); ok {
+		userName = fmt.Sprintf("%s[%s]", m.UserName, b.QQName)
+	}
+	// 非默认集群的消息附上集群名称
+	if m.Cluster != "" && m.Cluster != defaultCluster {
+		userName = fmt.Sprintf("[%s] %s", m.Cluster, userName)
+	}
 	format := `%s (%s) : %s`
 	return message.NewText(fmt.Sprintf(
 		format,
-		m.UserName,
+		userName,
 		m.SurvivorsName,
 		m.Message,
 	))
 }
 
+func parseDstEvent(e DstEvent) *message.TextElement {
+	var text string
+	switch e.Type {
+	case EventJoin:
+		text = fmt.Sprintf("%s 加入了服务器", e.UserName)
+	case EventLeave:
+		text = fmt.Sprintf("%s 离开了服务器", e.UserName)
+	case EventDeath:
+		text = fmt.Sprintf("%s (%s) 死亡了", e.UserName, e.SurvivorsName)
+		if e.Message != "" {
+			text += ": " + e.Message
+		}
+	case EventAnnounce:
+		text = fmt.Sprintf("[公告] %s", e.Message)
+	}
+	return message.NewText(text)
+}
+
 func initGinWriter() {
 	writer := &WriterAdapter{}
 	gin.DefaultWriter = writer
@@ -203,7 +269,80 @@ func initGinWriter() {
 	gin.DefaultErrorWriter = errorWirte
 }
 
-var GlobalMsgQueue MsgQueue = DefaultQueue()
+// sendElementsToBindGroups 向所有绑定群聊发送消息
+func sendElementsToBindGroups(elements []message.IMessageElement) {
+	for _, gid := range config.GlobalConfig.Other.BindGroups {
+		bot.QQClient.Client().SendGroupMessage(gid, elements)
+	}
+}
+
+// sendToBindGroups 向所有绑定群聊发送文本消息
+func sendToBindGroups(text string) {
+	sendElementsToBindGroups(simpleTextElements(text))
+}
+
+var GlobalMsgQueue = DefaultQueue()
+
+// handleDstMsg 处理游戏聊天消息，重复的消息会被忽略，返回是否为重复消息
+// trusted 为 false 时不执行绑定验证与游戏内命令，避免伪造的请求冒充玩家
+func handleDstMsg(msg DstMsg, trusted bool) bool {
+	if GlobalDedup.Seen(msg.Cluster, msg.MsgID) {
+		llog.Debugf("[dst forward] 忽略重复消息 %s", msg.MsgID)
+		return true
+	}
+	publishEvent(DstMessageReceived{Msg: msg})
+	if trusted {
+		// 绑定验证码不转发到群聊
+		if GlobalBindStore.Verify(msg.KleiID, strings.TrimSpace(msg.Message)) {
+			return false
+		}
+		// 游戏内命令不转发到群聊
+		if dispatchGameCommand(msg) {
+			return false
+		}
+	}
+	// 刷屏的消息不转发，但仍计入统计与存档
+	if allowFlood(msg) {
+		relayDstMsg(msg)
+	}
+	if GlobalStats != nil {
+		GlobalStats.OnMessage(msg.Cluster, msg.KleiID, msg.UserName)
+	}
+	archive(ArchiveRecord{
+		Direction:  DirectionToQQ,
+		Cluster:    clusterName(msg.Cluster),
+		SenderID:   msg.KleiID,
+		SenderName: msg.UserName,
+		Content:    msg.Message,
+	})
+	return false
+}
+
+// handleDstEvent 处理游戏事件，重复的事件会被忽略，返回是否为重复事件
+func handleDstEvent(event DstEvent) bool {
+	if GlobalDedup.Seen(event.Cluster, event.MsgID) {
+		llog.Debugf("[dst forward] 忽略重复事件 %s", event.MsgID)
+		return true
+	}
+	publishEvent(DstEventReceived{Event: event})
+	element := parseDstEvent(event)
+	for _, gid := range config.GlobalConfig.Other.BindGroups {
+		if policyFor(gid).acceptsEvent(event.Type) {
+			bot.QQClient.Client().SendGroupMessage(gid, []message.IMessageElement{element})
+		}
+	}
+	if GlobalStats != nil {
+		GlobalStats.OnEvent(event.Cluster, event)
+	}
+	archive(ArchiveRecord{
+		Direction:  DirectionEvent,
+		Cluster:    clusterName(event.Cluster),
+		SenderID:   event.KleiID,
+		SenderName: event.UserName,
+		Content:    element.Content,
+	})
+	return false
+}
 
 func registerServer() {
 	initGinWriter()
@@ -215,26 +354,85 @@ func registerServer() {
 	router := gin.Default()
 
 	router.Use(IPWhitelistMiddleware(otherConfig.AllowedIPs))
+	if otherConfig.ModToken == "" && len(otherConfig.AllowedIPs) == 0 {
+		llog.Warningf("[dst forward] 未配置 modToken 或 allowedIPs，不执行游戏内命令与绑定验证")
+	}
+	router.Use(ProtocolVersionMiddleware())
+
+	registerProtocolRoutes(router)
 
 	router.POST("/send_msg", func(c *gin.Context) {
 		var msg DstMsg
-		if err := c.ShouldBindJSON(&msg); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+		if !bindStrict(c, &msg) {
 			return
 		}
-		for _, gid := range otherConfig.BindGroups {
+		handleDstMsg(msg, modRequestTrusted(c, otherConfig.AllowedIPs, otherConfig.ModToken))
+		c.Status(http.StatusOK)
+	})
 
-			bot.QQClient.Client().SendGroupMessage(
-				gid,
-				[]message.IMessageElement{parseDstMsg(msg)},
-			)
+	router.POST("/send_event", func(c *gin.Context) {
+		var event DstEvent
+		if !bindStrict(c, &event) {
+			return
 		}
+		handleDstEvent(event)
+		c.Status(http.StatusOK)
+	})
+
+	router.POST("/send_batch", func(c *gin.Context) {
+		var batch SendBatch
+		if !bindStrict(c, &batch) {
+			return
+		}
+		c.JSON(http.StatusOK, handleBatch(batch, modRequestTrusted(c, otherConfig.AllowedIPs, otherConfig.ModToken)))
+	})
 
+	router.GET("/archive/search", archiveAuthMiddleware(otherConfig.AllowedIPs, config.GlobalConfig.Archive.Token), func(c *gin.Context) {
+		if GlobalArchive == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未启用聊天记录存档"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("limit 必须是 1-%d 之间的整数", maxSearchLimit)})
+			return
+		}
+		records, err := GlobalArchive.Search(c.Query("q"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, records)
+	})
+
+	router.POST("/cmd_result", func(c *gin.Context) {
+		var result CmdResult
+		if !bindStrict(c, &result) {
+			return
+		}
+		if !GlobalResults.Resolve(result) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "命令不存在或已过期"})
+			return
+		}
 		c.Status(http.StatusOK)
 	})
 
 	router.GET("/get_msg", func(c *gin.Context) {
-		c.JSON(http.StatusOK, GlobalMsgQueue.drain())
+		c.JSON(http.StatusOK, queueFor(c.Query("cluster")).drain())
+	})
+
+	router.GET("/queue/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, queueStats())
+	})
+
+	// 当前有效的事件订阅，用于调试
+	router.GET("/events/subscriptions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, logic.Manager.GetEventBus().Subscriptions())
+	})
+
+	// 事件总线队列深度与处理耗时统计
+	router.GET("/events/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, logic.Manager.GetEventBus().Stats())
 	})
 
 	router.Run(fmt.Sprintf(":%d", otherConfig.GinPort))
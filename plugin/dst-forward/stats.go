@@ -0,0 +1,333 @@
+package dstforward
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"llma.dev/utils/llog"
+)
+
+// 统计数据文件名
+const statsFileName = "stats.json"
+
+// 统计数据落盘间隔
+const statsSaveInterval = time.Minute
+
+// 未指定集群时使用的集群名称
+const defaultCluster = "default"
+
+// 排行榜类型
+const (
+	RankPlaytime = "在线时长"
+	RankMessages = "消息"
+	RankDeaths   = "死亡"
+)
+
+// PlayerStats 玩家统计数据
+type PlayerStats struct {
+	KleiID   string `json:"kleiId"`
+	UserName string `json:"userName"`
+	// Playtime 累计在线时长(不含当前会话)
+	Playtime time.Duration `json:"playtime"`
+	Messages int           `json:"messages"`
+	Deaths   int           `json:"deaths"`
+	LastSeen time.Time     `json:"lastSeen"`
+	// OnlineSince 当前会话开始时间，离线时为零值
+	OnlineSince time.Time `json:"onlineSince,omitzero"`
+
+	// 本周数据，每周汇总后清零
+	WeekPlaytime time.Duration `json:"weekPlaytime"`
+	WeekMessages int           `json:"weekMessages"`
+	WeekDeaths   int           `json:"weekDeaths"`
+}
+
+// totalPlaytime 包含当前会话的在线时长
+func (p PlayerStats) totalPlaytime(now time.Time) time.Duration {
+	if p.OnlineSince.IsZero() {
+		return p.Playtime
+	}
+	return p.Playtime + now.Sub(p.OnlineSince)
+}
+
+// weekPlaytime 包含当前会话的本周在线时长
+func (p PlayerStats) weekPlaytime(now time.Time, weekStart time.Time) time.Duration {
+	if p.OnlineSince.IsZero() {
+		return p.WeekPlaytime
+	}
+	since := p.OnlineSince
+	if since.Before(weekStart) {
+		since = weekStart
+	}
+	return p.WeekPlaytime + now.Sub(since)
+}
+
+// String 统计数据的展示文本
+func (p PlayerStats) String() string {
+	now := time.Now()
+	status := "离线"
+	if !p.OnlineSince.IsZero() {
+		status = "在线"
+	}
+	return fmt.Sprintf("%s (%s) [%s]\n在线时长: %s\n消息数: %d\n死亡数: %d\n最后在线: %s",
+		p.UserName, p.KleiID, status,
+		formatDuration(p.totalPlaytime(now)), p.Messages, p.Deaths,
+		p.LastSeen.Format("2006-01-02 15:04"))
+}
+
+// StatsStore 按集群存储的玩家统计
+type StatsStore struct {
+	mu sync.Mutex
+	// Clusters 集群 -> 科雷id -> 统计
+	Clusters map[string]map[string]*PlayerStats `json:"clusters"`
+	// WeekStart 本周统计开始时间
+	WeekStart time.Time `json:"weekStart"`
+	dirty     bool
+}
+
+// NewStatsStore 创建统计存储并读取持久化数据
+func NewStatsStore() *StatsStore {
+	s := &StatsStore{Clusters: make(map[string]map[string]*PlayerStats)}
+	if err := loadJSON(statsFileName, s); err != nil {
+		llog.Errorf("[dst forward统计] 读取统计数据失败: %v", err)
+	}
+	if s.Clusters == nil {
+		s.Clusters = make(map[string]map[string]*PlayerStats)
+	}
+	if s.WeekStart.IsZero() {
+		s.WeekStart = time.Now()
+	}
+	// 程序重启期间无法得知玩家是否离开，按重启前最后在线时间结算
+	for _, players := range s.Clusters {
+		for _, p := range players {
+			if !p.OnlineSince.IsZero() {
+				s.settle(p, p.LastSeen)
+			}
+		}
+	}
+	return s
+}
+
+// OnMessage 记录玩家发言
+func (s *StatsStore) OnMessage(cluster string, kleiID string, userName string) {
+	s.update(cluster, kleiID, userName, func(p *PlayerStats, now time.Time) {
+		p.Messages++
+		p.WeekMessages++
+	})
+}
+
+// OnEvent 记录游戏事件
+func (s *StatsStore) OnEvent(cluster string, event DstEvent) {
+	s.update(cluster, event.KleiID, event.UserName, func(p *PlayerStats, now time.Time) {
+		switch event.Type {
+		case EventJoin:
+			if p.OnlineSince.IsZero() {
+				p.OnlineSince = now
+			}
+		case EventLeave:
+			s.settle(p, now)
+		case EventDeath:
+			p.Deaths++
+			p.WeekDeaths++
+		}
+	})
+}
+
+// Get 查询玩家统计
+func (s *StatsStore) Get(cluster string, kleiID string) (PlayerStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.Clusters[s.resolveCluster(cluster)][kleiID]
+	if !ok {
+		return PlayerStats{}, false
+	}
+	return *p, true
+}
+
+// Rank 按指定类型排序的前 limit 名玩家，返回展示文本
+func (s *StatsStore) Rank(cluster string, kind string, limit int) ([]string, error) {
+	var value func(p *PlayerStats, now time.Time) (int64, string)
+	switch kind {
+	case RankPlaytime:
+		value = func(p *PlayerStats, now time.Time) (int64, string) {
+			d := p.totalPlaytime(now)
+			return int64(d), formatDuration(d)
+		}
+	case RankMessages:
+		value = func(p *PlayerStats, now time.Time) (int64, string) {
+			return int64(p.Messages), fmt.Sprintf("%d 条", p.Messages)
+		}
+	case RankDeaths:
+		value = func(p *PlayerStats, now time.Time) (int64, string) {
+			return int64(p.Deaths), fmt.Sprintf("%d 次", p.Deaths)
+		}
+	default:
+		return nil, fmt.Errorf("未知的排行类型 %s，可选: %s", kind, strings.Join([]string{RankPlaytime, RankMessages, RankDeaths}, " "))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rankLines(s.Clusters[s.resolveCluster(cluster)], value, limit), nil
+}
+
+// WeeklySummary 生成各集群的本周汇总并清零本周数据
+func (s *StatsStore) WeeklySummary() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	weekStart := s.WeekStart
+	var summaries []string
+	for cluster, players := range s.Clusters {
+		var active int
+		var total time.Duration
+		for _, p := range players {
+			d := p.weekPlaytime(now, weekStart)
+			if d > 0 || p.WeekMessages > 0 {
+				active++
+			}
+			total += d
+		}
+		if active == 0 {
+			continue
+		}
+
+		lines := []string{
+			fmt.Sprintf("[%s] 本周统计 (%s - %s)", cluster, weekStart.Format("01-02"), now.Format("01-02")),
+			fmt.Sprintf("活跃玩家: %d 总在线时长: %s", active, formatDuration(total)),
+			"在线时长排行:",
+		}
+		lines = append(lines, rankLines(players, func(p *PlayerStats, now time.Time) (int64, string) {
+			d := p.weekPlaytime(now, weekStart)
+			return int64(d), formatDuration(d)
+		}, 5)...)
+		summaries = append(summaries, strings.Join(lines, "\n"))
+	}
+
+	for _, players := range s.Clusters {
+		for _, p := range players {
+			p.WeekPlaytime = 0
+			p.WeekMessages = 0
+			p.WeekDeaths = 0
+		}
+	}
+	s.WeekStart = now
+	s.dirty = true
+	return summaries
+}
+
+// update 更新玩家统计
+func (s *StatsStore) update(cluster string, kleiID string, userName string, fn func(p *PlayerStats, now time.Time)) {
+	if kleiID == "" {
+		return
+	}
+	if cluster == "" {
+		cluster = defaultCluster
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	players, ok := s.Clusters[cluster]
+	if !ok {
+		players = make(map[string]*PlayerStats)
+		s.Clusters[cluster] = players
+	}
+	p, ok := players[kleiID]
+	if !ok {
+		p = &PlayerStats{KleiID: kleiID}
+		players[kleiID] = p
+	}
+	if userName != "" {
+		p.UserName = userName
+	}
+	fn(p, now)
+	p.LastSeen = now
+	s.dirty = true
+}
+
+// settle 结算当前会话的在线时长
+func (s *StatsStore) settle(p *PlayerStats, end time.Time) {
+	if p.OnlineSince.IsZero() {
+		return
+	}
+	if end.After(p.OnlineSince) {
+		p.Playtime += end.Sub(p.OnlineSince)
+		since := p.OnlineSince
+		if since.Before(s.WeekStart) {
+			since = s.WeekStart
+		}
+		if end.After(since) {
+			p.WeekPlaytime += end.Sub(since)
+		}
+	}
+	p.OnlineSince = time.Time{}
+}
+
+// resolveCluster 未指定集群时，只有一个集群则使用该集群，否则使用默认集群
+func (s *StatsStore) resolveCluster(cluster string) string {
+	if cluster != "" {
+		return cluster
+	}
+	if len(s.Clusters) == 1 {
+		for name := range s.Clusters {
+			return name
+		}
+	}
+	return defaultCluster
+}
+
+// watchSave 定时保存有变化的统计数据
+func (s *StatsStore) watchSave() {
+	ticker := time.NewTicker(statsSaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		if s.dirty {
+			if err := saveJSON(statsFileName, s); err != nil {
+				llog.Errorf("[dst forward统计] 保存统计数据失败: %v", err)
+			}
+			s.dirty = false
+		}
+		s.mu.Unlock()
+	}
+}
+
+// rankLines 生成排行榜文本
+func rankLines(players map[string]*PlayerStats, value func(p *PlayerStats, now time.Time) (int64, string), limit int) []string {
+	type entry struct {
+		player *PlayerStats
+		value  int64
+		text   string
+	}
+	now := time.Now()
+	entries := make([]entry, 0, len(players))
+	for _, p := range players {
+		v, text := value(p, now)
+		if v > 0 {
+			entries = append(entries, entry{player: p, value: v, text: text})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].value > entries[j].value
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	lines := make([]string, 0, len(entries))
+	for i, e := range entries {
+		lines = append(lines, fmt.Sprintf("%d. %s %s", i+1, e.player.UserName, e.text))
+	}
+	return lines
+}
+
+// postWeeklySummary 向允许游戏消息转发的绑定群聊发送每周统计
+func postWeeklySummary() {
+	for _, summary := range GlobalStats.WeeklySummary() {
+		sendToQQGroups(summary)
+	}
+}
+
+var GlobalStats *StatsStore
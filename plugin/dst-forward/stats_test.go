@@ -0,0 +1,109 @@
+package dstforward
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsStoreCounts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewStatsStore()
+
+	s.OnMessage("", "KU_a", "威尔逊")
+	s.OnMessage("", "KU_a", "")
+	s.OnMessage("cave", "KU_a", "威尔逊")
+	s.OnEvent("", DstEvent{Type: EventDeath, KleiID: "KU_a", UserName: "威尔逊"})
+	s.OnEvent("", DstEvent{Type: EventDeath, KleiID: "KU_b", UserName: "薇洛"})
+	s.OnEvent("", DstEvent{Type: EventDeath, KleiID: "KU_b", UserName: "薇洛"})
+	s.OnMessage("", "", "没有科雷id")
+
+	p, ok := s.Get(defaultCluster, "KU_a")
+	if !ok || p.Messages != 2 || p.Deaths != 1 || p.UserName != "威尔逊" {
+		t.Errorf("default 集群 KU_a = %+v, %v", p, ok)
+	}
+	// 各集群分开统计
+	if p, _ := s.Get("cave", "KU_a"); p.Messages != 1 || p.Deaths != 0 {
+		t.Errorf("cave 集群 KU_a = %+v", p)
+	}
+	// 有多个集群时，未指定集群查询 default 集群
+	if p, _ := s.Get("", "KU_b"); p.Deaths != 2 {
+		t.Errorf("未指定集群 KU_b = %+v", p)
+	}
+
+	lines, err := s.Rank("", RankDeaths, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1. 薇洛 2 次", "2. 威尔逊 1 次"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("死亡排行 = %q, want %q", lines, want)
+	}
+	if _, err := s.Rank("", "胜利", 10); err == nil {
+		t.Error("未知的排行类型应返回错误")
+	}
+}
+
+func TestStatsStorePlaytime(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewStatsStore()
+	s.WeekStart = time.Now().Add(-time.Hour)
+
+	s.OnEvent("forest", DstEvent{Type: EventJoin, KleiID: "KU_a", UserName: "威尔逊"})
+	s.Clusters["forest"]["KU_a"].OnlineSince = time.Now().Add(-2 * time.Hour)
+	s.OnEvent("forest", DstEvent{Type: EventLeave, KleiID: "KU_a"})
+
+	// 只有一个集群时，未指定集群查询该集群
+	p, ok := s.Get("", "KU_a")
+	if !ok || !p.OnlineSince.IsZero() {
+		t.Fatalf("离开后应结算在线时长: %+v", p)
+	}
+	if p.Playtime < 2*time.Hour || p.Playtime > 2*time.Hour+time.Minute {
+		t.Errorf("Playtime = %s, want 约 2h", p.Playtime)
+	}
+	// 本周在线时长只计算本周开始之后的部分
+	if p.WeekPlaytime < time.Hour || p.WeekPlaytime > time.Hour+time.Minute {
+		t.Errorf("WeekPlaytime = %s, want 约 1h", p.WeekPlaytime)
+	}
+}
+
+func TestStatsStoreWeeklySummary(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewStatsStore()
+	s.OnMessage("", "KU_a", "威尔逊")
+	s.Clusters[defaultCluster]["KU_a"].WeekPlaytime = 90 * time.Minute
+
+	summaries := s.WeeklySummary()
+	if len(summaries) != 1 || !strings.Contains(summaries[0], "活跃玩家: 1") || !strings.Contains(summaries[0], "威尔逊") {
+		t.Fatalf("WeeklySummary() = %q", summaries)
+	}
+
+	p, _ := s.Get("", "KU_a")
+	if p.WeekMessages != 0 || p.WeekPlaytime != 0 || p.Messages != 1 {
+		t.Errorf("汇总后应只清零本周数据: %+v", p)
+	}
+	if summaries := s.WeeklySummary(); len(summaries) != 0 {
+		t.Errorf("本周没有活跃玩家时不应汇总: %q", summaries)
+	}
+}
+
+func TestStatsStoreSettlesOnReload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := NewStatsStore()
+	s.OnEvent("", DstEvent{Type: EventJoin, KleiID: "KU_a", UserName: "威尔逊"})
+	p := s.Clusters[defaultCluster]["KU_a"]
+	p.OnlineSince = time.Now().Add(-time.Hour)
+	p.LastSeen = time.Now().Add(-30 * time.Minute)
+	if err := saveJSON(statsFileName, s); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启期间玩家是否在线未知，按最后在线时间结算
+	got, _ := NewStatsStore().Get("", "KU_a")
+	if !got.OnlineSince.IsZero() {
+		t.Error("重新加载后应结算上次的会话")
+	}
+	if got.Playtime < 29*time.Minute || got.Playtime > 31*time.Minute {
+		t.Errorf("Playtime = %s, want 约 30m", got.Playtime)
+	}
+}
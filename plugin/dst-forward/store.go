@@ -0,0 +1,40 @@
+package dstforward
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// 插件持久化数据目录
+const dataDir = "data"
+
+// loadJSON 从数据目录读取json文件到 v，文件不存在时不做任何修改
+func loadJSON(name string, v any) error {
+	content, err := os.ReadFile(filepath.Join(dataDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// saveJSON 将 v 写入数据目录下的json文件，先写临时文件再重命名，避免写一半时损坏原文件
+func saveJSON(name string, v any) error {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
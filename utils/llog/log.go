@@ -16,7 +16,16 @@ type Logger struct {
 	log *logrus.Logger
 }
 
-var Log *Logger
+// Log 全局日志，Init 之前使用 info 级别的文本输出，测试等未初始化的场景也可以直接使用
+var Log = defaultLogger()
+
+// defaultLogger 未调用 Init 时使用的日志
+func defaultLogger() *Logger {
+	logger := logrus.New()
+	logger.SetFormatter(&MyFormatter{})
+	logger.SetOutput(os.Stdout)
+	return &Logger{log: logger}
+}
 
 func DefaultLogConfig() *config.LogConfig {
 	return &config.LogConfig{